@@ -0,0 +1,17 @@
+package chronosclient
+
+import "context"
+
+// bearerToken attaches a static bearer token to every request
+type bearerToken string
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials. The
+// services are dialed without TLS, so the token is allowed over plaintext
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,89 @@
+package chronosclient
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Baggage keys the services act on
+const (
+	// BaggagePriority sets the priority, "high", "normal", or "low", of
+	// tasks in workflows started under it that don't set their own
+	BaggagePriority = "priority"
+	// BaggageDebug set to "true" samples every trace started under it
+	BaggageDebug = "debug"
+)
+
+// propagator carries the trace context and baggage of every call, whether
+// or not the application has set a global propagator. The services use the
+// same pair, so baggage reaches them through gRPC, Kafka, and the workers
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// WithBaggage returns a copy of ctx carrying values as OpenTelemetry baggage,
+// alongside any baggage ctx already has. Calls made with it send the baggage
+// to every service that handles the workflow, such as BaggagePriority or
+// BaggageDebug
+func WithBaggage(ctx context.Context, values map[string]string) (context.Context, error) {
+	bag := baggage.FromContext(ctx)
+	for key, value := range values {
+		member, err := baggage.NewMemberRaw(key, value)
+		if err != nil {
+			return ctx, fmt.Errorf("invalid baggage %s: %w", key, err)
+		}
+		if bag, err = bag.SetMember(member); err != nil {
+			return ctx, fmt.Errorf("invalid baggage %s: %w", key, err)
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, bag), nil
+}
+
+// metadataCarrier adapts outgoing gRPC metadata for propagation
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// withPropagation adds the trace context and baggage of ctx to its outgoing
+// metadata
+func withPropagation(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	propagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// propagationUnaryInterceptor propagates the trace context and baggage of
+// every unary call
+func propagationUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(withPropagation(ctx), method, req, reply, cc, opts...)
+}
+
+// propagationStreamInterceptor propagates the trace context and baggage of
+// every streaming call
+func propagationStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(withPropagation(ctx), desc, cc, method, opts...)
+}
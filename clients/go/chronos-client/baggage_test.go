@@ -0,0 +1,56 @@
+package chronosclient
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestWithBaggagePropagatesAsMetadata(t *testing.T) {
+	ctx, err := WithBaggage(context.Background(), map[string]string{BaggagePriority: "high"})
+	if err != nil {
+		t.Fatalf("WithBaggage: %v", err)
+	}
+	ctx, err = WithBaggage(ctx, map[string]string{BaggageDebug: "true"})
+	if err != nil {
+		t.Fatalf("WithBaggage: %v", err)
+	}
+
+	md, _ := metadata.FromOutgoingContext(withPropagation(ctx))
+	extracted := baggage.FromContext(propagator.Extract(context.Background(), metadataCarrier(md)))
+	if got := extracted.Member(BaggagePriority).Value(); got != "high" {
+		t.Errorf("priority baggage = %q, want %q", got, "high")
+	}
+	if got := extracted.Member(BaggageDebug).Value(); got != "true" {
+		t.Errorf("debug baggage = %q, want %q, earlier baggage must be kept", got, "true")
+	}
+}
+
+func TestWithBaggageKeepsOutgoingMetadata(t *testing.T) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "acme")
+	ctx, err := WithBaggage(ctx, map[string]string{BaggagePriority: "low"})
+	if err != nil {
+		t.Fatalf("WithBaggage: %v", err)
+	}
+
+	md, _ := metadata.FromOutgoingContext(withPropagation(ctx))
+	if got := md.Get("x-tenant-id"); len(got) != 1 || got[0] != "acme" {
+		t.Errorf("x-tenant-id = %v, want [acme]", got)
+	}
+	if got := md.Get("baggage"); len(got) != 1 {
+		t.Errorf("baggage metadata = %v, want one entry", got)
+	}
+}
+
+func TestWithBaggageRejectsInvalidKey(t *testing.T) {
+	ctx := context.Background()
+	got, err := WithBaggage(ctx, map[string]string{"": "x"})
+	if err == nil {
+		t.Fatal("WithBaggage accepted an empty key")
+	}
+	if got != ctx {
+		t.Error("WithBaggage returned a new context on error")
+	}
+}
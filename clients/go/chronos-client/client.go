@@ -3,6 +3,7 @@ package chronosclient
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,7 +11,7 @@ import (
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/backoff"
 )
 
 // ChronosClient is the main client for interacting with the Chronos platform
@@ -21,6 +22,8 @@ type ChronosClient struct {
 	workerPoolConn  *grpc.ClientConn
 	observatoryConn *grpc.ClientConn
 	tracer          trace.Tracer
+	fetchArtifact   ArtifactFetcher
+	closed          atomic.Bool
 }
 
 // ClientOptions contains options for creating a new ChronosClient
@@ -31,6 +34,33 @@ type ClientOptions struct {
 	WorkerPoolURL  string
 	ObservatoryURL string
 	TracerName     string
+	// TenantID is sent with every request so the services can isolate this
+	// client's workflows, schedules, and metrics from other tenants
+	TenantID string
+	// AuthToken, when set, is sent as a bearer token with every request
+	AuthToken string
+	// KeepaliveTime is how long a connection may sit idle before the client
+	// pings it; defaults to DefaultKeepaliveTime
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is how long to wait for a ping ack before closing the
+	// connection; defaults to DefaultKeepaliveTimeout
+	KeepaliveTimeout time.Duration
+	// KeepalivePermitWithoutStream sends pings even when no RPCs are active
+	KeepalivePermitWithoutStream bool
+	// ConnectBackoff controls reconnection backoff; zero fields fall back to
+	// gRPC's default backoff
+	ConnectBackoff backoff.Config
+	// MinConnectTimeout is the minimum time to give a connection attempt;
+	// defaults to DefaultMinConnectTimeout
+	MinConnectTimeout time.Duration
+	// DefaultCallTimeout bounds unary calls whose context has no deadline;
+	// defaults to DefaultTimeout, and a negative value disables it. A
+	// deadline set by the caller always applies as is
+	DefaultCallTimeout time.Duration
+	// FetchArtifact downloads spilled task results, so GetWorkflow returns
+	// every result in full. Without it, results the worker pool spilled to
+	// object storage are only referenced by Task.ResultArtifact
+	FetchArtifact ArtifactFetcher
 }
 
 // DefaultClientOptions returns the default options for creating a new ChronosClient
@@ -54,24 +84,23 @@ func NewClient(opts *ClientOptions) (*ChronosClient, error) {
 	// Initialize tracer
 	tracer := otel.Tracer(opts.TracerName)
 
+	dialOpts := opts.dialOptions()
+
 	// Connect to scheduler service
-	schedulerConn, err := grpc.NewClient(opts.SchedulerURL, 
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	schedulerConn, err := grpc.NewClient(opts.SchedulerURL, dialOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to scheduler: %w", err)
 	}
 
 	// Connect to executor service
-	executorConn, err := grpc.NewClient(opts.ExecutorURL, 
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	executorConn, err := grpc.NewClient(opts.ExecutorURL, dialOpts...)
 	if err != nil {
 		schedulerConn.Close()
 		return nil, fmt.Errorf("failed to connect to executor: %w", err)
 	}
 
 	// Connect to durable engine service
-	durableEngConn, err := grpc.NewClient(opts.DurableEngURL, 
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	durableEngConn, err := grpc.NewClient(opts.DurableEngURL, dialOpts...)
 	if err != nil {
 		schedulerConn.Close()
 		executorConn.Close()
@@ -79,8 +108,7 @@ func NewClient(opts *ClientOptions) (*ChronosClient, error) {
 	}
 
 	// Connect to worker pool service
-	workerPoolConn, err := grpc.NewClient(opts.WorkerPoolURL, 
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	workerPoolConn, err := grpc.NewClient(opts.WorkerPoolURL, dialOpts...)
 	if err != nil {
 		schedulerConn.Close()
 		executorConn.Close()
@@ -89,8 +117,7 @@ func NewClient(opts *ClientOptions) (*ChronosClient, error) {
 	}
 
 	// Connect to observatory service
-	observatoryConn, err := grpc.NewClient(opts.ObservatoryURL, 
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	observatoryConn, err := grpc.NewClient(opts.ObservatoryURL, dialOpts...)
 	if err != nil {
 		schedulerConn.Close()
 		executorConn.Close()
@@ -106,11 +133,17 @@ func NewClient(opts *ClientOptions) (*ChronosClient, error) {
 		workerPoolConn:  workerPoolConn,
 		observatoryConn: observatoryConn,
 		tracer:          tracer,
+		fetchArtifact:   opts.FetchArtifact,
 	}, nil
 }
 
-// Close closes all connections
+// Close closes all connections. Calling it again does nothing, and every
+// other method returns ErrClientClosed once it's been called
 func (c *ChronosClient) Close() error {
+	if !c.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
 	var errs []error
 
 	if err := c.schedulerConn.Close(); err != nil {
@@ -146,27 +179,70 @@ type Workflow struct {
 	Name        string
 	Description string
 	Tasks       []*Task
+	Labels      map[string]string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
+// WorkflowOption configures optional settings when creating a workflow
+type WorkflowOption func(*Workflow)
+
+// WithLabels attaches labels to a workflow, used for filtering with label selectors
+func WithLabels(labels map[string]string) WorkflowOption {
+	return func(w *Workflow) {
+		w.Labels = labels
+	}
+}
+
 // Task represents a task in the Chronos system
 type Task struct {
-	ID          string
-	WorkflowID  string
-	Name        string
-	Type        string
-	Status      string
-	Payload     []byte
-	Result      []byte
+	ID         string
+	WorkflowID string
+	Name       string
+	Type       string
+	Status     string
+	Payload    []byte
+	// Result holds small results inline; larger ones are stored as
+	// ResultArtifact instead
+	Result         []byte
+	ResultArtifact *ArtifactRef
+	// Artifacts are the task's inputs produced by upstream tasks
+	Artifacts []ArtifactRef
+	// Delay defers dispatching the task until this long after it's ready,
+	// rounded up to whole seconds
+	Delay       time.Duration
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	StartedAt   *time.Time
 	CompletedAt *time.Time
 }
 
+// TaskOption configures optional settings when adding a task
+type TaskOption func(*Task)
+
+// WithDelay defers dispatching the task until d after its dependencies
+// complete. The executor holds the task until then, including across
+// restarts
+func WithDelay(d time.Duration) TaskOption {
+	return func(t *Task) {
+		t.Delay = d
+	}
+}
+
+// ArtifactRef points at a task output kept in object storage because it was
+// too large to return inline
+type ArtifactRef struct {
+	Key         string
+	Size        int64
+	ContentType string
+}
+
 // CreateWorkflow creates a new workflow
-func (c *ChronosClient) CreateWorkflow(ctx context.Context, name, description string) (*Workflow, error) {
+func (c *ChronosClient) CreateWorkflow(ctx context.Context, name, description string, opts ...WorkflowOption) (*Workflow, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
 	ctx, span := c.tracer.Start(ctx, "ChronosClient.CreateWorkflow",
 		trace.WithAttributes(
 			attribute.String("workflow.name", name),
@@ -179,18 +255,28 @@ func (c *ChronosClient) CreateWorkflow(ctx context.Context, name, description st
 	id := uuid.New().String()
 	now := time.Now()
 
-	return &Workflow{
+	workflow := &Workflow{
 		ID:          id,
 		Name:        name,
 		Description: description,
 		Tasks:       []*Task{},
 		CreatedAt:   now,
 		UpdatedAt:   now,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(workflow)
+	}
+	span.SetAttributes(labelAttributes(workflow.Labels)...)
+
+	return workflow, nil
 }
 
 // AddTask adds a task to a workflow
-func (c *ChronosClient) AddTask(ctx context.Context, workflowID, name, taskType string, payload []byte) (*Task, error) {
+func (c *ChronosClient) AddTask(ctx context.Context, workflowID, name, taskType string, payload []byte, opts ...TaskOption) (*Task, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
 	ctx, span := c.tracer.Start(ctx, "ChronosClient.AddTask",
 		trace.WithAttributes(
 			attribute.String("workflow.id", workflowID),
@@ -204,7 +290,7 @@ func (c *ChronosClient) AddTask(ctx context.Context, workflowID, name, taskType
 	id := uuid.New().String()
 	now := time.Now()
 
-	return &Task{
+	task := &Task{
 		ID:         id,
 		WorkflowID: workflowID,
 		Name:       name,
@@ -213,11 +299,26 @@ func (c *ChronosClient) AddTask(ctx context.Context, workflowID, name, taskType
 		Payload:    payload,
 		CreatedAt:  now,
 		UpdatedAt:  now,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(task)
+	}
+	if task.Delay < 0 {
+		return nil, fmt.Errorf("task delay must not be negative, got %s", task.Delay)
+	}
+	if task.Delay > 0 {
+		span.SetAttributes(attribute.String("task.delay", task.Delay.String()))
+	}
+
+	return task, nil
 }
 
 // StartWorkflow starts a workflow
 func (c *ChronosClient) StartWorkflow(ctx context.Context, workflowID string) error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+
 	ctx, span := c.tracer.Start(ctx, "ChronosClient.StartWorkflow",
 		trace.WithAttributes(
 			attribute.String("workflow.id", workflowID),
@@ -228,8 +329,74 @@ func (c *ChronosClient) StartWorkflow(ctx context.Context, workflowID string) er
 	return nil
 }
 
-// GetWorkflow gets a workflow by ID
+// CancelWorkflow cancels a running workflow
+func (c *ChronosClient) CancelWorkflow(ctx context.Context, workflowID string) error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.CancelWorkflow",
+		trace.WithAttributes(
+			attribute.String("workflow.id", workflowID),
+		))
+	defer span.End()
+
+	// In a real implementation, this would call the executor's CancelWorkflow method
+	return nil
+}
+
+// DeleteWorkflow deletes a workflow along with the artifacts its tasks stored
+func (c *ChronosClient) DeleteWorkflow(ctx context.Context, workflowID string) error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.DeleteWorkflow",
+		trace.WithAttributes(
+			attribute.String("workflow.id", workflowID),
+		))
+	defer span.End()
+
+	if workflowID == "" {
+		return fmt.Errorf("workflow ID is required")
+	}
+
+	// In a real implementation, this would call the executor's DeleteWorkflow method
+	return nil
+}
+
+// ReplayWorkflow submits a finished workflow run again as a new run linked
+// to the original, returning the new run's ID. With fromTask set, only that
+// task and those downstream of it are executed again; the rest are resumed
+// from the original run's results, so they must have completed in it
+func (c *ChronosClient) ReplayWorkflow(ctx context.Context, id string, fromTask string) (string, error) {
+	if c.closed.Load() {
+		return "", ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.ReplayWorkflow",
+		trace.WithAttributes(
+			attribute.String("workflow.run_id", id),
+			attribute.String("workflow.replay_from_task", fromTask),
+		))
+	defer span.End()
+
+	if id == "" {
+		return "", fmt.Errorf("run ID is required")
+	}
+
+	// In a real implementation, this would call the executor's ReplayWorkflow method
+	// For now, we'll just return a new run ID
+	return uuid.New().String(), nil
+}
+
+// GetWorkflow gets a workflow by ID, along with its tasks and their results.
+// Spilled results are fetched with ClientOptions.FetchArtifact
 func (c *ChronosClient) GetWorkflow(ctx context.Context, workflowID string) (*Workflow, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
 	ctx, span := c.tracer.Start(ctx, "ChronosClient.GetWorkflow",
 		trace.WithAttributes(
 			attribute.String("workflow.id", workflowID),
@@ -240,18 +407,49 @@ func (c *ChronosClient) GetWorkflow(ctx context.Context, workflowID string) (*Wo
 	// For now, we'll just return a mock workflow
 	now := time.Now()
 
-	return &Workflow{
+	workflow := &Workflow{
 		ID:          workflowID,
 		Name:        "Mock Workflow",
 		Description: "This is a mock workflow",
 		Tasks:       []*Task{},
 		CreatedAt:   now,
 		UpdatedAt:   now,
-	}, nil
+	}
+	if err := c.resolveResults(ctx, workflow); err != nil {
+		return nil, err
+	}
+
+	return workflow, nil
+}
+
+// ListWorkflows lists workflows matching a label selector such as
+// "team=payments,env=prod"; an empty selector matches every workflow
+func (c *ChronosClient) ListWorkflows(ctx context.Context, selector string) ([]*Workflow, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.ListWorkflows",
+		trace.WithAttributes(
+			attribute.String("workflow.label_selector", selector),
+		))
+	defer span.End()
+
+	if _, err := parseLabelSelector(selector); err != nil {
+		return nil, err
+	}
+
+	// In a real implementation, this would call the appropriate gRPC method
+	// For now, we'll just return an empty list
+	return []*Workflow{}, nil
 }
 
 // GetTask gets a task by ID
 func (c *ChronosClient) GetTask(ctx context.Context, taskID string) (*Task, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
 	ctx, span := c.tracer.Start(ctx, "ChronosClient.GetTask",
 		trace.WithAttributes(
 			attribute.String("task.id", taskID),
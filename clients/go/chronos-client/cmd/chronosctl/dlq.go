@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	chronosclient "github.com/nutcas3/chronos-monorepo/clients/go/chronos-client"
+	"github.com/spf13/cobra"
+)
+
+var dlqCmd = &cobra.Command{
+	Use:   "dlq",
+	Short: "Inspect and redrive the dead-letter queue",
+}
+
+var dlqListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List dead letters, oldest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source, _ := cmd.Flags().GetString("source")
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		entries, err := client.ListDeadLetters(cmd.Context(), source)
+		if err != nil {
+			return fmt.Errorf("listing dead letters: %w", err)
+		}
+		return printDeadLetters(entries)
+	},
+}
+
+var dlqRedriveCmd = &cobra.Command{
+	Use:   "redrive ID...",
+	Short: "Republish dead letters to their original topics",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		editFiles, _ := cmd.Flags().GetStringToString("edit")
+
+		edits := make(map[string][]byte, len(editFiles))
+		for id, path := range editFiles {
+			value, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("reading edit for dead letter %s: %w", id, err)
+			}
+			edits[id] = value
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		results, err := client.Redrive(cmd.Context(), args, edits)
+		if err != nil {
+			return fmt.Errorf("redriving dead letters: %w", err)
+		}
+
+		failed := 0
+		for _, result := range results {
+			if result.Err != nil {
+				failed++
+				fmt.Printf("Failed to redrive %s: %v\n", result.ID, result.Err)
+				continue
+			}
+			fmt.Printf("Redrove %s\n", result.ID)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d dead letters were not redriven", failed, len(results))
+		}
+		return nil
+	},
+}
+
+func init() {
+	dlqListCmd.Flags().String("source", "", "only list dead letters from this source, workflow or task")
+	dlqRedriveCmd.Flags().StringToString("edit", nil, "replace a dead letter's value with a file's contents, as ID=FILE (repeatable)")
+
+	dlqCmd.AddCommand(dlqListCmd, dlqRedriveCmd)
+}
+
+// printDeadLetters prints dead letters in the configured output format
+func printDeadLetters(entries []*chronosclient.DeadLetter) error {
+	if jsonOutput() {
+		return printJSON(entries)
+	}
+
+	rows := make([][]string, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, []string{e.ID, e.Source, e.Topic, strconv.Itoa(e.RedriveCount), formatTime(e.FailedAt), e.Error})
+	}
+	return printTable([]string{"ID", "SOURCE", "TOPIC", "REDRIVES", "FAILED", "ERROR"}, rows)
+}
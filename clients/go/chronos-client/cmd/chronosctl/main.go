@@ -0,0 +1,113 @@
+// Command chronosctl is a command-line interface to the Chronos platform
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	chronosclient "github.com/nutcas3/chronos-monorepo/clients/go/chronos-client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var configFile string
+
+var rootCmd = &cobra.Command{
+	Use:           "chronosctl",
+	Short:         "Manage Chronos workflows, schedules, and tasks",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		switch output := viper.GetString("output"); output {
+		case outputTable, outputJSON:
+			return nil
+		default:
+			return fmt.Errorf("unknown output format %q, expected %s or %s", output, outputTable, outputJSON)
+		}
+	},
+}
+
+func init() {
+	cobra.OnInitialize(initConfig)
+
+	defaults := chronosclient.DefaultClientOptions()
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&configFile, "config", "", "config file (default $HOME/.chronosctl.yaml)")
+	flags.String("scheduler-url", defaults.SchedulerURL, "scheduler service address")
+	flags.String("executor-url", defaults.ExecutorURL, "executor service address")
+	flags.String("durable-engine-url", defaults.DurableEngURL, "durable engine service address")
+	flags.String("worker-pool-url", defaults.WorkerPoolURL, "worker pool service address")
+	flags.String("observatory-url", defaults.ObservatoryURL, "observatory service address")
+	flags.String("tenant", "", "tenant ID sent with every request")
+	flags.String("token", "", "bearer token sent with every request")
+	flags.StringP("output", "o", outputTable, "output format: table or json")
+
+	// Flags can also be set through CHRONOS_* environment variables or the
+	// config file, e.g. CHRONOS_SCHEDULER_URL or scheduler-url
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name != "config" {
+			viper.BindPFlag(flag.Name, flag)
+		}
+	})
+	viper.SetEnvPrefix("chronos")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(workflowCmd, scheduleCmd, taskCmd, dlqCmd)
+}
+
+// initConfig reads the config file, if one exists
+func initConfig() {
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+		viper.AddConfigPath(home)
+		viper.SetConfigName(".chronosctl")
+		viper.SetConfigType("yaml")
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok || configFile != "" {
+			fmt.Fprintf(os.Stderr, "Error reading config file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// newClient connects to the Chronos services using the configured addresses
+func newClient() (*chronosclient.ChronosClient, error) {
+	opts := chronosclient.DefaultClientOptions()
+	opts.SchedulerURL = viper.GetString("scheduler-url")
+	opts.ExecutorURL = viper.GetString("executor-url")
+	opts.DurableEngURL = viper.GetString("durable-engine-url")
+	opts.WorkerPoolURL = viper.GetString("worker-pool-url")
+	opts.ObservatoryURL = viper.GetString("observatory-url")
+	opts.TenantID = viper.GetString("tenant")
+	opts.AuthToken = viper.GetString("token")
+	opts.TracerName = "chronosctl"
+
+	client, err := chronosclient.NewClient(opts)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+	return client, nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Supported values of the --output flag
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// jsonOutput reports whether results should be printed as JSON
+func jsonOutput() bool {
+	return viper.GetString("output") == outputJSON
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printTable writes rows to stdout as aligned columns under a header
+func printTable(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// formatLabels renders labels as a sorted key=value list
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// formatTime renders a timestamp for table output
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+// orDash renders empty table cells as a dash
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	chronosclient "github.com/nutcas3/chronos-monorepo/clients/go/chronos-client"
+	"github.com/spf13/cobra"
+)
+
+var scheduleCmd = &cobra.Command{
+	Use:     "schedule",
+	Aliases: []string{"schedules"},
+	Short:   "Register and manage workflow schedules",
+}
+
+var scheduleRegisterCmd = &cobra.Command{
+	Use:   "register",
+	Short: "Register a workflow to run on a schedule",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		schedule := &chronosclient.Schedule{}
+		schedule.ID, _ = flags.GetString("id")
+		schedule.WorkflowID, _ = flags.GetString("workflow")
+		schedule.CronExpr, _ = flags.GetString("cron")
+		schedule.Timezone, _ = flags.GetString("timezone")
+		schedule.BusinessDaysOnly, _ = flags.GetBool("business-days-only")
+		schedule.HolidayCalendar, _ = flags.GetString("holiday-calendar")
+		schedule.TriggerAfter, _ = flags.GetString("trigger-after")
+		schedule.TriggerDelay, _ = flags.GetDuration("trigger-delay")
+		schedule.OnUpstreamFailure, _ = flags.GetString("on-upstream-failure")
+		schedule.Labels, _ = flags.GetStringToString("label")
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		registered, err := client.RegisterSchedule(cmd.Context(), schedule)
+		if err != nil {
+			return fmt.Errorf("registering schedule: %w", err)
+		}
+		return printSchedules(registered)
+	},
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registered schedules",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selector, _ := cmd.Flags().GetString("selector")
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		schedules, err := client.ListSchedules(cmd.Context(), selector)
+		if err != nil {
+			return fmt.Errorf("listing schedules: %w", err)
+		}
+		return printSchedules(schedules...)
+	},
+}
+
+var scheduleRemoveCmd = &cobra.Command{
+	Use:     "remove ID",
+	Aliases: []string{"rm"},
+	Short:   "Remove a registered schedule",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := client.RemoveSchedule(cmd.Context(), args[0]); err != nil {
+			return fmt.Errorf("removing schedule %s: %w", args[0], err)
+		}
+		fmt.Printf("Removed schedule %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	flags := scheduleRegisterCmd.Flags()
+	flags.String("id", "", "schedule ID (generated when empty)")
+	flags.String("workflow", "", "ID of the workflow to run")
+	flags.String("cron", "", "cron expression, e.g. \"0 0 9 * * *\"")
+	flags.String("timezone", "", "timezone the cron expression is evaluated in (default UTC)")
+	flags.Bool("business-days-only", false, "skip fires on Saturdays and Sundays")
+	flags.String("holiday-calendar", "", "holiday calendar whose dates are skipped")
+	flags.String("trigger-after", "", "schedule whose workflow completion fires this one, in place of --cron")
+	flags.Duration("trigger-delay", 0, "delay after the upstream workflow finishes")
+	flags.String("on-upstream-failure", "", "skip or run when the upstream workflow fails (default skip)")
+	flags.StringToString("label", nil, "label to attach, as key=value (repeatable)")
+	scheduleRegisterCmd.MarkFlagRequired("workflow")
+
+	scheduleListCmd.Flags().StringP("selector", "l", "", "label selector, e.g. team=payments,env=prod")
+
+	scheduleCmd.AddCommand(scheduleRegisterCmd, scheduleListCmd, scheduleRemoveCmd)
+}
+
+// printSchedules prints schedules in the configured output format
+func printSchedules(schedules ...*chronosclient.Schedule) error {
+	if jsonOutput() {
+		if len(schedules) == 1 {
+			return printJSON(schedules[0])
+		}
+		return printJSON(schedules)
+	}
+
+	rows := make([][]string, 0, len(schedules))
+	for _, s := range schedules {
+		trigger := s.CronExpr
+		if s.TriggerAfter != "" {
+			trigger = "after " + s.TriggerAfter
+			if s.TriggerDelay > 0 {
+				trigger += " +" + s.TriggerDelay.String()
+			}
+		}
+		rows = append(rows, []string{
+			s.ID,
+			s.WorkflowID,
+			trigger,
+			orDash(s.Timezone),
+			orDash(strings.Join(s.Dependents, ",")),
+			formatLabels(s.Labels),
+		})
+	}
+	return printTable([]string{"ID", "WORKFLOW", "TRIGGER", "TIMEZONE", "DEPENDENTS", "LABELS"}, rows)
+}
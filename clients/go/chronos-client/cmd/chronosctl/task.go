@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	chronosclient "github.com/nutcas3/chronos-monorepo/clients/go/chronos-client"
+	"github.com/spf13/cobra"
+)
+
+var taskCmd = &cobra.Command{
+	Use:     "task",
+	Aliases: []string{"tasks"},
+	Short:   "Inspect tasks",
+}
+
+var taskGetCmd = &cobra.Command{
+	Use:   "get ID",
+	Short: "Show a task",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		task, err := client.GetTask(cmd.Context(), args[0])
+		if err != nil {
+			return fmt.Errorf("getting task %s: %w", args[0], err)
+		}
+		if jsonOutput() {
+			return printJSON(task)
+		}
+
+		return printTable(
+			[]string{"ID", "WORKFLOW", "NAME", "TYPE", "STATUS", "CREATED"},
+			[][]string{{task.ID, task.WorkflowID, task.Name, task.Type, task.Status, formatTime(task.CreatedAt)}},
+		)
+	},
+}
+
+var taskLogsCmd = &cobra.Command{
+	Use:   "logs ID",
+	Short: "Show a task's execution logs",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		follow, _ := cmd.Flags().GetBool("follow")
+		tail, _ := cmd.Flags().GetInt("tail")
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		opts := []chronosclient.LogOption{chronosclient.WithTail(tail)}
+		if follow {
+			opts = append(opts, chronosclient.WithFollow())
+		}
+		lines, err := client.StreamTaskLogs(cmd.Context(), args[0], opts...)
+		if err != nil {
+			return fmt.Errorf("streaming logs of task %s: %w", args[0], err)
+		}
+
+		for line := range lines {
+			if jsonOutput() {
+				if err := printJSON(line); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Printf("%s  %-8s %s\n", formatTime(line.Timestamp), line.Stream, line.Line)
+		}
+		return nil
+	},
+}
+
+func init() {
+	taskLogsCmd.Flags().BoolP("follow", "f", false, "keep streaming until the task finishes")
+	taskLogsCmd.Flags().Int("tail", 100, "number of recent lines to show first")
+
+	taskCmd.AddCommand(taskGetCmd)
+	taskCmd.AddCommand(taskLogsCmd)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	chronosclient "github.com/nutcas3/chronos-monorepo/clients/go/chronos-client"
+	"github.com/spf13/cobra"
+)
+
+var workflowCmd = &cobra.Command{
+	Use:     "workflow",
+	Aliases: []string{"workflows", "wf"},
+	Short:   "Create, inspect, and run workflows",
+}
+
+var workflowCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create a workflow",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		description, _ := cmd.Flags().GetString("description")
+		labels, _ := cmd.Flags().GetStringToString("label")
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		workflow, err := client.CreateWorkflow(cmd.Context(), args[0], description, chronosclient.WithLabels(labels))
+		if err != nil {
+			return fmt.Errorf("creating workflow: %w", err)
+		}
+		return printWorkflows(workflow)
+	},
+}
+
+var workflowGetCmd = &cobra.Command{
+	Use:   "get ID",
+	Short: "Show a workflow",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		watch, _ := cmd.Flags().GetBool("watch")
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		workflow, err := client.GetWorkflow(cmd.Context(), args[0])
+		if err != nil {
+			return fmt.Errorf("getting workflow %s: %w", args[0], err)
+		}
+		if err := printWorkflows(workflow); err != nil {
+			return err
+		}
+		if !watch {
+			return nil
+		}
+
+		events, err := client.WatchWorkflow(cmd.Context(), args[0])
+		if err != nil {
+			return fmt.Errorf("watching workflow %s: %w", args[0], err)
+		}
+		return printWorkflowEvents(events)
+	},
+}
+
+var workflowListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List workflows",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selector, _ := cmd.Flags().GetString("selector")
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		workflows, err := client.ListWorkflows(cmd.Context(), selector)
+		if err != nil {
+			return fmt.Errorf("listing workflows: %w", err)
+		}
+		return printWorkflows(workflows...)
+	},
+}
+
+var workflowStartCmd = &cobra.Command{
+	Use:   "start ID",
+	Short: "Start a workflow run",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := client.StartWorkflow(cmd.Context(), args[0]); err != nil {
+			return fmt.Errorf("starting workflow %s: %w", args[0], err)
+		}
+		fmt.Printf("Started workflow %s\n", args[0])
+		return nil
+	},
+}
+
+var workflowCancelCmd = &cobra.Command{
+	Use:   "cancel ID",
+	Short: "Cancel a running workflow",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := client.CancelWorkflow(cmd.Context(), args[0]); err != nil {
+			return fmt.Errorf("cancelling workflow %s: %w", args[0], err)
+		}
+		fmt.Printf("Cancelled workflow %s\n", args[0])
+		return nil
+	},
+}
+
+var workflowReplayCmd = &cobra.Command{
+	Use:   "replay RUN_ID",
+	Short: "Replay a finished workflow run as a new run",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fromTask, _ := cmd.Flags().GetString("from-task")
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		runID, err := client.ReplayWorkflow(cmd.Context(), args[0], fromTask)
+		if err != nil {
+			return fmt.Errorf("replaying run %s: %w", args[0], err)
+		}
+		fmt.Printf("Replaying run %s as run %s\n", args[0], runID)
+		return nil
+	},
+}
+
+func init() {
+	workflowCreateCmd.Flags().String("description", "", "workflow description")
+	workflowCreateCmd.Flags().StringToString("label", nil, "label to attach, as key=value (repeatable)")
+	workflowGetCmd.Flags().BoolP("watch", "w", false, "stream state changes until the workflow finishes")
+	workflowListCmd.Flags().StringP("selector", "l", "", "label selector, e.g. team=payments,env=prod")
+	workflowReplayCmd.Flags().String("from-task", "", "execute only this task and those downstream of it again")
+
+	workflowCmd.AddCommand(workflowCreateCmd, workflowGetCmd, workflowListCmd, workflowStartCmd, workflowCancelCmd, workflowReplayCmd)
+}
+
+// printWorkflows prints workflows in the configured output format
+func printWorkflows(workflows ...*chronosclient.Workflow) error {
+	if jsonOutput() {
+		if len(workflows) == 1 {
+			return printJSON(workflows[0])
+		}
+		return printJSON(workflows)
+	}
+
+	rows := make([][]string, 0, len(workflows))
+	for _, w := range workflows {
+		rows = append(rows, []string{
+			w.ID,
+			w.Name,
+			strconv.Itoa(len(w.Tasks)),
+			formatLabels(w.Labels),
+			formatTime(w.CreatedAt),
+		})
+	}
+	return printTable([]string{"ID", "NAME", "TASKS", "LABELS", "CREATED"}, rows)
+}
+
+// printWorkflowEvents prints events from a workflow watch as they arrive
+func printWorkflowEvents(events <-chan *chronosclient.WorkflowEvent) error {
+	for event := range events {
+		if jsonOutput() {
+			if err := printJSON(event); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("%s  %-10s %s %s\n", formatTime(event.Timestamp), event.State, orDash(event.TaskID), event.Message)
+	}
+	return nil
+}
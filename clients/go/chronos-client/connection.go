@@ -0,0 +1,18 @@
+package chronosclient
+
+import (
+	"google.golang.org/grpc/connectivity"
+)
+
+// ConnectionStates returns the connectivity state of the connection to each
+// service, keyed by service name. Once the client is closed, every
+// connection reports connectivity.Shutdown
+func (c *ChronosClient) ConnectionStates() map[string]connectivity.State {
+	return map[string]connectivity.State{
+		"scheduler":      c.schedulerConn.GetState(),
+		"executor":       c.executorConn.GetState(),
+		"durable-engine": c.durableEngConn.GetState(),
+		"worker-pool":    c.workerPoolConn.GetState(),
+		"observatory":    c.observatoryConn.GetState(),
+	}
+}
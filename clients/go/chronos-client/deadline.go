@@ -0,0 +1,61 @@
+package chronosclient
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultTimeout is the deadline given to unary calls made without one
+const DefaultTimeout = 30 * time.Second
+
+// deadlineMetadataKey is the gRPC metadata key carrying the call's absolute
+// deadline. gRPC only sends the remaining time, which a service can't carry
+// across asynchronous hops like Kafka
+const deadlineMetadataKey = "x-chronos-deadline"
+
+// callTimeout returns the timeout applied to unary calls without a
+// deadline, filling in the default. Zero disables it
+func (o *ClientOptions) callTimeout() time.Duration {
+	switch {
+	case o.DefaultCallTimeout < 0:
+		return 0
+	case o.DefaultCallTimeout == 0:
+		return DefaultTimeout
+	default:
+		return o.DefaultCallTimeout
+	}
+}
+
+// withCallDeadline gives ctx the default timeout when it has no deadline of
+// its own, and records the deadline in the outgoing metadata. A deadline the
+// caller set is never extended
+func withCallDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		ctx = metadata.AppendToOutgoingContext(ctx, deadlineMetadataKey, deadline.UTC().Format(time.RFC3339Nano))
+	}
+	return ctx, cancel
+}
+
+// deadlineUnaryInterceptor applies the default timeout to every unary call
+func deadlineUnaryInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := withCallDeadline(ctx, timeout)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// deadlineStreamInterceptor propagates the deadline of streaming calls.
+// Streams like WatchWorkflow run for as long as the caller wants, so they
+// get no default timeout
+func deadlineStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, _ = withCallDeadline(ctx, 0)
+	return streamer(ctx, desc, cc, method, opts...)
+}
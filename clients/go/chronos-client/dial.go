@@ -0,0 +1,85 @@
+package chronosclient
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// DefaultKeepaliveTime is the idle time before the client pings a connection
+	DefaultKeepaliveTime = 30 * time.Second
+	// DefaultKeepaliveTimeout is how long the client waits for a ping ack
+	DefaultKeepaliveTimeout = 10 * time.Second
+	// DefaultMinConnectTimeout is the minimum time given to a connection attempt
+	DefaultMinConnectTimeout = 20 * time.Second
+)
+
+// dialOptions builds the dial options shared by every service connection
+func (o *ClientOptions) dialOptions() []grpc.DialOption {
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(o.keepaliveParams()),
+		grpc.WithConnectParams(o.connectParams()),
+		// Failed calls surface as *Error so callers can branch with errors.Is
+		grpc.WithChainUnaryInterceptor(errorUnaryInterceptor),
+		grpc.WithChainStreamInterceptor(errorStreamInterceptor),
+		grpc.WithChainUnaryInterceptor(deadlineUnaryInterceptor(o.callTimeout())),
+		grpc.WithChainStreamInterceptor(deadlineStreamInterceptor),
+		// Trace context and baggage reach the services with every call
+		grpc.WithChainUnaryInterceptor(propagationUnaryInterceptor),
+		grpc.WithChainStreamInterceptor(propagationStreamInterceptor),
+	}
+	if o.TenantID != "" {
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(tenantUnaryInterceptor(o.TenantID)),
+			grpc.WithChainStreamInterceptor(tenantStreamInterceptor(o.TenantID)),
+		)
+	}
+	if o.AuthToken != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(bearerToken(o.AuthToken)))
+	}
+	return dialOpts
+}
+
+// keepaliveParams returns the keepalive settings, filling in defaults
+func (o *ClientOptions) keepaliveParams() keepalive.ClientParameters {
+	params := keepalive.ClientParameters{
+		Time:                o.KeepaliveTime,
+		Timeout:             o.KeepaliveTimeout,
+		PermitWithoutStream: o.KeepalivePermitWithoutStream,
+	}
+	if params.Time <= 0 {
+		params.Time = DefaultKeepaliveTime
+	}
+	if params.Timeout <= 0 {
+		params.Timeout = DefaultKeepaliveTimeout
+	}
+	return params
+}
+
+// connectParams returns the reconnection settings, filling in defaults
+func (o *ClientOptions) connectParams() grpc.ConnectParams {
+	cfg := o.ConnectBackoff
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = backoff.DefaultConfig.BaseDelay
+	}
+	if cfg.Multiplier <= 0 {
+		cfg.Multiplier = backoff.DefaultConfig.Multiplier
+	}
+	if cfg.Jitter <= 0 {
+		cfg.Jitter = backoff.DefaultConfig.Jitter
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = backoff.DefaultConfig.MaxDelay
+	}
+
+	minConnect := o.MinConnectTimeout
+	if minConnect <= 0 {
+		minConnect = DefaultMinConnectTimeout
+	}
+	return grpc.ConnectParams{Backoff: cfg, MinConnectTimeout: minConnect}
+}
@@ -0,0 +1,122 @@
+package chronosclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Errors returned by client methods, for use with errors.Is. They're mapped
+// from the gRPC status codes of failed calls:
+//
+//	codes.NotFound           ErrNotFound
+//	codes.Unauthenticated    ErrUnauthenticated
+//	codes.FailedPrecondition ErrWorkflowTerminal
+//	codes.Unavailable        ErrUnavailable
+//
+// Other codes map to no sentinel. Either way the error is an *Error, and
+// errors.Unwrap returns the underlying status error, so status.FromError and
+// status.Code still work on it
+var (
+	// ErrNotFound means the workflow, task, schedule, or run doesn't exist
+	ErrNotFound = errors.New("chronos: not found")
+	// ErrUnauthenticated means the auth token is missing, invalid, or expired
+	ErrUnauthenticated = errors.New("chronos: unauthenticated")
+	// ErrWorkflowTerminal means the workflow has already finished, so it
+	// can't be cancelled or changed
+	ErrWorkflowTerminal = errors.New("chronos: workflow is in a terminal state")
+	// ErrUnavailable means the service couldn't be reached; the call is
+	// safe to retry
+	ErrUnavailable = errors.New("chronos: service unavailable")
+)
+
+// ErrClientClosed is returned by every method called after Close, without
+// making a call
+var ErrClientClosed = errors.New("chronos: client is closed")
+
+// codeErrors maps gRPC status codes to the sentinel errors
+var codeErrors = map[codes.Code]error{
+	codes.NotFound:           ErrNotFound,
+	codes.Unauthenticated:    ErrUnauthenticated,
+	codes.FailedPrecondition: ErrWorkflowTerminal,
+	codes.Unavailable:        ErrUnavailable,
+}
+
+// Error is a failed call to a Chronos service
+type Error struct {
+	// Method is the full gRPC method called, e.g. /executor.ExecutorService/CancelWorkflow
+	Method string
+	// Code is the call's gRPC status code
+	Code codes.Code
+	// Message is the service's description of the failure
+	Message string
+
+	kind   error
+	status error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("chronos: %s failed with %s: %s", e.Method, e.Code, e.Message)
+}
+
+// Unwrap returns the underlying gRPC status error
+func (e *Error) Unwrap() error {
+	return e.status
+}
+
+// Is reports whether target is the sentinel error for the call's status code
+func (e *Error) Is(target error) bool {
+	return e.kind != nil && target == e.kind
+}
+
+// wrapStatusError converts an error carrying a gRPC status into an *Error.
+// Other errors, like io.EOF at the end of a stream, are returned unchanged
+func wrapStatusError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	s, ok := status.FromError(err)
+	if !ok || s.Code() == codes.OK {
+		return err
+	}
+	return &Error{
+		Method:  method,
+		Code:    s.Code(),
+		Message: s.Message(),
+		kind:    codeErrors[s.Code()],
+		status:  err,
+	}
+}
+
+// errorUnaryInterceptor converts the errors of every unary call
+func errorUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return wrapStatusError(method, invoker(ctx, method, req, reply, cc, opts...))
+}
+
+// errorStreamInterceptor converts the errors of every streaming call,
+// including those of the stream's sends and receives
+func errorStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, wrapStatusError(method, err)
+	}
+	return &errorClientStream{ClientStream: stream, method: method}, nil
+}
+
+// errorClientStream converts the errors of a stream's sends and receives
+type errorClientStream struct {
+	grpc.ClientStream
+	method string
+}
+
+func (s *errorClientStream) SendMsg(m interface{}) error {
+	return wrapStatusError(s.method, s.ClientStream.SendMsg(m))
+}
+
+func (s *errorClientStream) RecvMsg(m interface{}) error {
+	return wrapStatusError(s.method, s.ClientStream.RecvMsg(m))
+}
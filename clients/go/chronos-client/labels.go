@@ -0,0 +1,37 @@
+package chronosclient
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// parseLabelSelector parses a selector such as "team=payments,env=prod"
+// into the labels a resource must carry to match
+func parseLabelSelector(selector string) (map[string]string, error) {
+	required := make(map[string]string)
+	if strings.TrimSpace(selector) == "" {
+		return required, nil
+	}
+
+	for _, term := range strings.Split(selector, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(term), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label selector term %q, expected key=value", term)
+		}
+		required[key] = strings.TrimSpace(value)
+	}
+
+	return required, nil
+}
+
+// labelAttributes converts labels into span attributes for trace correlation
+func labelAttributes(labels map[string]string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for key, value := range labels {
+		attrs = append(attrs, attribute.String("label."+key, value))
+	}
+	return attrs
+}
@@ -0,0 +1,58 @@
+package chronosclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// ArtifactFetcher downloads an artifact from the object storage the worker
+// pool spills large task results to
+type ArtifactFetcher func(ctx context.Context, ref ArtifactRef) ([]byte, error)
+
+// TaskResult returns the result of the workflow's task named name. It
+// reports false when there's no such task or the task has no result, which
+// includes a spilled result GetWorkflow had no ArtifactFetcher to resolve
+func (w *Workflow) TaskResult(name string) ([]byte, bool) {
+	for _, task := range w.Tasks {
+		if task.Name == name && task.Result != nil {
+			return task.Result, true
+		}
+	}
+	return nil, false
+}
+
+// Results returns the results of the workflow's tasks by task name, such as
+// the outputs gathered by a fan-in task and its upstream tasks. Tasks
+// without a result are left out
+func (w *Workflow) Results() map[string][]byte {
+	results := make(map[string][]byte, len(w.Tasks))
+	for _, task := range w.Tasks {
+		if task.Result != nil {
+			results[task.Name] = task.Result
+		}
+	}
+	return results
+}
+
+// resolveResults replaces the spilled results of a workflow's tasks with
+// their contents. Without a fetcher they're left as ResultArtifact
+func (c *ChronosClient) resolveResults(ctx context.Context, workflow *Workflow) error {
+	if c.fetchArtifact == nil {
+		return nil
+	}
+	for _, task := range workflow.Tasks {
+		if task.Result != nil || task.ResultArtifact == nil {
+			continue
+		}
+		result, err := c.fetchArtifact(ctx, *task.ResultArtifact)
+		if err != nil {
+			return fmt.Errorf("fetching result of task %s from artifact %s: %w", task.Name, task.ResultArtifact.Key, err)
+		}
+		if int64(len(result)) != task.ResultArtifact.Size {
+			return fmt.Errorf("fetching result of task %s from artifact %s: got %d of %d bytes",
+				task.Name, task.ResultArtifact.Key, len(result), task.ResultArtifact.Size)
+		}
+		task.Result = result
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package chronosclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Schedule represents a workflow schedule in the Chronos system
+type Schedule struct {
+	ID         string
+	WorkflowID string
+	CronExpr   string
+	Timezone   string
+	// BusinessDaysOnly suppresses fires that land on Saturdays and Sundays
+	BusinessDaysOnly bool
+	// HolidayCalendar names a holiday calendar configured on the scheduler
+	// whose dates are skipped
+	HolidayCalendar string
+	// TriggerAfter references another schedule whose workflow completion
+	// fires this schedule, in place of CronExpr
+	TriggerAfter string
+	// TriggerDelay is how long after the upstream finishes this schedule fires
+	TriggerDelay time.Duration
+	// OnUpstreamFailure is either "skip" (the default) or "run"
+	OnUpstreamFailure string
+	// Dependents lists the schedules that trigger after this one
+	Dependents []string
+	Labels     map[string]string
+	CreatedAt  time.Time
+}
+
+// RegisterSchedule registers a workflow to run on a schedule
+func (c *ChronosClient) RegisterSchedule(ctx context.Context, schedule *Schedule) (*Schedule, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.RegisterSchedule",
+		trace.WithAttributes(
+			attribute.String("workflow.id", schedule.WorkflowID),
+			attribute.String("schedule.cron", schedule.CronExpr),
+			attribute.String("schedule.timezone", schedule.Timezone),
+			attribute.Bool("schedule.business_days_only", schedule.BusinessDaysOnly),
+			attribute.String("schedule.holiday_calendar", schedule.HolidayCalendar),
+			attribute.String("schedule.trigger_after", schedule.TriggerAfter),
+		),
+		trace.WithAttributes(labelAttributes(schedule.Labels)...))
+	defer span.End()
+
+	if schedule.WorkflowID == "" {
+		return nil, fmt.Errorf("workflow ID is required")
+	}
+	if schedule.CronExpr == "" && schedule.TriggerAfter == "" {
+		return nil, fmt.Errorf("either a cron expression or TriggerAfter is required")
+	}
+	if schedule.CronExpr != "" && schedule.TriggerAfter != "" {
+		return nil, fmt.Errorf("a schedule cannot set both a cron expression and TriggerAfter")
+	}
+
+	// In a real implementation, this would call the scheduler's RegisterSchedule method
+	// For now, we'll just return the schedule with a generated ID
+	registered := *schedule
+	if registered.ID == "" {
+		registered.ID = uuid.New().String()
+	}
+	registered.CreatedAt = time.Now()
+
+	return &registered, nil
+}
+
+// ListSchedules lists registered schedules matching a label selector,
+// including the dependency graph formed by TriggerAfter and Dependents
+func (c *ChronosClient) ListSchedules(ctx context.Context, selector string) ([]*Schedule, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.ListSchedules",
+		trace.WithAttributes(
+			attribute.String("schedule.label_selector", selector),
+		))
+	defer span.End()
+
+	if _, err := parseLabelSelector(selector); err != nil {
+		return nil, err
+	}
+
+	// In a real implementation, this would call the scheduler's ListSchedules method
+	// For now, we'll just return an empty list
+	return []*Schedule{}, nil
+}
+
+// RemoveSchedule removes a registered schedule
+func (c *ChronosClient) RemoveSchedule(ctx context.Context, scheduleID string) error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.RemoveSchedule",
+		trace.WithAttributes(
+			attribute.String("schedule.id", scheduleID),
+		))
+	defer span.End()
+
+	// In a real implementation, this would call the scheduler's RemoveSchedule method
+	return nil
+}
+
+// PreviewSchedule returns the next count fire times of a cron expression in
+// the given timezone, without registering a schedule
+func (c *ChronosClient) PreviewSchedule(ctx context.Context, cronExpr, timezone string, count int) ([]time.Time, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.PreviewSchedule",
+		trace.WithAttributes(
+			attribute.String("schedule.cron", cronExpr),
+			attribute.String("schedule.timezone", timezone),
+			attribute.Int("schedule.preview_count", count),
+		))
+	defer span.End()
+
+	if cronExpr == "" {
+		return nil, fmt.Errorf("cron expression is required")
+	}
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive, got %d", count)
+	}
+
+	// In a real implementation, this would call the scheduler's PreviewSchedule method
+	// For now, we'll just return an empty preview
+	return []time.Time{}, nil
+}
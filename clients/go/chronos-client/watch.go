@@ -0,0 +1,79 @@
+package chronosclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Workflow states reported by the executor
+const (
+	WorkflowStateRunning   = "RUNNING"
+	WorkflowStateCompleted = "COMPLETED"
+	WorkflowStateFailed    = "FAILED"
+	WorkflowStateCancelled = "CANCELLED"
+)
+
+// WorkflowEvent is a state change of a workflow run or one of its tasks
+type WorkflowEvent struct {
+	WorkflowID string
+	RunID      string
+	// TaskID is set when the event concerns a single task rather than the run
+	TaskID    string
+	State     string
+	Message   string
+	Timestamp time.Time
+}
+
+// Terminal reports whether the event ends the workflow run
+func (e *WorkflowEvent) Terminal() bool {
+	if e.TaskID != "" {
+		return false
+	}
+	switch e.State {
+	case WorkflowStateCompleted, WorkflowStateFailed, WorkflowStateCancelled:
+		return true
+	}
+	return false
+}
+
+// WatchWorkflow streams state changes of a workflow. The returned channel is
+// closed once the workflow reaches a terminal state or ctx is cancelled
+func (c *ChronosClient) WatchWorkflow(ctx context.Context, workflowID string) (<-chan *WorkflowEvent, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
+	ctx, span := c.tracer.Start(ctx, "ChronosClient.WatchWorkflow",
+		trace.WithAttributes(
+			attribute.String("workflow.id", workflowID),
+		))
+
+	if workflowID == "" {
+		span.End()
+		return nil, fmt.Errorf("workflow ID is required")
+	}
+
+	// In a real implementation, this would consume the executor's WatchWorkflow stream
+	// For now, we'll just report the workflow as completed
+	events := make(chan *WorkflowEvent)
+	go func() {
+		defer span.End()
+		defer close(events)
+
+		event := &WorkflowEvent{
+			WorkflowID: workflowID,
+			State:      WorkflowStateCompleted,
+			Timestamp:  time.Now(),
+		}
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}()
+
+	return events, nil
+}
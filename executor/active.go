@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// errTenantRequired is returned for requests that must name their tenant
+var errTenantRequired = errors.New("a tenant is required")
+
+// ActiveRun is the JSON form of an active run's state, as served to the
+// observatory
+type ActiveRun struct {
+	WorkflowID  string            `json:"workflow_id"`
+	RunID       string            `json:"run_id"`
+	TenantID    string            `json:"tenant_id"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	State       string            `json:"state"`
+	TaskStates  map[string]string `json:"task_states"`
+	SubmittedAt time.Time         `json:"submitted_at"`
+	StartedAt   time.Time         `json:"started_at"`
+}
+
+// ListActiveRuns returns the calling tenant's active runs. Listing every
+// tenant's runs at once isn't offered, so a tenant is required
+func (s *executorServer) ListActiveRuns(ctx context.Context) ([]*ActiveRun, error) {
+	tenant := tenantFromContext(ctx)
+	if tenant == "" {
+		return nil, errTenantRequired
+	}
+	runs, err := s.store.ListActive(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	active := make([]*ActiveRun, len(runs))
+	for i, run := range runs {
+		active[i] = &ActiveRun{
+			WorkflowID:  run.WorkflowID,
+			RunID:       run.RunID,
+			TenantID:    run.TenantID,
+			Name:        run.Name,
+			Labels:      run.Labels,
+			State:       run.State,
+			TaskStates:  run.TaskStates,
+			SubmittedAt: run.submittedAt(),
+			StartedAt:   run.StartedAt,
+		}
+	}
+	return active, nil
+}
+
+// handleListActiveRuns serves GET /workflows/active for the tenant named by
+// the X-Chronos-Tenant header or tenant query parameter
+func (s *executorServer) handleListActiveRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	runs, err := s.ListActiveRuns(withRequestTenant(r.Context(), r))
+	if errors.Is(err, errTenantRequired) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing active runs: %v", err)
+		http.Error(w, "listing active runs failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Baggage keys the executor acts on, set by clients with WithBaggage and
+// carried through the workflow's trace context
+const (
+	// baggagePriority is the priority of tasks that don't set their own
+	baggagePriority = "priority"
+	// baggageDebug set to "true" samples the trace regardless of the
+	// sampling ratio
+	baggageDebug = "debug"
+)
+
+// dispatchPriority returns the priority a task is dispatched with. A task
+// without a priority of its own takes the run's baggage priority, so a
+// caller can bump a run's tasks without changing the workflow
+func dispatchPriority(ctx context.Context, task TaskSpec) string {
+	if task.Priority != "" {
+		return task.Priority
+	}
+	switch priority := baggage.FromContext(ctx).Member(baggagePriority).Value(); priority {
+	case priorityHigh, priorityNormal, priorityLow:
+		return priority
+	}
+	return priorityNormal
+}
+
+// debugSampler samples traces by ratio, following the parent's decision,
+// except that traces with debug baggage are always sampled
+type debugSampler struct {
+	sdktrace.Sampler
+}
+
+func newDebugSampler(ratio float64) sdktrace.Sampler {
+	return debugSampler{Sampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))}
+}
+
+func (s debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if baggage.FromContext(p.ParentContext).Member(baggageDebug).Value() == "true" {
+		return sdktrace.AlwaysSample().ShouldSample(p)
+	}
+	return s.Sampler.ShouldSample(p)
+}
+
+func (s debugSampler) Description() string {
+	return "DebugSampler{" + s.Sampler.Description() + "}"
+}
+
+// metadataCarrier adapts incoming gRPC metadata for propagation
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// propagationUnaryInterceptor continues the caller's trace and baggage, sent
+// as gRPC metadata, in every unary call
+func propagationUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+	return handler(ctx, req)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+)
+
+// Circuit breaker states, also the values of the breaker state metric
+const (
+	breakerClosed   = 0
+	breakerHalfOpen = 1
+	breakerOpen     = 2
+)
+
+// Task result statuses reported on the results topic
+const (
+	taskResultCompleted = "COMPLETED"
+	taskResultFailed    = "FAILED"
+)
+
+// TaskResultMessage is the outcome of a task, published onto the results
+// topic by the worker that executed it
+type TaskResultMessage struct {
+	TaskID     string `json:"task_id"`
+	RunID      string `json:"run_id"`
+	WorkflowID string `json:"workflow_id,omitempty"`
+	TenantID   string `json:"tenant_id,omitempty"`
+	TaskType   string `json:"task_type"`
+	// Status is COMPLETED or FAILED
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// breakerConfig sets when circuit breakers open and how they recover
+type breakerConfig struct {
+	// window is the number of most recent results the failure rate is
+	// measured over
+	window int
+	// minResults is the fewest results in the window that can open the
+	// breaker, so a couple of early failures don't
+	minResults int
+	// failureRate is the fraction of failed results that opens the breaker
+	failureRate float64
+	// openFor is how long the breaker stays open before probing, and how
+	// long probes are given to report back
+	openFor time.Duration
+	// probes is the number of tasks let through while half-open
+	probes int
+}
+
+// circuitBreaker pauses dispatch of one task type while the worker pool is
+// failing most of its tasks. It opens when the failure rate over the recent
+// results crosses the threshold, and after a while half-opens to let a few
+// probe tasks through: a probe succeeding closes it, a probe failing opens it
+// again. Tasks are held in the breaker's delay queue while it's not closed
+type circuitBreaker struct {
+	taskType string
+	config   breakerConfig
+
+	mu    sync.Mutex
+	state int
+	// outcomes is a ring of the recent results in the closed state, true
+	// for a failure
+	outcomes []bool
+	next     int
+	failures int
+	// changedAt is when the breaker last opened or half-opened
+	changedAt time.Time
+	// probing is the number of probes let through since half-opening
+	probing int
+	// holding is set while this executor may have tasks in the breaker's
+	// delay queue, so new tasks queue behind them even once it's closed
+	holding bool
+}
+
+// breakers are the circuit breakers by task type label, nil when disabled
+var breakers map[string]*circuitBreaker
+
+// newCircuitBreakers creates a closed breaker for every task type label
+func newCircuitBreakers(config breakerConfig) map[string]*circuitBreaker {
+	byType := make(map[string]*circuitBreaker, len(knownTaskTypes)+1)
+	for taskType := range knownTaskTypes {
+		byType[taskType] = &circuitBreaker{taskType: taskType, config: config}
+	}
+	byType["other"] = &circuitBreaker{taskType: "other", config: config}
+	for _, breaker := range byType {
+		breakerState.WithLabelValues(breaker.taskType).Set(breakerClosed)
+	}
+	return byType
+}
+
+// initCircuitBreakers configures the breakers from the environment. A zero
+// failure rate disables them
+func initCircuitBreakers() (map[string]*circuitBreaker, error) {
+	config := breakerConfig{
+		window:      viper.GetInt("CIRCUIT_BREAKER_WINDOW"),
+		minResults:  viper.GetInt("CIRCUIT_BREAKER_MIN_RESULTS"),
+		failureRate: viper.GetFloat64("CIRCUIT_BREAKER_FAILURE_RATE"),
+		openFor:     viper.GetDuration("CIRCUIT_BREAKER_OPEN_DURATION"),
+		probes:      viper.GetInt("CIRCUIT_BREAKER_PROBES"),
+	}
+	if config.failureRate == 0 {
+		return nil, nil
+	}
+	switch {
+	case config.failureRate < 0 || config.failureRate > 1:
+		return nil, fmt.Errorf("circuit breaker failure rate must be between 0 and 1, got %v", config.failureRate)
+	case config.window < 1:
+		return nil, fmt.Errorf("circuit breaker window must be at least 1, got %d", config.window)
+	case config.minResults < 1 || config.minResults > config.window:
+		return nil, fmt.Errorf("circuit breaker minimum results must be between 1 and the window of %d, got %d", config.window, config.minResults)
+	case config.openFor <= 0:
+		return nil, fmt.Errorf("circuit breaker open duration must be positive, got %s", config.openFor)
+	case config.probes < 1:
+		return nil, fmt.Errorf("circuit breaker probes must be at least 1, got %d", config.probes)
+	}
+	return newCircuitBreakers(config), nil
+}
+
+// breakerFor returns the breaker of a task type, or nil when breakers are
+// disabled
+func breakerFor(taskType string) *circuitBreaker {
+	return breakers[taskTypeLabel(taskType)]
+}
+
+// bucket is the name of the breaker's delay queue in the state store
+func (b *circuitBreaker) bucket() string {
+	return "breaker:" + b.taskType
+}
+
+// setState moves the breaker to a state. The caller holds b.mu
+func (b *circuitBreaker) setState(state int, now time.Time) {
+	if b.state == state {
+		return
+	}
+	log.Printf("Circuit breaker for %s tasks moved from %s to %s", b.taskType, breakerStateName(b.state), breakerStateName(state))
+	b.state = state
+	b.changedAt = now
+	b.probing = 0
+	breakerState.WithLabelValues(b.taskType).Set(float64(state))
+	breakerTransitions.WithLabelValues(b.taskType, breakerStateName(state)).Inc()
+}
+
+// passes reports whether tasks go straight through: the breaker is closed
+// and none of its held tasks are waiting to be released
+func (b *circuitBreaker) passes() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerClosed && !b.holding
+}
+
+// setHolding records whether the breaker's delay queue may hold tasks
+func (b *circuitBreaker) setHolding(holding bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.holding = holding
+}
+
+// allow reports whether a task can be dispatched now, counting it as a
+// probe when the breaker is half-open
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.changedAt) < b.config.openFor {
+			return false
+		}
+		b.setState(breakerHalfOpen, now)
+	case breakerHalfOpen:
+		// Probes whose results never arrive are given up on, so a lost
+		// result can't leave the breaker half-open for good
+		if b.probing >= b.config.probes && now.Sub(b.changedAt) >= b.config.openFor {
+			b.probing = 0
+			b.changedAt = now
+		}
+	default:
+		return true
+	}
+
+	if b.probing >= b.config.probes {
+		return false
+	}
+	b.probing++
+	return true
+}
+
+// record feeds a task's result into the breaker. Results arriving while the
+// breaker is open are of tasks dispatched before it opened, so are ignored
+func (b *circuitBreaker) record(failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+	case breakerHalfOpen:
+		if failed {
+			b.setState(breakerOpen, now)
+			return
+		}
+		b.reset()
+		b.setState(breakerClosed, now)
+	default:
+		if b.outcomes == nil {
+			b.outcomes = make([]bool, 0, b.config.window)
+		}
+		if len(b.outcomes) < b.config.window {
+			b.outcomes = append(b.outcomes, failed)
+		} else {
+			if b.outcomes[b.next] {
+				b.failures--
+			}
+			b.outcomes[b.next] = failed
+			b.next = (b.next + 1) % b.config.window
+		}
+		if failed {
+			b.failures++
+		}
+
+		if len(b.outcomes) >= b.config.minResults &&
+			float64(b.failures)/float64(len(b.outcomes)) >= b.config.failureRate {
+			b.reset()
+			b.setState(breakerOpen, now)
+		}
+	}
+}
+
+// reset forgets the recent results. The caller holds b.mu
+func (b *circuitBreaker) reset() {
+	b.outcomes = b.outcomes[:0]
+	b.next = 0
+	b.failures = 0
+}
+
+// breakerStateName returns the name of a breaker state for logs and metrics
+func breakerStateName(state int) string {
+	switch state {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// holdTask reports whether a task was held back because its type's breaker
+// isn't letting tasks through. Tasks already held go first, so a task is
+// also held while its breaker's delay queue isn't empty. A closed breaker
+// with nothing held lets tasks through without asking the state store. Like
+// dispatch limits, breakers fail open when the state store is unreachable
+func holdTask(ctx context.Context, store StateStore, task *DelayedTask) bool {
+	breaker := breakerFor(task.TaskType)
+	if breaker == nil || breaker.passes() {
+		return false
+	}
+
+	waiting, err := store.CountDelayedTasks(ctx, breaker.bucket())
+	if err != nil {
+		log.Printf("Could not check the held tasks of %s, dispatching task %s: %v", breaker.bucket(), task.TaskID, err)
+		return false
+	}
+	if waiting == 0 && breaker.allow(time.Now()) {
+		return false
+	}
+
+	task.DelayedAt = time.Now()
+	if err := store.DelayTask(ctx, breaker.bucket(), task); err != nil {
+		log.Printf("Could not hold task %s behind the circuit breaker of %s, dispatching it: %v", task.TaskID, breaker.taskType, err)
+		return false
+	}
+	breaker.setHolding(true)
+	heldTasks.WithLabelValues(breaker.taskType).Set(float64(waiting + 1))
+	return true
+}
+
+// releaseHeldTasks dispatches tasks held by circuit breakers as the breakers
+// let them through, every interval until ctx is cancelled
+func releaseHeldTasks(ctx context.Context, writer *kafka.Writer, store StateStore, interval, claimTimeout time.Duration) {
+	if len(breakers) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, breaker := range breakers {
+			releaseBreakerTasks(ctx, writer, store, breaker, claimTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseBreakerTasks dispatches a breaker's held tasks, oldest first, for as
+// long as the breaker lets them through. Released tasks still go through
+// their dispatch limit
+func releaseBreakerTasks(ctx context.Context, writer *kafka.Writer, store StateStore, breaker *circuitBreaker, claimTimeout time.Duration) {
+	for {
+		waiting, err := store.CountDelayedTasks(ctx, breaker.bucket())
+		if err != nil {
+			log.Printf("Error checking the held tasks of %s: %v", breaker.bucket(), err)
+			return
+		}
+		heldTasks.WithLabelValues(breaker.taskType).Set(float64(waiting))
+		if waiting == 0 {
+			breaker.setHolding(false)
+			return
+		}
+		if !breaker.allow(time.Now()) {
+			return
+		}
+
+		task, err := store.ClaimDelayedTask(ctx, breaker.bucket(), claimTimeout)
+		if errors.Is(err, errNotFound) {
+			// Another executor released the last task
+			return
+		}
+		if err != nil {
+			log.Printf("Error taking a held task of %s: %v", breaker.bucket(), err)
+			return
+		}
+
+		if limit, ok := dispatchLimits[task.Bucket]; ok && !admitTask(ctx, store, limit, task) {
+			ackDelayedTask(ctx, store, breaker.bucket(), task)
+			continue
+		}
+		if !writeDelayedTask(ctx, writer, store, breaker.bucket(), task) {
+			return
+		}
+	}
+}
+
+// initResultsReader creates the reader of the results topic. Every executor
+// keeps its own breakers, so each reads every result under its own group
+func initResultsReader() (*kafka.Reader, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("getting hostname for the results consumer group: %w", err)
+	}
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     []string{viper.GetString("KAFKA_BROKERS")},
+		GroupID:     "chronos-executor-results-" + hostname,
+		Topic:       viper.GetString("KAFKA_TOPIC_RESULTS"),
+		Dialer:      kafkaDialer,
+		StartOffset: kafka.LastOffset,
+	}), nil
+}
+
+// consumeTaskResults feeds task results into the circuit breakers until ctx
+// is cancelled. Results only steer dispatch, so a result that can't be read
+// is skipped rather than retried
+func consumeTaskResults(ctx context.Context, reader *kafka.Reader) {
+	if len(breakers) == 0 {
+		return
+	}
+	log.Println("Starting Kafka consumer for task results")
+
+	for {
+		message, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Println("Stopping task results consumer")
+				return
+			}
+			log.Printf("Error reading task result: %v", err)
+			continue
+		}
+
+		var result TaskResultMessage
+		if err := json.Unmarshal(message.Value, &result); err != nil {
+			log.Printf("Skipping malformed task result at offset %d: %v", message.Offset, err)
+			continue
+		}
+		switch result.Status {
+		case taskResultCompleted, taskResultFailed:
+			breakerFor(result.TaskType).record(result.Status == taskResultFailed, time.Now())
+		default:
+			log.Printf("Skipping result of task %s with unknown status %q", result.TaskID, result.Status)
+		}
+	}
+}
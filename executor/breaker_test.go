@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testBreaker() *circuitBreaker {
+	return &circuitBreaker{taskType: "http", config: breakerConfig{
+		window:      4,
+		minResults:  2,
+		failureRate: 0.5,
+		openFor:     time.Minute,
+		probes:      1,
+	}}
+}
+
+func TestBreakerOpensAtFailureRate(t *testing.T) {
+	b := testBreaker()
+	now := time.Now()
+
+	b.record(false, now)
+	b.record(false, now)
+	b.record(true, now)
+	if b.state != breakerClosed {
+		t.Fatalf("state after 1 of 3 failed = %s, want closed", breakerStateName(b.state))
+	}
+	b.record(true, now)
+	if b.state != breakerOpen {
+		t.Fatalf("state after 2 of 4 failed = %s, want open", breakerStateName(b.state))
+	}
+	if b.allow(now.Add(time.Second)) {
+		t.Error("open breaker let a task through")
+	}
+}
+
+func TestBreakerNeedsMinimumResults(t *testing.T) {
+	b := testBreaker()
+	b.record(true, time.Now())
+	if b.state != breakerClosed {
+		t.Errorf("state after a single failure = %s, want closed below the minimum results", breakerStateName(b.state))
+	}
+}
+
+func TestBreakerWindowForgetsOldResults(t *testing.T) {
+	b := testBreaker()
+	now := time.Now()
+
+	// A failure slides out of the window of 4 after four more results
+	for _, failed := range []bool{false, false, false, true, false, false, false, false} {
+		b.record(failed, now)
+	}
+	if b.failures != 0 {
+		t.Errorf("failures in window = %d, want 0 once the failure slid out", b.failures)
+	}
+	b.record(true, now)
+	if b.state != breakerClosed {
+		t.Errorf("state after 1 of 4 failed = %s, want closed", breakerStateName(b.state))
+	}
+}
+
+func TestBreakerHalfOpensAndRecovers(t *testing.T) {
+	b := testBreaker()
+	now := time.Now()
+	b.record(true, now)
+	b.record(true, now)
+
+	later := now.Add(time.Minute)
+	if !b.allow(later) {
+		t.Fatal("breaker did not let a probe through once its open duration passed")
+	}
+	if b.state != breakerHalfOpen {
+		t.Fatalf("state after the open duration = %s, want half_open", breakerStateName(b.state))
+	}
+	if b.allow(later) {
+		t.Error("half-open breaker let more tasks through than its probes")
+	}
+
+	b.record(false, later)
+	if b.state != breakerClosed {
+		t.Fatalf("state after a successful probe = %s, want closed", breakerStateName(b.state))
+	}
+	if !b.allow(later) {
+		t.Error("closed breaker held a task")
+	}
+}
+
+func TestBreakerReopensOnFailedProbe(t *testing.T) {
+	b := testBreaker()
+	now := time.Now()
+	b.record(true, now)
+	b.record(true, now)
+
+	later := now.Add(time.Minute)
+	b.allow(later)
+	b.record(true, later)
+	if b.state != breakerOpen {
+		t.Fatalf("state after a failed probe = %s, want open", breakerStateName(b.state))
+	}
+	if b.allow(later.Add(time.Second)) {
+		t.Error("reopened breaker let a task through before its open duration passed")
+	}
+}
+
+func TestBreakerIgnoresResultsWhileOpen(t *testing.T) {
+	b := testBreaker()
+	now := time.Now()
+	b.record(true, now)
+	b.record(true, now)
+
+	b.record(false, now)
+	if b.state != breakerOpen {
+		t.Errorf("state after a late success = %s, want open", breakerStateName(b.state))
+	}
+}
+
+func TestBreakerGivesUpOnLostProbes(t *testing.T) {
+	b := testBreaker()
+	now := time.Now()
+	b.record(true, now)
+	b.record(true, now)
+
+	b.allow(now.Add(time.Minute))
+	if !b.allow(now.Add(2 * time.Minute)) {
+		t.Error("half-open breaker never let a new probe through after the first was lost")
+	}
+}
+
+// breakerStore counts the state store calls holdTask makes
+type breakerStore struct {
+	StateStore
+	counts  int
+	delayed []*DelayedTask
+}
+
+func (s *breakerStore) CountDelayedTasks(ctx context.Context, bucket string) (int64, error) {
+	s.counts++
+	return int64(len(s.delayed)), nil
+}
+
+func (s *breakerStore) DelayTask(ctx context.Context, bucket string, task *DelayedTask) error {
+	s.delayed = append(s.delayed, task)
+	return nil
+}
+
+func withBreakers(t *testing.T, byType map[string]*circuitBreaker) {
+	previous := breakers
+	breakers = byType
+	t.Cleanup(func() { breakers = previous })
+}
+
+func TestHoldTaskSkipsStoreWhileClosed(t *testing.T) {
+	b := testBreaker()
+	withBreakers(t, map[string]*circuitBreaker{"http": b})
+	store := &breakerStore{}
+
+	if holdTask(context.Background(), store, &DelayedTask{TaskID: "a", TaskType: "http"}) {
+		t.Error("closed breaker held a task")
+	}
+	if store.counts != 0 {
+		t.Errorf("closed breaker made %d state store calls, want 0", store.counts)
+	}
+}
+
+func TestHoldTaskHoldsWhileOpen(t *testing.T) {
+	b := testBreaker()
+	withBreakers(t, map[string]*circuitBreaker{"http": b})
+	store := &breakerStore{}
+	now := time.Now()
+	b.record(true, now)
+	b.record(true, now)
+
+	if !holdTask(context.Background(), store, &DelayedTask{TaskID: "a", TaskType: "http"}) {
+		t.Fatal("open breaker let a task through")
+	}
+	if len(store.delayed) != 1 {
+		t.Fatalf("held tasks = %d, want 1", len(store.delayed))
+	}
+
+	// Once closed, new tasks still queue behind the held one until it's released
+	b.mu.Lock()
+	b.setState(breakerClosed, now)
+	b.mu.Unlock()
+	if !holdTask(context.Background(), store, &DelayedTask{TaskID: "b", TaskType: "http"}) {
+		t.Error("task jumped ahead of a held task")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// runRetention returns how long a run that finished in state is kept.
+// Failed runs are usually kept longer, for investigating them
+func runRetention(state string) time.Duration {
+	if state == runStateCompleted {
+		return viper.GetDuration("WORKFLOW_RETENTION_SUCCEEDED")
+	}
+	return viper.GetDuration("WORKFLOW_RETENTION_FAILED")
+}
+
+// retainFinishedRun schedules the cleanup of a run that finished in state.
+// A replay reads the state of the run it replays, so that run is kept at
+// least as long as its replay
+func retainFinishedRun(ctx context.Context, store StateStore, run *RunState, state string) error {
+	until := time.Now().Add(runRetention(state))
+	if err := store.RetainRun(ctx, run.TenantID, run.RunID, until); err != nil {
+		return err
+	}
+	if run.ReplayOf != "" {
+		return store.RetainRun(ctx, run.TenantID, run.ReplayOf, until)
+	}
+	return nil
+}
+
+// cleanExpiredRuns deletes finished runs whose retention has passed, every
+// interval until ctx is cancelled
+func cleanExpiredRuns(ctx context.Context, store StateStore, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cleanExpiredBatch(ctx, store, batchSize)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanExpiredBatch deletes expired runs a batch at a time until none are
+// left: their progress, task states, and history, and the definitions kept
+// for replaying them. A run that fails to be deleted is retried on the next
+// pass
+func cleanExpiredBatch(ctx context.Context, store StateStore, batchSize int) {
+	for {
+		runs, err := store.PopExpiredRuns(ctx, batchSize)
+		if err != nil {
+			log.Printf("Error finding expired runs: %v", err)
+			return
+		}
+
+		for _, run := range runs {
+			deleted, err := store.DeleteRun(ctx, run.TenantID, run.RunID)
+			if err == nil && deleted {
+				err = store.Delete(ctx, definitionKey(run.TenantID, run.RunID))
+			}
+			if err != nil {
+				log.Printf("Error cleaning up run %s of tenant %s: %v", run.RunID, run.TenantID, err)
+				if err := store.RetainRun(ctx, run.TenantID, run.RunID, time.Now()); err != nil {
+					log.Printf("Error rescheduling cleanup of run %s: %v", run.RunID, err)
+				}
+				continue
+			}
+			if deleted {
+				cleanedWorkflows.Inc()
+			}
+		}
+
+		if len(runs) < batchSize {
+			return
+		}
+	}
+}
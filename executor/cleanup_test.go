@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFinishedRunsAreCleanedAfterRetention(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	kafkaBroker := newFakeKafka()
+	writer := kafkaBroker.writer("chronos-tasks")
+	ctx := context.Background()
+	setConfig(t, "WORKFLOW_RETENTION_SUCCEEDED", time.Hour)
+	setConfig(t, "WORKFLOW_RETENTION_FAILED", 24*time.Hour)
+	cleanedBefore := testutil.ToFloat64(cleanedWorkflows)
+
+	succeeded := diamondWorkflow("acme", "run-ok")
+	startRun(t, writer, store, succeeded)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := advanceRun(ctx, writer, store, completed(succeeded, id)); err != nil {
+			t.Fatalf("advanceRun(%s): %v", id, err)
+		}
+	}
+	failedRun := diamondWorkflow("acme", "run-failed")
+	startRun(t, writer, store, failedRun)
+	failed := completed(failedRun, "a")
+	failed.Status = taskResultFailed
+	if err := advanceRun(ctx, writer, store, failed); err != nil {
+		t.Fatalf("advanceRun: %v", err)
+	}
+	running := diamondWorkflow("acme", "run-running")
+	startRun(t, writer, store, running)
+
+	// Nothing has expired yet
+	cleanExpiredBatch(ctx, store, 10)
+	if _, err := store.GetRun(ctx, "acme", "run-ok"); err != nil {
+		t.Fatalf("completed run cleaned before its retention: %v", err)
+	}
+
+	// Past the succeeded retention, only the completed run goes
+	server.SetTime(time.Now().Add(2 * time.Hour))
+	cleanExpiredBatch(ctx, store, 10)
+	if _, err := store.GetRun(ctx, "acme", "run-ok"); !errors.Is(err, errNotFound) {
+		t.Errorf("GetRun(completed run) error = %v, want it cleaned", err)
+	}
+	if _, err := loadWorkflowDefinition(ctx, store, "acme", "run-ok"); !errors.Is(err, errNotFound) {
+		t.Errorf("definition of the completed run error = %v, want it cleaned", err)
+	}
+	if _, err := store.GetRun(ctx, "acme", "run-failed"); err != nil {
+		t.Errorf("failed run cleaned within its longer retention: %v", err)
+	}
+	if got := testutil.ToFloat64(cleanedWorkflows) - cleanedBefore; got != 1 {
+		t.Errorf("cleaned workflows = %v, want 1", got)
+	}
+
+	// Past the failed retention too; the running run is never cleaned
+	server.SetTime(time.Now().Add(48 * time.Hour))
+	cleanExpiredBatch(ctx, store, 10)
+	if _, err := store.GetRun(ctx, "acme", "run-failed"); !errors.Is(err, errNotFound) {
+		t.Errorf("GetRun(failed run) error = %v, want it cleaned", err)
+	}
+	if run, err := store.GetRun(ctx, "acme", "run-running"); err != nil || run.State != runStateRunning {
+		t.Errorf("running run = %v, %v, want it kept", run, err)
+	}
+}
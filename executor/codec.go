@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+)
+
+// codecHeader is the Kafka header naming the codec a message was encoded
+// with. Messages without it are JSON, which predates the header
+const codecHeader = "chronos-codec"
+
+// messageCodec encodes the workflow and task messages the executor reads and
+// writes. The topic is passed so codecs backed by a schema registry can
+// register schemas under the topic's subject
+type messageCodec interface {
+	// Name is the MESSAGE_CODEC value and codecHeader value for the codec
+	Name() string
+	EncodeWorkflow(ctx context.Context, topic string, workflow *WorkflowMessage) ([]byte, error)
+	DecodeWorkflow(ctx context.Context, data []byte) (*WorkflowMessage, error)
+	EncodeTask(ctx context.Context, topic string, task *TaskMessage) ([]byte, error)
+}
+
+// codecSet holds the codec used for outgoing messages and every codec
+// incoming messages may be decoded with
+type codecSet struct {
+	encoder messageCodec
+	byName  map[string]messageCodec
+}
+
+// codecs is replaced by initCodecs at startup; until then only JSON is known
+var codecs = newCodecSet(jsonCodec{})
+
+func newCodecSet(encoder messageCodec, others ...messageCodec) *codecSet {
+	set := &codecSet{encoder: encoder, byName: map[string]messageCodec{encoder.Name(): encoder}}
+	for _, codec := range others {
+		set.byName[codec.Name()] = codec
+	}
+	return set
+}
+
+// initCodecs builds the codecs from MESSAGE_CODEC. Avro and Protobuf need a
+// schema registry, so they are only available when SCHEMA_REGISTRY_URL is set
+func initCodecs() (*codecSet, error) {
+	available := []messageCodec{jsonCodec{}}
+	if url := viper.GetString("SCHEMA_REGISTRY_URL"); url != "" {
+		registry := newSchemaRegistry(url, viper.GetDuration("SCHEMA_REGISTRY_TIMEOUT"))
+		avro, err := newAvroCodec(registry)
+		if err != nil {
+			return nil, err
+		}
+		available = append(available, avro, newProtobufCodec(registry))
+	}
+
+	name := viper.GetString("MESSAGE_CODEC")
+	for i, codec := range available {
+		if codec.Name() == name {
+			others := append(available[:i:i], available[i+1:]...)
+			return newCodecSet(codec, others...), nil
+		}
+	}
+	switch name {
+	case codecAvro, codecProtobuf:
+		return nil, fmt.Errorf("message codec %s requires SCHEMA_REGISTRY_URL", name)
+	}
+	return nil, fmt.Errorf("unknown message codec %q, expected json, avro, or protobuf", name)
+}
+
+// forMessage returns the codec a message was encoded with
+func (s *codecSet) forMessage(message kafka.Message) (messageCodec, error) {
+	name := codecJSON
+	for _, h := range message.Headers {
+		if h.Key == codecHeader {
+			name = string(h.Value)
+			break
+		}
+	}
+	codec, ok := s.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("no decoder for message codec %q", name)
+	}
+	return codec, nil
+}
+
+// header returns the header advertising the outgoing codec
+func (s *codecSet) header() kafka.Header {
+	return kafka.Header{Key: codecHeader, Value: []byte(s.encoder.Name())}
+}
+
+// Codec names accepted by MESSAGE_CODEC
+const (
+	codecJSON     = "json"
+	codecAvro     = "avro"
+	codecProtobuf = "protobuf"
+)
+
+// jsonCodec is the default codec
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return codecJSON }
+
+func (jsonCodec) EncodeWorkflow(_ context.Context, _ string, workflow *WorkflowMessage) ([]byte, error) {
+	return json.Marshal(workflow)
+}
+
+func (jsonCodec) DecodeWorkflow(_ context.Context, data []byte) (*WorkflowMessage, error) {
+	var workflow WorkflowMessage
+	if err := json.Unmarshal(data, &workflow); err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+func (jsonCodec) EncodeTask(_ context.Context, _ string, task *TaskMessage) ([]byte, error) {
+	return json.Marshal(task)
+}
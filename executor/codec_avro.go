@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+)
+
+// Avro schemas for the executor's messages, mirroring the JSON field names
+const (
+	taskSpecAvroSchema = `{
+  "type": "record", "name": "TaskSpec", "namespace": "chronos.executor",
+  "fields": [
+    {"name": "id", "type": "string"},
+    {"name": "name", "type": "string", "default": ""},
+    {"name": "type", "type": "string"},
+    {"name": "parameters", "type": {"type": "map", "values": "string"}, "default": {}},
+    {"name": "timeout_seconds", "type": "int", "default": 0},
+    {"name": "max_retries", "type": "int", "default": 0},
+    {"name": "depends_on", "type": {"type": "array", "items": "string"}, "default": []},
+    {"name": "priority", "type": "string", "default": ""},
+    {"name": "delay_seconds", "type": "int", "default": 0}
+  ]
+}`
+
+	workflowAvroSchema = `{
+  "type": "record", "name": "WorkflowMessage", "namespace": "chronos.executor",
+  "fields": [
+    {"name": "workflow_id", "type": "string"},
+    {"name": "run_id", "type": "string"},
+    {"name": "tenant_id", "type": "string", "default": ""},
+    {"name": "schedule_id", "type": "string", "default": ""},
+    {"name": "name", "type": "string", "default": ""},
+    {"name": "labels", "type": {"type": "map", "values": "string"}, "default": {}},
+    {"name": "parameters", "type": {"type": "map", "values": "string"}, "default": {}},
+    {"name": "tasks", "type": {"type": "array", "items": ` + taskSpecAvroSchema + `}},
+    {"name": "replay_of", "type": "string", "default": ""},
+    {"name": "resumed_tasks", "type": {"type": "array", "items": "string"}, "default": []}
+  ]
+}`
+
+	taskAvroSchema = `{
+  "type": "record", "name": "TaskMessage", "namespace": "chronos.executor",
+  "fields": [
+    {"name": "task_id", "type": "string"},
+    {"name": "workflow_id", "type": "string"},
+    {"name": "run_id", "type": "string"},
+    {"name": "tenant_id", "type": "string"},
+    {"name": "name", "type": "string", "default": ""},
+    {"name": "type", "type": "string"},
+    {"name": "parameters", "type": {"type": "map", "values": "string"}, "default": {}},
+    {"name": "timeout_seconds", "type": "int", "default": 0},
+    {"name": "max_retries", "type": "int", "default": 0},
+    {"name": "priority", "type": "string"},
+    {"name": "replay_of", "type": "string", "default": ""}
+  ]
+}`
+)
+
+// avroCodec encodes messages as Avro in the schema registry wire format.
+// Messages are decoded with the schema they were written with
+type avroCodec struct {
+	registry       *schemaRegistry
+	workflowSchema avro.Schema
+	taskSchema     avro.Schema
+
+	mu      sync.Mutex
+	writers map[int]avro.Schema
+}
+
+func newAvroCodec(registry *schemaRegistry) (*avroCodec, error) {
+	workflowSchema, err := avro.Parse(workflowAvroSchema)
+	if err != nil {
+		return nil, fmt.Errorf("parsing workflow Avro schema: %w", err)
+	}
+	taskSchema, err := avro.Parse(taskAvroSchema)
+	if err != nil {
+		return nil, fmt.Errorf("parsing task Avro schema: %w", err)
+	}
+	return &avroCodec{
+		registry:       registry,
+		workflowSchema: workflowSchema,
+		taskSchema:     taskSchema,
+		writers:        make(map[int]avro.Schema),
+	}, nil
+}
+
+func (c *avroCodec) Name() string { return codecAvro }
+
+func (c *avroCodec) EncodeWorkflow(ctx context.Context, topic string, workflow *WorkflowMessage) ([]byte, error) {
+	return c.encode(ctx, topic, workflowAvroSchema, c.workflowSchema, workflow)
+}
+
+func (c *avroCodec) DecodeWorkflow(ctx context.Context, data []byte) (*WorkflowMessage, error) {
+	id, payload, err := unframe(data, false)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := c.writerSchema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var workflow WorkflowMessage
+	if err := avro.Unmarshal(schema, payload, &workflow); err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+func (c *avroCodec) EncodeTask(ctx context.Context, topic string, task *TaskMessage) ([]byte, error) {
+	return c.encode(ctx, topic, taskAvroSchema, c.taskSchema, task)
+}
+
+func (c *avroCodec) encode(ctx context.Context, topic, schemaText string, schema avro.Schema, v interface{}) ([]byte, error) {
+	id, err := c.registry.register(ctx, topic+"-value", "AVRO", schemaText)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := avro.Marshal(schema, v)
+	if err != nil {
+		return nil, err
+	}
+	return frame(id, false, payload), nil
+}
+
+// writerSchema returns the parsed schema registered under id
+func (c *avroCodec) writerSchema(ctx context.Context, id int) (avro.Schema, error) {
+	c.mu.Lock()
+	schema, ok := c.writers[id]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	text, err := c.registry.schemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	schema, err = avro.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Avro schema %d: %w", id, err)
+	}
+
+	c.mu.Lock()
+	c.writers[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
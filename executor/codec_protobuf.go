@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf schemas registered for the executor's messages. They match the
+// WorkflowMessage, TaskSpec, and TaskMessage definitions in
+// proto/executor.proto; the registered message is always the first one
+const (
+	taskSpecProtoSchema = `message TaskSpec {
+  string id = 1;
+  string name = 2;
+  string type = 3;
+  map<string, string> parameters = 4;
+  int32 timeout_seconds = 5;
+  int32 max_retries = 6;
+  repeated string depends_on = 7;
+  string priority = 8;
+  int32 delay_seconds = 9;
+}
+`
+
+	workflowProtoSchema = `syntax = "proto3";
+package chronos.executor;
+
+message WorkflowMessage {
+  string workflow_id = 1;
+  string run_id = 2;
+  string tenant_id = 3;
+  string schedule_id = 4;
+  string name = 5;
+  map<string, string> labels = 6;
+  map<string, string> parameters = 7;
+  repeated TaskSpec tasks = 8;
+  string replay_of = 9;
+  repeated string resumed_tasks = 10;
+}
+
+` + taskSpecProtoSchema
+
+	taskProtoSchema = `syntax = "proto3";
+package chronos.executor;
+
+message TaskMessage {
+  string task_id = 1;
+  string workflow_id = 2;
+  string run_id = 3;
+  string tenant_id = 4;
+  string name = 5;
+  string type = 6;
+  map<string, string> parameters = 7;
+  int32 timeout_seconds = 8;
+  int32 max_retries = 9;
+  string priority = 10;
+  string replay_of = 11;
+}
+`
+)
+
+// protobufCodec encodes messages as Protobuf in the schema registry wire
+// format. There is no generated code for these messages, so they are
+// encoded field by field
+type protobufCodec struct {
+	registry *schemaRegistry
+}
+
+func newProtobufCodec(registry *schemaRegistry) *protobufCodec {
+	return &protobufCodec{registry: registry}
+}
+
+func (c *protobufCodec) Name() string { return codecProtobuf }
+
+func (c *protobufCodec) EncodeWorkflow(ctx context.Context, topic string, workflow *WorkflowMessage) ([]byte, error) {
+	id, err := c.registry.register(ctx, topic+"-value", "PROTOBUF", workflowProtoSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = appendProtoString(b, 1, workflow.WorkflowID)
+	b = appendProtoString(b, 2, workflow.RunID)
+	b = appendProtoString(b, 3, workflow.TenantID)
+	b = appendProtoString(b, 4, workflow.ScheduleID)
+	b = appendProtoString(b, 5, workflow.Name)
+	b = appendProtoMap(b, 6, workflow.Labels)
+	b = appendProtoMap(b, 7, workflow.Parameters)
+	for i := range workflow.Tasks {
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalTaskSpec(&workflow.Tasks[i]))
+	}
+	b = appendProtoString(b, 9, workflow.ReplayOf)
+	for _, id := range workflow.ResumedTasks {
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		b = protowire.AppendString(b, id)
+	}
+	return frame(id, true, b), nil
+}
+
+func (c *protobufCodec) DecodeWorkflow(_ context.Context, data []byte) (*WorkflowMessage, error) {
+	_, payload, err := unframe(data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var workflow WorkflowMessage
+	err = consumeProtoFields(payload, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeProtoString(b, &workflow.WorkflowID)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeProtoString(b, &workflow.RunID)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeProtoString(b, &workflow.TenantID)
+		case num == 4 && typ == protowire.BytesType:
+			return consumeProtoString(b, &workflow.ScheduleID)
+		case num == 5 && typ == protowire.BytesType:
+			return consumeProtoString(b, &workflow.Name)
+		case num == 6 && typ == protowire.BytesType:
+			return consumeProtoMapEntry(b, &workflow.Labels)
+		case num == 7 && typ == protowire.BytesType:
+			return consumeProtoMapEntry(b, &workflow.Parameters)
+		case num == 8 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, protowire.ParseError(n)
+			}
+			task, err := unmarshalTaskSpec(v)
+			if err != nil {
+				return 0, err
+			}
+			workflow.Tasks = append(workflow.Tasks, *task)
+			return n, nil
+		case num == 9 && typ == protowire.BytesType:
+			return consumeProtoString(b, &workflow.ReplayOf)
+		case num == 10 && typ == protowire.BytesType:
+			var id string
+			n, err := consumeProtoString(b, &id)
+			workflow.ResumedTasks = append(workflow.ResumedTasks, id)
+			return n, err
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decoding workflow: %w", err)
+	}
+	return &workflow, nil
+}
+
+func (c *protobufCodec) EncodeTask(ctx context.Context, topic string, task *TaskMessage) ([]byte, error) {
+	id, err := c.registry.register(ctx, topic+"-value", "PROTOBUF", taskProtoSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = appendProtoString(b, 1, task.TaskID)
+	b = appendProtoString(b, 2, task.WorkflowID)
+	b = appendProtoString(b, 3, task.RunID)
+	b = appendProtoString(b, 4, task.TenantID)
+	b = appendProtoString(b, 5, task.Name)
+	b = appendProtoString(b, 6, task.Type)
+	b = appendProtoMap(b, 7, task.Parameters)
+	b = appendProtoInt32(b, 8, task.TimeoutSeconds)
+	b = appendProtoInt32(b, 9, task.MaxRetries)
+	b = appendProtoString(b, 10, task.Priority)
+	b = appendProtoString(b, 11, task.ReplayOf)
+	return frame(id, true, b), nil
+}
+
+func marshalTaskSpec(task *TaskSpec) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, task.ID)
+	b = appendProtoString(b, 2, task.Name)
+	b = appendProtoString(b, 3, task.Type)
+	b = appendProtoMap(b, 4, task.Parameters)
+	b = appendProtoInt32(b, 5, task.TimeoutSeconds)
+	b = appendProtoInt32(b, 6, task.MaxRetries)
+	for _, dep := range task.DependsOn {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendString(b, dep)
+	}
+	b = appendProtoString(b, 8, task.Priority)
+	b = appendProtoInt32(b, 9, task.DelaySeconds)
+	return b
+}
+
+func unmarshalTaskSpec(data []byte) (*TaskSpec, error) {
+	var task TaskSpec
+	err := consumeProtoFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeProtoString(b, &task.ID)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeProtoString(b, &task.Name)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeProtoString(b, &task.Type)
+		case num == 4 && typ == protowire.BytesType:
+			return consumeProtoMapEntry(b, &task.Parameters)
+		case num == 5 && typ == protowire.VarintType:
+			return consumeProtoInt32(b, &task.TimeoutSeconds)
+		case num == 6 && typ == protowire.VarintType:
+			return consumeProtoInt32(b, &task.MaxRetries)
+		case num == 7 && typ == protowire.BytesType:
+			var dep string
+			n, err := consumeProtoString(b, &dep)
+			task.DependsOn = append(task.DependsOn, dep)
+			return n, err
+		case num == 8 && typ == protowire.BytesType:
+			return consumeProtoString(b, &task.Priority)
+		case num == 9 && typ == protowire.VarintType:
+			return consumeProtoInt32(b, &task.DelaySeconds)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decoding task spec: %w", err)
+	}
+	return &task, nil
+}
+
+// Proto3 omits fields holding their zero value
+func appendProtoString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendProtoInt32(b []byte, num protowire.Number, v int) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(int32(v)))
+}
+
+// appendProtoMap encodes a map<string, string> as repeated key/value entries
+func appendProtoMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	for k, v := range m {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, v)
+
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// consumeProtoFields walks the fields of a message, calling field with the
+// bytes following each tag. field returns how many bytes it consumed
+func consumeProtoFields(b []byte, field func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeProtoString(b []byte, s *string) (int, error) {
+	v, n := protowire.ConsumeString(b)
+	if n < 0 {
+		return n, protowire.ParseError(n)
+	}
+	*s = v
+	return n, nil
+}
+
+func consumeProtoInt32(b []byte, v *int) (int, error) {
+	x, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return n, protowire.ParseError(n)
+	}
+	*v = int(int32(x))
+	return n, nil
+}
+
+func consumeProtoMapEntry(b []byte, m *map[string]string) (int, error) {
+	entry, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n, protowire.ParseError(n)
+	}
+
+	var key, value string
+	err := consumeProtoFields(entry, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeProtoString(b, &key)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeProtoString(b, &value)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if *m == nil {
+		*m = make(map[string]string)
+	}
+	(*m)[key] = value
+	return n, nil
+}
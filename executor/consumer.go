@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+)
+
+// The executor consumes workflows with at-least-once delivery. Offsets are
+// committed per partition only after a message has been processed, and a
+// rebalance waits for in-flight messages on revoked partitions to finish
+// before the partitions are handed to another executor. A message processed
+// but not yet committed when a rebalance or crash hits is delivered again;
+// the run ID dedup in processWorkflow keeps the redelivery from starting the
+// run twice.
+
+// pingKafka checks that the Kafka broker accepts connections
+func pingKafka(ctx context.Context) error {
+	conn, err := kafkaDialer.DialContext(ctx, "tcp", viper.GetString("KAFKA_BROKERS"))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func initConsumerGroup() (*kafka.ConsumerGroup, error) {
+	return kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:          "chronos-executor",
+		Brokers:     []string{viper.GetString("KAFKA_BROKERS")},
+		Topics:      []string{viper.GetString("KAFKA_TOPIC_IN")},
+		Dialer:      kafkaDialer,
+		StartOffset: kafka.FirstOffset,
+	})
+}
+
+// consumeWorkflows processes the partitions assigned to this executor, one
+// consumer group generation at a time, until ctx is cancelled
+func consumeWorkflows(ctx context.Context, group *kafka.ConsumerGroup, writer *kafka.Writer, store StateStore) {
+	log.Println("Starting Kafka consumer for workflows")
+
+	pool := newProcessingPool(ctx, viper.GetInt("EXECUTOR_CONCURRENCY"), store,
+		func(ctx context.Context, message kafka.Message) error {
+			return processWorkflow(ctx, message, writer, store)
+		})
+	topic := viper.GetString("KAFKA_TOPIC_IN")
+	for {
+		gen, err := group.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, kafka.ErrGroupClosed) {
+				partitionsOwned.Set(0)
+				log.Println("Stopping Kafka consumer")
+				return
+			}
+			log.Printf("Error joining consumer group: %v", err)
+			continue
+		}
+
+		assignments := gen.Assignments[topic]
+		consumerRebalances.Inc()
+		partitionsOwned.Set(float64(len(assignments)))
+		log.Printf("Joined generation %d of consumer group with %d partitions", gen.ID, len(assignments))
+
+		for _, assignment := range assignments {
+			partition, offset := assignment.ID, assignment.Offset
+			gen.Start(func(genCtx context.Context) {
+				consumePartition(genCtx, gen, topic, partition, offset, pool)
+			})
+		}
+	}
+}
+
+// consumePartition feeds one partition into the processing pool until its
+// generation ends
+func consumePartition(genCtx context.Context, gen *kafka.Generation, topic string, partition int, offset int64, pool *processingPool) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{viper.GetString("KAFKA_BROKERS")},
+		Topic:     topic,
+		Partition: partition,
+		Dialer:    kafkaDialer,
+		MinBytes:  10e3, // 10KB
+		MaxBytes:  10e6, // 10MB
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(offset); err != nil {
+		log.Printf("Error seeking partition %d to offset %d: %v", partition, offset, err)
+		return
+	}
+
+	feedPartition(genCtx, reader, newOffsetTracker(gen, topic, partition), pool)
+}
+
+// partitionReader is the part of a Kafka reader a partition is fed from
+type partitionReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+}
+
+// feedPartition submits a partition's messages to the processing pool until
+// its generation ends, then waits for the partition's in-flight messages to
+// finish. Those messages are processed under the consumer's context rather
+// than genCtx, so a rebalance lets them finish; their offset commits then
+// fail against the ended generation and they are redelivered to the
+// partition's next owner. Messages not yet handed to a lane when the
+// generation ends are left to the next owner
+func feedPartition(genCtx context.Context, reader partitionReader, tracker *offsetTracker, pool *processingPool) {
+	var inFlight sync.WaitGroup
+	defer inFlight.Wait()
+
+	for {
+		message, err := reader.FetchMessage(genCtx)
+		if err != nil {
+			if genCtx.Err() != nil {
+				log.Printf("Releasing partition %d", tracker.partition)
+				return
+			}
+			log.Printf("Error reading message from partition %d: %v", tracker.partition, err)
+			continue
+		}
+
+		tracker.add(message.Offset)
+		inFlight.Add(1)
+		submitted := pool.submit(genCtx, message, func(processed bool) {
+			// An unprocessed offset is never completed, which also holds
+			// back the commits of every later offset on the partition
+			if processed {
+				tracker.complete(message.Offset)
+			}
+			inFlight.Done()
+		})
+		if !submitted {
+			inFlight.Done()
+			log.Printf("Releasing partition %d", tracker.partition)
+			return
+		}
+	}
+}
+
+// processingPool processes workflow messages on a fixed number of lanes.
+// Messages with the same key always share a lane, so each workflow's
+// messages are processed in order while different workflows proceed
+// concurrently
+type processingPool struct {
+	lanes []chan processingJob
+}
+
+// processingJob is a message waiting in a lane, with the callback to run
+// once the lane is done with it. processed is false when shutdown cut the
+// message short, so its offset must not be committed
+type processingJob struct {
+	message kafka.Message
+	done    func(processed bool)
+}
+
+// newProcessingPool starts concurrency lanes that process messages with
+// process until ctx is cancelled. Messages that fail are dead-lettered to
+// store
+func newProcessingPool(ctx context.Context, concurrency int, store StateStore, process func(context.Context, kafka.Message) error) *processingPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	pool := &processingPool{lanes: make([]chan processingJob, concurrency)}
+	for i := range pool.lanes {
+		lane := make(chan processingJob)
+		pool.lanes[i] = lane
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-lane:
+					log.Printf("Received message at offset %d of partition %d", job.message.Offset, job.message.Partition)
+					err := process(ctx, job.message)
+					aborted := err != nil && ctx.Err() != nil
+					if err != nil && !aborted {
+						log.Printf("Error processing workflow: %v", err)
+						// The offset is committed regardless, so a failed
+						// message is kept in the DLQ to be redriven
+						deadLetter(ctx, store, deadLetterSourceWorkflow, job.message, err)
+					}
+					if aborted {
+						log.Printf("Shutdown interrupted message at offset %d of partition %d, leaving it uncommitted",
+							job.message.Offset, job.message.Partition)
+					}
+					messagesInFlight.Dec()
+					job.done(!aborted)
+				}
+			}
+		}()
+	}
+
+	return pool
+}
+
+// submit hands a message to the lane for its key, blocking while that lane
+// is busy. It reports false if ctx ends before a lane accepts the message
+func (p *processingPool) submit(ctx context.Context, message kafka.Message, done func(processed bool)) bool {
+	lane := p.lanes[0]
+	if len(p.lanes) > 1 {
+		h := fnv.New32a()
+		if len(message.Key) > 0 {
+			h.Write(message.Key)
+		} else {
+			// Unkeyed messages carry no ordering requirement
+			fmt.Fprintf(h, "%d/%d", message.Partition, message.Offset)
+		}
+		lane = p.lanes[h.Sum32()%uint32(len(p.lanes))]
+	}
+
+	messagesInFlight.Inc()
+	select {
+	case lane <- processingJob{message: message, done: done}:
+		return true
+	case <-ctx.Done():
+		messagesInFlight.Dec()
+		return false
+	}
+}
+
+// offsetTracker commits a partition's offsets in order while its messages
+// finish processing out of order, so an offset is only committed once every
+// message before it has been processed
+type offsetTracker struct {
+	gen       offsetCommitter
+	topic     string
+	partition int
+
+	mu sync.Mutex
+	// pending holds fetched offsets not yet committed, in fetch order
+	pending []int64
+	done    map[int64]bool
+}
+
+// offsetCommitter commits offsets for a consumer group generation
+type offsetCommitter interface {
+	CommitOffsets(offsets map[string]map[int]int64) error
+}
+
+func newOffsetTracker(gen offsetCommitter, topic string, partition int) *offsetTracker {
+	return &offsetTracker{
+		gen:       gen,
+		topic:     topic,
+		partition: partition,
+		done:      make(map[int64]bool),
+	}
+}
+
+// add records a fetched offset as awaiting processing
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, offset)
+}
+
+// complete marks an offset as processed and commits past every offset that
+// has now been processed in order
+func (t *offsetTracker) complete(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
+	commit := int64(-1)
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		delete(t.done, t.pending[0])
+		commit = t.pending[0] + 1
+		t.pending = t.pending[1:]
+	}
+	if commit < 0 {
+		return
+	}
+
+	err := t.gen.CommitOffsets(map[string]map[int]int64{
+		t.topic: {t.partition: commit},
+	})
+	if err != nil {
+		log.Printf("Error committing offset %d on partition %d, later messages will be redelivered: %v", commit, t.partition, err)
+	}
+}
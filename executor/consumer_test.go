@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// waitDone submits a message and waits for the lane to be done with it,
+// returning whether it was processed
+func waitDone(t *testing.T, pool *processingPool, message kafka.Message) bool {
+	t.Helper()
+	done := make(chan bool, 1)
+	if !pool.submit(context.Background(), message, func(processed bool) { done <- processed }) {
+		t.Fatal("pool refused the message")
+	}
+	select {
+	case processed := <-done:
+		return processed
+	case <-time.After(5 * time.Second):
+		t.Fatal("message never finished")
+		return false
+	}
+}
+
+func TestProcessingPoolLeavesInterruptedMessagesUncommitted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{})
+	pool := newProcessingPool(ctx, 1, nil, func(ctx context.Context, message kafka.Message) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	done := make(chan bool, 1)
+	pool.submit(context.Background(), kafka.Message{Offset: 7}, func(processed bool) { done <- processed })
+	<-started
+	cancel()
+
+	if <-done {
+		t.Error("message cut short by shutdown was reported processed, and would be committed")
+	}
+}
+
+func TestProcessingPoolCommitsDeadLetteredMessages(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	pool := newProcessingPool(context.Background(), 1, store, func(ctx context.Context, message kafka.Message) error {
+		return errors.New("invalid workflow")
+	})
+
+	if !waitDone(t, pool, kafka.Message{Topic: "chronos-workflows", Offset: 3, Value: []byte("{}")}) {
+		t.Error("failed message was not reported processed")
+	}
+	letters, err := store.ListDeadLetters(context.Background(), defaultTenant, deadLetterSourceWorkflow, 10)
+	if err != nil {
+		t.Fatalf("ListDeadLetters: %v", err)
+	}
+	if len(letters) != 1 {
+		t.Errorf("dead letters = %d, want the failed message kept", len(letters))
+	}
+}
+
+// BenchmarkProcessingPool measures throughput with processing that waits
+// on I/O, as processWorkflow does on the state store and Kafka
+func BenchmarkProcessingPool(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, concurrency := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			pool := newProcessingPool(ctx, concurrency, nil, func(ctx context.Context, message kafka.Message) error {
+				time.Sleep(100 * time.Microsecond)
+				return nil
+			})
+
+			done := make(chan bool, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				message := kafka.Message{Key: []byte(fmt.Sprintf("acme/wf-%d", i%256)), Offset: int64(i)}
+				pool.submit(ctx, message, func(processed bool) { done <- processed })
+			}
+			for i := 0; i < b.N; i++ {
+				<-done
+			}
+		})
+	}
+}
+
+// partitionMessages serves a partition's messages in order, then blocks
+// until the generation ends
+type partitionMessages struct {
+	messages []kafka.Message
+}
+
+func (p *partitionMessages) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(p.messages) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	message := p.messages[0]
+	p.messages = p.messages[1:]
+	return message, nil
+}
+
+// generation records the offsets committed in it, and fails commits once it
+// has ended as the group coordinator does
+type generation struct {
+	mu        sync.Mutex
+	ended     bool
+	committed []int64
+}
+
+func (g *generation) CommitOffsets(offsets map[string]map[int]int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ended {
+		return kafka.RebalanceInProgress
+	}
+	for _, partitions := range offsets {
+		for _, offset := range partitions {
+			g.committed = append(g.committed, offset)
+		}
+	}
+	return nil
+}
+
+func (g *generation) end() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ended = true
+}
+
+func (g *generation) lastCommit() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.committed) == 0 {
+		return -1
+	}
+	return g.committed[len(g.committed)-1]
+}
+
+func TestRebalanceFinishesInFlightMessagesAndLeavesTheRestToTheNextOwner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Offset 1 is still processing when the rebalance starts, and offset 2
+	// waits behind it in the same lane
+	release := make(chan struct{})
+	processing := make(chan int64, 4)
+	var mu sync.Mutex
+	var processed []int64
+	pool := newProcessingPool(ctx, 1, nil, func(ctx context.Context, message kafka.Message) error {
+		processing <- message.Offset
+		if message.Offset == 1 {
+			<-release
+		}
+		mu.Lock()
+		processed = append(processed, message.Offset)
+		mu.Unlock()
+		return nil
+	})
+
+	gen := &generation{}
+	genCtx, endGeneration := context.WithCancel(ctx)
+	reader := &partitionMessages{messages: []kafka.Message{
+		{Key: []byte("acme/wf"), Offset: 0},
+		{Key: []byte("acme/wf"), Offset: 1},
+		{Key: []byte("acme/wf"), Offset: 2},
+	}}
+	fed := make(chan struct{})
+	go func() {
+		feedPartition(genCtx, reader, newOffsetTracker(gen, "chronos-workflows", 0), pool)
+		close(fed)
+	}()
+
+	<-processing
+	<-processing
+	if got := gen.lastCommit(); got != 1 {
+		t.Fatalf("committed offset before the rebalance = %d, want 1", got)
+	}
+
+	endGeneration()
+	select {
+	case <-fed:
+		t.Fatal("partition released while a message was still processing")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The in-flight message finishes and is committed before the partition
+	// is released; the one never handed to a lane is left uncommitted
+	close(release)
+	select {
+	case <-fed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("partition never released")
+	}
+	if got := gen.lastCommit(); got != 2 {
+		t.Errorf("committed offset after the rebalance = %d, want 2 so offset 2 is redelivered", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(processed) != 2 {
+		t.Errorf("processed offsets = %v, want [0 1] with 2 left to the next owner", processed)
+	}
+}
+
+func TestRebalanceCommitAfterGenerationEndLeavesMessagesForRedelivery(t *testing.T) {
+	gen := &generation{}
+	tracker := newOffsetTracker(gen, "chronos-workflows", 0)
+	tracker.add(0)
+	tracker.add(1)
+	tracker.complete(0)
+
+	// The generation ends while offset 1 is in flight; its commit fails, so
+	// the next owner starts from offset 1 and processes it again
+	gen.end()
+	tracker.complete(1)
+	if got := gen.lastCommit(); got != 1 {
+		t.Errorf("committed offset = %d, want 1", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// deferTask holds a task with a delay in the state store until it's due. A
+// task that can't be deferred is dead-lettered rather than run early
+func deferTask(ctx context.Context, store StateStore, topic string, task *DelayedTask, delay time.Duration) {
+	if err := store.DeferTask(ctx, task, delay); err != nil {
+		message := task.message()
+		message.Topic = topic
+		deadLetter(ctx, store, deadLetterSourceTask, message,
+			fmt.Errorf("deferring task %s of run %s: %w", task.TaskID, task.RunID, err))
+		return
+	}
+	deferredTasks.Inc()
+}
+
+// promoteDeferredTasks dispatches deferred tasks as they fall due until ctx
+// is cancelled. Due times are kept by the state store's clock, so deferred
+// tasks survive restarts and aren't affected by executors' clocks
+func promoteDeferredTasks(ctx context.Context, writer *kafka.Writer, store StateStore, interval time.Duration, batchSize int, claimTimeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		promoteDueTasks(ctx, writer, store, batchSize, claimTimeout)
+
+		if count, err := store.CountDeferredTasks(ctx); err != nil {
+			log.Printf("Error counting deferred tasks: %v", err)
+		} else {
+			deferredTasks.Set(float64(count))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// promoteDueTasks dispatches due tasks a batch at a time until none are left.
+// They go through circuit breakers and dispatch limits like any other task.
+// Each task stays claimed in the store until it has been written or moved to
+// a delay queue, so a task that fails to be written is released to be tried
+// again, and one whose executor stops before either is claimed again once
+// its claim expires
+func promoteDueTasks(ctx context.Context, writer *kafka.Writer, store StateStore, batchSize int, claimTimeout time.Duration) {
+	for {
+		tasks, err := store.ClaimDueTasks(ctx, batchSize, claimTimeout)
+		if err != nil {
+			log.Printf("Error claiming due deferred tasks: %v", err)
+			return
+		}
+
+		messages := make([]kafka.Message, 0, len(tasks))
+		sent := make([]*DelayedTask, 0, len(tasks))
+		for _, task := range tasks {
+			if holdTask(ctx, store, task) {
+				ackDeferredTask(ctx, store, task)
+				continue
+			}
+			if limit, ok := dispatchLimits[task.Bucket]; ok && !admitTask(ctx, store, limit, task) {
+				ackDeferredTask(ctx, store, task)
+				continue
+			}
+			messages = append(messages, task.message())
+			sent = append(sent, task)
+		}
+
+		failed := false
+		if len(messages) > 0 {
+			err = writer.WriteMessages(ctx, messages...)
+			var writeErrs kafka.WriteErrors
+			for i, task := range sent {
+				writeErr := err
+				if errors.As(err, &writeErrs) {
+					writeErr = writeErrs[i]
+				}
+				if writeErr != nil {
+					failed = true
+					log.Printf("Error dispatching deferred task %s of run %s, releasing it: %v", task.TaskID, task.RunID, writeErr)
+					if err := store.ReleaseDeferredTask(ctx, task); err != nil {
+						log.Printf("Error releasing deferred task %s, it's claimed again once its claim expires: %v", task.TaskID, err)
+					}
+					continue
+				}
+				ackDeferredTask(ctx, store, task)
+				tasksDispatched.WithLabelValues(taskTypeLabel(task.TaskType)).Inc()
+			}
+		}
+
+		// Released tasks are due at once, so they're left to the next tick
+		// rather than claimed again straight away
+		if failed || len(tasks) < batchSize {
+			return
+		}
+	}
+}
+
+// ackDeferredTask removes a deferred task once it has left the deferred
+// queue. If that fails the task is dispatched again when its claim expires
+func ackDeferredTask(ctx context.Context, store StateStore, task *DelayedTask) {
+	if err := store.AckDeferredTask(ctx, task); err != nil {
+		log.Printf("Error removing dispatched deferred task %s, it may be dispatched again: %v", task.TaskID, err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func deferredTask(id string) *DelayedTask {
+	return &DelayedTask{TaskID: id, RunID: "run-1", TaskType: "http", Key: "acme/wf", Value: []byte(`{"task_id":"` + id + `"}`)}
+}
+
+func TestPromoteDueTasksReleasesTasksThatFailToBeWritten(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	broker := newFakeKafka()
+	writer := broker.writer("chronos-tasks")
+	ctx := context.Background()
+	if err := store.DeferTask(ctx, deferredTask("a"), 0); err != nil {
+		t.Fatalf("DeferTask: %v", err)
+	}
+
+	broker.err = errors.New("broker unavailable")
+	promoteDueTasks(ctx, writer, store, 10, time.Minute)
+	if count, err := store.CountDeferredTasks(ctx); err != nil || count != 1 {
+		t.Fatalf("deferred tasks after a failed write = %d, %v, want the task kept", count, err)
+	}
+	if letters, _ := store.ListDeadLetters(ctx, "acme", deadLetterSourceTask, 10); len(letters) != 0 {
+		t.Errorf("dead letters = %d, want the task retried instead", len(letters))
+	}
+
+	broker.err = nil
+	promoteDueTasks(ctx, writer, store, 10, time.Minute)
+	if got := len(broker.produced("chronos-tasks")); got != 1 {
+		t.Errorf("dispatched tasks = %d, want 1", got)
+	}
+	if count, err := store.CountDeferredTasks(ctx); err != nil || count != 0 {
+		t.Errorf("deferred tasks after dispatch = %d, %v, want none", count, err)
+	}
+}
+
+func TestClaimedDeferredTasksAreClaimedAgainAfterTheirClaimExpires(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	ctx := context.Background()
+	server.SetTime(time.Now())
+	if err := store.DeferTask(ctx, deferredTask("a"), 0); err != nil {
+		t.Fatalf("DeferTask: %v", err)
+	}
+
+	// The first claimer stops before writing the task or releasing it
+	tasks, err := store.ClaimDueTasks(ctx, 10, time.Minute)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("ClaimDueTasks = %d tasks, %v, want 1", len(tasks), err)
+	}
+	if tasks, err := store.ClaimDueTasks(ctx, 10, time.Minute); err != nil || len(tasks) != 0 {
+		t.Fatalf("claimed a task already claimed: %d tasks, %v", len(tasks), err)
+	}
+
+	server.SetTime(time.Now().Add(2 * time.Minute))
+	tasks, err = store.ClaimDueTasks(ctx, 10, time.Minute)
+	if err != nil || len(tasks) != 1 || tasks[0].TaskID != "a" {
+		t.Fatalf("ClaimDueTasks after the claim expired = %v, %v, want task a", tasks, err)
+	}
+	if err := store.AckDeferredTask(ctx, tasks[0]); err != nil {
+		t.Fatalf("AckDeferredTask: %v", err)
+	}
+	if count, err := store.CountDeferredTasks(ctx); err != nil || count != 0 {
+		t.Errorf("deferred tasks after ack = %d, %v, want none", count, err)
+	}
+}
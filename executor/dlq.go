@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+)
+
+// Sources of dead letters: workflow messages the executor failed to process,
+// and task messages it failed to dispatch
+const (
+	deadLetterSourceWorkflow = "workflow"
+	deadLetterSourceTask     = "task"
+)
+
+// redriveCountHeader carries how many times a message has been redriven, so
+// a message that keeps failing can't cycle through the DLQ forever
+const redriveCountHeader = "chronos-redrive-count"
+
+// DeadLetter is a message that couldn't be processed or dispatched, kept
+// with its error until an operator redrives or discards it
+type DeadLetter struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	// TenantID is the tenant the message was keyed under; messages without
+	// one belong to the default tenant
+	TenantID string `json:"tenant_id"`
+	// Topic is the topic the message is redriven to
+	Topic     string            `json:"topic"`
+	Partition int               `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Key       string            `json:"key,omitempty"`
+	Value     []byte            `json:"value"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Error     string            `json:"error"`
+	// RedriveCount is how many times the message was redriven before
+	// failing again
+	RedriveCount int       `json:"redrive_count"`
+	FailedAt     time.Time `json:"failed_at"`
+}
+
+// newDeadLetter builds a dead letter from a failed message
+func newDeadLetter(source string, message kafka.Message, cause error) *DeadLetter {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	entry := &DeadLetter{
+		ID:        "dlq-" + hex.EncodeToString(b),
+		Source:    source,
+		TenantID:  messageTenant(message),
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       string(message.Key),
+		Value:     message.Value,
+		Headers:   make(map[string]string, len(message.Headers)),
+		Error:     cause.Error(),
+		FailedAt:  time.Now(),
+	}
+	for _, h := range message.Headers {
+		if h.Key == redriveCountHeader {
+			entry.RedriveCount, _ = strconv.Atoi(string(h.Value))
+			continue
+		}
+		entry.Headers[h.Key] = string(h.Value)
+	}
+	return entry
+}
+
+// messageTenant returns the tenant of a workflow or task message, which is
+// the first part of its tenant/workflow key
+func messageTenant(message kafka.Message) string {
+	tenant, _, ok := strings.Cut(string(message.Key), "/")
+	if !ok {
+		return defaultTenant
+	}
+	return tenantOrDefault(tenant)
+}
+
+// deadLetter moves a failed message to the DLQ. Losing the message is the
+// alternative, so a DLQ write failure is only logged
+func deadLetter(ctx context.Context, store StateStore, source string, message kafka.Message, cause error) {
+	entry := newDeadLetter(source, message, cause)
+	if err := store.AddDeadLetter(ctx, entry); err != nil {
+		log.Printf("Error dead-lettering %s message at %s/%d/%d, dropping it: %v",
+			source, message.Topic, message.Partition, message.Offset, err)
+		return
+	}
+	deadLetterDepth.WithLabelValues(source).Inc()
+	log.Printf("Dead-lettered %s message as %s: %v", source, entry.ID, cause)
+}
+
+// monitorDeadLetters refreshes the DLQ depth gauge from the state store
+// every interval, picking up entries added or removed by other executors
+func monitorDeadLetters(ctx context.Context, store StateStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		counts, err := store.CountDeadLetters(ctx)
+		if err != nil {
+			log.Printf("Error counting dead letters: %v", err)
+		} else {
+			for _, source := range []string{deadLetterSourceWorkflow, deadLetterSourceTask} {
+				deadLetterDepth.WithLabelValues(source).Set(float64(counts[source]))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RedriveResult reports the outcome of redriving one dead letter
+type RedriveResult struct {
+	ID  string
+	Err error
+}
+
+// ListDeadLetters returns up to limit of the calling tenant's dead letters
+// from source, or from every source when source is empty, oldest first
+func (s *executorServer) ListDeadLetters(ctx context.Context, source string, limit int) ([]*DeadLetter, error) {
+	switch source {
+	case "", deadLetterSourceWorkflow, deadLetterSourceTask:
+	default:
+		return nil, fmt.Errorf("unknown dead letter source %q, expected workflow or task", source)
+	}
+	if limit <= 0 || limit > viper.GetInt("DLQ_MAX_LIST") {
+		limit = viper.GetInt("DLQ_MAX_LIST")
+	}
+	return s.store.ListDeadLetters(ctx, tenantOrDefault(tenantFromContext(ctx)), source, limit)
+}
+
+// Redrive republishes the calling tenant's dead letters to the topics they
+// came from and removes them from the DLQ. edits optionally replaces the
+// value of entries by ID before they're republished. Entries redriven
+// DLQ_MAX_REDRIVES times are refused; they need to be fixed at the source
+// instead
+func (s *executorServer) Redrive(ctx context.Context, ids []string, edits map[string][]byte) []RedriveResult {
+	results := make([]RedriveResult, len(ids))
+	for i, id := range ids {
+		results[i] = RedriveResult{ID: id, Err: s.redrive(ctx, id, edits[id])}
+	}
+	return results
+}
+
+// redrive republishes one dead letter, with value replacing its value when
+// set. The entry is claimed while it's republished, so redriving it again
+// at once, on this executor or another, can't publish it twice; it's
+// removed once published, and the claim is released if it isn't
+func (s *executorServer) redrive(ctx context.Context, id string, value []byte) error {
+	tenant := tenantOrDefault(tenantFromContext(ctx))
+	entry, err := s.store.ClaimDeadLetter(ctx, tenant, id, viper.GetDuration("DLQ_REDRIVE_CLAIM_TIMEOUT"))
+	if errors.Is(err, errNotFound) {
+		return fmt.Errorf("dead letter %s not found", id)
+	}
+	if errors.Is(err, errDeadLetterClaimed) {
+		return fmt.Errorf("dead letter %s is already being redriven", id)
+	}
+	if err != nil {
+		return fmt.Errorf("claiming dead letter %s: %w", id, err)
+	}
+
+	if err := s.republish(ctx, entry, value); err != nil {
+		if releaseErr := s.store.ReleaseDeadLetter(ctx, tenant, id); releaseErr != nil {
+			log.Printf("Error releasing dead letter %s, it can be redriven once its claim expires: %v", id, releaseErr)
+		}
+		return err
+	}
+
+	// The message is republished even if removing it fails, in which case
+	// the stale entry is refused once the redriven copy fails and is counted
+	if err := s.store.DeleteDeadLetter(ctx, tenant, id); err != nil {
+		return fmt.Errorf("removing redriven dead letter %s: %w", id, err)
+	}
+	deadLetterDepth.WithLabelValues(entry.Source).Dec()
+	log.Printf("Redrove dead letter %s to %s", id, entry.Topic)
+	return nil
+}
+
+// republish writes a dead letter back to the topic it came from
+func (s *executorServer) republish(ctx context.Context, entry *DeadLetter, value []byte) error {
+	if limit := viper.GetInt("DLQ_MAX_REDRIVES"); entry.RedriveCount >= limit {
+		return fmt.Errorf("dead letter %s has been redriven %d times, the limit", entry.ID, entry.RedriveCount)
+	}
+
+	var writer *kafka.Writer
+	switch entry.Topic {
+	case s.submitWriter.Topic:
+		writer = s.submitWriter
+	case s.taskWriter.Topic:
+		writer = s.taskWriter
+	default:
+		return fmt.Errorf("dead letter %s came from unknown topic %s", entry.ID, entry.Topic)
+	}
+
+	message := kafka.Message{Key: []byte(entry.Key), Value: entry.Value}
+	if value != nil {
+		message.Value = value
+	}
+	for key, v := range entry.Headers {
+		message.Headers = append(message.Headers, kafka.Header{Key: key, Value: []byte(v)})
+	}
+	message.Headers = append(message.Headers, kafka.Header{
+		Key:   redriveCountHeader,
+		Value: []byte(strconv.Itoa(entry.RedriveCount + 1)),
+	})
+
+	if err := writer.WriteMessages(ctx, message); err != nil {
+		return fmt.Errorf("republishing dead letter %s: %w", entry.ID, err)
+	}
+	return nil
+}
+
+// handleListDeadLetters serves GET /dlq, optionally filtered by source and
+// limited by limit, for the tenant named by the X-Chronos-Tenant header or
+// tenant query parameter
+func (s *executorServer) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit %q", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := withRequestTenant(r.Context(), r)
+	entries, err := s.ListDeadLetters(ctx, r.URL.Query().Get("source"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if entries == nil {
+		entries = []*DeadLetter{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// redriveRequest is the JSON body of a redrive request. Edited values are
+// base64 encoded, like the values listed by GET /dlq
+type redriveRequest struct {
+	IDs   []string          `json:"ids"`
+	Edits map[string][]byte `json:"edits,omitempty"`
+}
+
+// redriveResponseItem is the JSON form of a RedriveResult
+type redriveResponseItem struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleRedrive serves POST /dlq/redrive, responding with one result per ID.
+// Only the entries of the tenant named by the request can be redriven
+func (s *executorServer) handleRedrive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request redriveRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("decoding redrive request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	results := s.Redrive(withRequestTenant(r.Context(), r), request.IDs, request.Edits)
+	items := make([]redriveResponseItem, len(results))
+	for i, result := range results {
+		items[i] = redriveResponseItem{ID: result.ID, Success: result.Err == nil}
+		if result.Err != nil {
+			items[i].Error = result.Err.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
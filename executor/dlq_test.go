@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// addDeadLetter dead-letters a task message of tenant's workflow
+func addDeadLetter(t *testing.T, store StateStore, tenant string) *DeadLetter {
+	t.Helper()
+	entry := newDeadLetter(deadLetterSourceTask, kafka.Message{
+		Topic: "chronos-tasks",
+		Key:   []byte(tenant + "/wf"),
+		Value: []byte(`{"task_id":"a"}`),
+	}, errors.New("broker unavailable"))
+	if err := store.AddDeadLetter(context.Background(), entry); err != nil {
+		t.Fatalf("AddDeadLetter: %v", err)
+	}
+	return entry
+}
+
+func TestDeadLettersAreScopedByTenant(t *testing.T) {
+	f := newReplayFixture(t)
+	acme := addDeadLetter(t, f.store, "acme")
+	globex := addDeadLetter(t, f.store, "globex")
+
+	request := httptest.NewRequest(http.MethodGet, "/dlq", nil)
+	request.Header.Set(tenantHeader, "acme")
+	recorder := httptest.NewRecorder()
+	f.server.handleListDeadLetters(recorder, request)
+	var entries []*DeadLetter
+	if err := json.NewDecoder(recorder.Body).Decode(&entries); err != nil {
+		t.Fatalf("decoding entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != acme.ID {
+		t.Fatalf("acme listed %d entries, want only its own", len(entries))
+	}
+
+	body := `{"ids":["` + globex.ID + `"]}`
+	request = httptest.NewRequest(http.MethodPost, "/dlq/redrive?tenant=acme", strings.NewReader(body))
+	recorder = httptest.NewRecorder()
+	f.server.handleRedrive(recorder, request)
+	if !strings.Contains(recorder.Body.String(), "not found") {
+		t.Errorf("redriving another tenant's entry = %s, want not found", recorder.Body)
+	}
+	if len(f.kafka.produced("chronos-tasks")) != 0 {
+		t.Error("another tenant's entry was republished")
+	}
+}
+
+func TestRedriveClaimsEntriesWhileRepublishing(t *testing.T) {
+	f := newReplayFixture(t)
+	setConfig(t, "DLQ_MAX_REDRIVES", 3)
+	setConfig(t, "DLQ_REDRIVE_CLAIM_TIMEOUT", time.Minute)
+	entry := addDeadLetter(t, f.store, "acme")
+	ctx := withTenant(context.Background(), "acme")
+
+	// Another redrive holds the entry, so this one can't publish it too
+	if _, err := f.store.ClaimDeadLetter(ctx, "acme", entry.ID, time.Minute); err != nil {
+		t.Fatalf("ClaimDeadLetter: %v", err)
+	}
+	if result := f.server.Redrive(ctx, []string{entry.ID}, nil)[0]; result.Err == nil {
+		t.Fatal("redrove an entry claimed by another redrive")
+	}
+	if err := f.store.ReleaseDeadLetter(ctx, "acme", entry.ID); err != nil {
+		t.Fatalf("ReleaseDeadLetter: %v", err)
+	}
+
+	// A failed publish releases the claim, leaving the entry to redrive again
+	f.kafka.err = errors.New("broker unavailable")
+	if result := f.server.Redrive(ctx, []string{entry.ID}, nil)[0]; result.Err == nil {
+		t.Fatal("redrive succeeded although the publish failed")
+	}
+	f.kafka.err = nil
+	if result := f.server.Redrive(ctx, []string{entry.ID}, nil)[0]; result.Err != nil {
+		t.Fatalf("Redrive after a failed publish: %v", result.Err)
+	}
+	if got := len(f.kafka.produced("chronos-tasks")); got != 1 {
+		t.Errorf("republished %d messages, want 1", got)
+	}
+	if _, err := f.store.ClaimDeadLetter(ctx, "acme", entry.ID, time.Minute); !errors.Is(err, errNotFound) {
+		t.Errorf("redriven entry claim error = %v, want it removed", err)
+	}
+}
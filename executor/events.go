@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// WorkflowEvent is published onto the events topic when a run reaches a
+// terminal state. The scheduler arms the schedules that trigger after the
+// run's schedule on it
+type WorkflowEvent struct {
+	WorkflowID  string    `json:"workflow_id"`
+	RunID       string    `json:"run_id"`
+	TenantID    string    `json:"tenant_id"`
+	ScheduleID  string    `json:"schedule_id,omitempty"`
+	State       string    `json:"state"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// eventsWriter publishes workflow events. Events aren't published when it's
+// nil
+var eventsWriter *kafka.Writer
+
+// publishWorkflowEvent publishes that a run finished in state, keyed by
+// tenant and workflow like the run's tasks
+func publishWorkflowEvent(ctx context.Context, workflow *WorkflowMessage, state string, at time.Time) error {
+	if eventsWriter == nil {
+		return nil
+	}
+	tenant := tenantOrDefault(workflow.TenantID)
+	value, err := json.Marshal(&WorkflowEvent{
+		WorkflowID:  workflow.WorkflowID,
+		RunID:       workflow.RunID,
+		TenantID:    tenant,
+		ScheduleID:  workflow.ScheduleID,
+		State:       state,
+		CompletedAt: at.UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("encoding event of run %s: %w", workflow.RunID, err)
+	}
+	err = eventsWriter.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(tenant + "/" + workflow.WorkflowID),
+		Value: value,
+	})
+	if err != nil {
+		return fmt.Errorf("publishing event of run %s: %w", workflow.RunID, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// readinessCheck checks that one of the service's dependencies is usable
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// readiness tracks whether the service's dependencies are usable, reporting
+// it through both the gRPC health protocol and /readyz from the same checks
+type readiness struct {
+	health   *health.Server
+	service  string
+	checks   []readinessCheck
+	draining atomic.Bool
+}
+
+func newReadiness(service string, checks ...readinessCheck) *readiness {
+	return &readiness{health: health.NewServer(), service: service, checks: checks}
+}
+
+// register adds the standard health service to a gRPC server
+func (r *readiness) register(server *grpc.Server) {
+	healthpb.RegisterHealthServer(server, r.health)
+}
+
+// check runs every check, returning the failures by dependency
+func (r *readiness) check(ctx context.Context) map[string]string {
+	failures := make(map[string]string)
+	for _, c := range r.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		if err := c.check(checkCtx); err != nil {
+			failures[c.name] = err.Error()
+		}
+		cancel()
+	}
+	return failures
+}
+
+// watch re-runs the checks every interval until ctx is cancelled, keeping
+// the gRPC health status in step
+func (r *readiness) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		if len(r.check(ctx)) > 0 {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		r.health.SetServingStatus("", status)
+		r.health.SetServingStatus(r.service, status)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// shutdown reports NOT_SERVING from now on, so load balancers drain traffic
+// before the servers stop
+func (r *readiness) shutdown() {
+	r.draining.Store(true)
+	r.health.Shutdown()
+}
+
+// handleReadyz serves GET /readyz: 200 when every dependency is usable, or
+// 503 listing the failing ones
+func (r *readiness) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	failures := r.check(req.Context())
+	if r.draining.Load() {
+		failures["server"] = "shutting down"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(failures) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "not ready", "failures": failures})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"github.com/spf13/viper"
+)
+
+// kafkaDialer connects every Kafka reader, consumer group, and health check
+// to the brokers, with the SASL mechanism and TLS set by the environment
+var kafkaDialer = kafka.DefaultDialer
+
+// initKafkaDialer builds the Kafka dialer from KAFKA_SASL_MECHANISM and the
+// KAFKA_TLS settings. A secured mechanism without credentials fails here
+// rather than on every connection attempt
+func initKafkaDialer() (*kafka.Dialer, error) {
+	mechanism, err := kafkaSASLMechanism()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := kafkaTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		SASLMechanism: mechanism,
+		TLS:           tlsConfig,
+	}, nil
+}
+
+// kafkaTransport returns the transport for Kafka writers, secured like the
+// dialer
+func kafkaTransport() *kafka.Transport {
+	return &kafka.Transport{
+		SASL: kafkaDialer.SASLMechanism,
+		TLS:  kafkaDialer.TLS,
+	}
+}
+
+// kafkaSASLMechanism returns the SASL mechanism set by KAFKA_SASL_MECHANISM:
+// empty for none, PLAIN, SCRAM-SHA-256, or SCRAM-SHA-512
+func kafkaSASLMechanism() (sasl.Mechanism, error) {
+	name := strings.ToUpper(viper.GetString("KAFKA_SASL_MECHANISM"))
+	switch name {
+	case "":
+		return nil, nil
+	case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+	default:
+		return nil, fmt.Errorf("KAFKA_SASL_MECHANISM must be PLAIN, SCRAM-SHA-256, or SCRAM-SHA-512, got %q", name)
+	}
+
+	username := viper.GetString("KAFKA_SASL_USERNAME")
+	password := viper.GetString("KAFKA_SASL_PASSWORD")
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("KAFKA_SASL_MECHANISM %s needs KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD", name)
+	}
+
+	switch name {
+	case "PLAIN":
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	default:
+		return scram.Mechanism(scram.SHA512, username, password)
+	}
+}
+
+// kafkaTLSConfig returns the TLS config set by KAFKA_TLS_ENABLED, or nil for
+// plaintext. The brokers are verified against KAFKA_TLS_CA_FILE if set, and
+// the system roots otherwise; KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE
+// set a client certificate for mutual TLS
+func kafkaTLSConfig() (*tls.Config, error) {
+	if !viper.GetBool("KAFKA_TLS_ENABLED") {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: viper.GetBool("KAFKA_TLS_INSECURE_SKIP_VERIFY"),
+	}
+
+	if caFile := viper.GetString("KAFKA_TLS_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading Kafka CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Kafka CA file %s", caFile)
+		}
+	}
+
+	certFile, keyFile := viper.GetString("KAFKA_TLS_CERT_FILE"), viper.GetString("KAFKA_TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE must be set together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading Kafka client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/spf13/viper"
+)
+
+// setConfig sets a configuration key for the duration of a test
+func setConfig(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	previous := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, previous) })
+}
+
+// fakeKafka is a single broker with one partition per topic that keeps the
+// messages produced to it, for writers under test
+type fakeKafka struct {
+	mu       sync.Mutex
+	messages map[string][]kafka.Message
+	// err fails every produce request when set
+	err error
+}
+
+func newFakeKafka() *fakeKafka {
+	return &fakeKafka{messages: make(map[string][]kafka.Message)}
+}
+
+// writer returns a writer producing to topic on the fake broker
+func (f *fakeKafka) writer(topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP("fake-kafka:9092"),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		Transport:    f,
+		BatchTimeout: time.Millisecond,
+		MaxAttempts:  1,
+	}
+}
+
+// produced returns the messages produced to topic so far
+func (f *fakeKafka) produced(topic string) []kafka.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]kafka.Message(nil), f.messages[topic]...)
+}
+
+func (f *fakeKafka) RoundTrip(ctx context.Context, addr net.Addr, req kafka.Request) (kafka.Response, error) {
+	switch req := req.(type) {
+	case *metadata.Request:
+		res := &metadata.Response{Brokers: []metadata.ResponseBroker{{NodeID: 1, Host: "fake-kafka", Port: 9092}}, ControllerID: 1}
+		for _, topic := range req.TopicNames {
+			res.Topics = append(res.Topics, metadata.ResponseTopic{
+				Name:       topic,
+				Partitions: []metadata.ResponsePartition{{PartitionIndex: 0, LeaderID: 1}},
+			})
+		}
+		return res, nil
+	case *produce.Request:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.err != nil {
+			return nil, f.err
+		}
+		res := &produce.Response{}
+		for _, topic := range req.Topics {
+			for _, partition := range topic.Partitions {
+				for {
+					record, err := partition.RecordSet.Records.ReadRecord()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					if err != nil {
+						return nil, err
+					}
+					key, _ := protocol.ReadAll(record.Key)
+					value, _ := protocol.ReadAll(record.Value)
+					message := kafka.Message{Topic: topic.Topic, Key: key, Value: value}
+					for _, h := range record.Headers {
+						message.Headers = append(message.Headers, kafka.Header{Key: h.Key, Value: h.Value})
+					}
+					f.messages[topic.Topic] = append(f.messages[topic.Topic], message)
+				}
+			}
+			res.Topics = append(res.Topics, produce.ResponseTopic{
+				Topic:      topic.Topic,
+				Partitions: []produce.ResponsePartition{{Partition: 0}},
+			})
+		}
+		return res, nil
+	default:
+		return nil, errors.New("fake kafka: unsupported request")
+	}
+}
+
+func TestInitKafkaDialerWiresSASLMechanism(t *testing.T) {
+	for _, name := range []string{"PLAIN", "SCRAM-SHA-256", "scram-sha-512"} {
+		t.Run(name, func(t *testing.T) {
+			setConfig(t, "KAFKA_SASL_MECHANISM", name)
+			setConfig(t, "KAFKA_SASL_USERNAME", "chronos")
+			setConfig(t, "KAFKA_SASL_PASSWORD", "secret")
+
+			dialer, err := initKafkaDialer()
+			if err != nil {
+				t.Fatalf("initKafkaDialer: %v", err)
+			}
+			if dialer.SASLMechanism == nil {
+				t.Fatal("dialer has no SASL mechanism")
+			}
+			if got, want := dialer.SASLMechanism.Name(), strings.ToUpper(name); got != want {
+				t.Errorf("mechanism = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestInitKafkaDialerPlainCredentials(t *testing.T) {
+	setConfig(t, "KAFKA_SASL_MECHANISM", "PLAIN")
+	setConfig(t, "KAFKA_SASL_USERNAME", "chronos")
+	setConfig(t, "KAFKA_SASL_PASSWORD", "secret")
+
+	dialer, err := initKafkaDialer()
+	if err != nil {
+		t.Fatalf("initKafkaDialer: %v", err)
+	}
+	mechanism, ok := dialer.SASLMechanism.(plain.Mechanism)
+	if !ok {
+		t.Fatalf("mechanism is %T, want plain.Mechanism", dialer.SASLMechanism)
+	}
+	if mechanism.Username != "chronos" || mechanism.Password != "secret" {
+		t.Errorf("credentials = %s/%s, want chronos/secret", mechanism.Username, mechanism.Password)
+	}
+}
+
+func TestInitKafkaDialerPlaintextByDefault(t *testing.T) {
+	setConfig(t, "KAFKA_SASL_MECHANISM", "")
+	setConfig(t, "KAFKA_TLS_ENABLED", false)
+
+	dialer, err := initKafkaDialer()
+	if err != nil {
+		t.Fatalf("initKafkaDialer: %v", err)
+	}
+	if dialer.SASLMechanism != nil || dialer.TLS != nil {
+		t.Errorf("dialer has SASL %v and TLS %v, want neither", dialer.SASLMechanism, dialer.TLS)
+	}
+}
+
+func TestInitKafkaDialerRejectsMissingCredentials(t *testing.T) {
+	setConfig(t, "KAFKA_SASL_MECHANISM", "SCRAM-SHA-512")
+	setConfig(t, "KAFKA_SASL_USERNAME", "chronos")
+	setConfig(t, "KAFKA_SASL_PASSWORD", "")
+
+	if _, err := initKafkaDialer(); err == nil || !strings.Contains(err.Error(), "KAFKA_SASL_PASSWORD") {
+		t.Errorf("err = %v, want one naming KAFKA_SASL_PASSWORD", err)
+	}
+}
+
+func TestInitKafkaDialerRejectsUnknownMechanism(t *testing.T) {
+	setConfig(t, "KAFKA_SASL_MECHANISM", "GSSAPI")
+
+	if _, err := initKafkaDialer(); err == nil {
+		t.Error("initKafkaDialer accepted GSSAPI")
+	}
+}
+
+func TestInitKafkaDialerTLS(t *testing.T) {
+	setConfig(t, "KAFKA_SASL_MECHANISM", "")
+	setConfig(t, "KAFKA_TLS_ENABLED", true)
+	setConfig(t, "KAFKA_TLS_CERT_FILE", "client.pem")
+	setConfig(t, "KAFKA_TLS_KEY_FILE", "")
+
+	if _, err := initKafkaDialer(); err == nil {
+		t.Error("initKafkaDialer accepted a client certificate without a key")
+	}
+
+	setConfig(t, "KAFKA_TLS_CERT_FILE", "")
+	dialer, err := initKafkaDialer()
+	if err != nil {
+		t.Fatalf("initKafkaDialer: %v", err)
+	}
+	if dialer.TLS == nil {
+		t.Error("dialer has no TLS config with KAFKA_TLS_ENABLED set")
+	}
+}
+
+func TestKafkaClientsUseConfiguredDialer(t *testing.T) {
+	setConfig(t, "KAFKA_SASL_MECHANISM", "PLAIN")
+	setConfig(t, "KAFKA_SASL_USERNAME", "chronos")
+	setConfig(t, "KAFKA_SASL_PASSWORD", "secret")
+
+	previous := kafkaDialer
+	t.Cleanup(func() { kafkaDialer = previous })
+	dialer, err := initKafkaDialer()
+	if err != nil {
+		t.Fatalf("initKafkaDialer: %v", err)
+	}
+	kafkaDialer = dialer
+
+	reader, err := initResultsReader()
+	if err != nil {
+		t.Fatalf("initResultsReader: %v", err)
+	}
+	defer reader.Close()
+	if reader.Config().Dialer != dialer {
+		t.Error("results reader does not use the configured dialer")
+	}
+
+	writer, err := initKafkaWriter("chronos-tasks")
+	if err != nil {
+		t.Fatalf("initKafkaWriter: %v", err)
+	}
+	defer writer.Close()
+	transport, ok := writer.Transport.(*kafka.Transport)
+	if !ok || transport.SASL != dialer.SASLMechanism {
+		t.Error("writer does not use the dialer's SASL mechanism")
+	}
+}
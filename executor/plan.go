@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+)
+
+// errDependencyCycle is wrapped by the validation error of a workflow whose
+// task dependencies form a cycle
+var errDependencyCycle = errors.New("dependency cycle")
+
+// ExecutionPlan is the order a workflow's tasks would be dispatched in,
+// returned by a dry run instead of executing them
+type ExecutionPlan struct {
+	// Stages are the task IDs dispatched together, each stage once every
+	// task of the stages before it has completed
+	Stages [][]string `json:"stages"`
+	// Resumed are the tasks resumed from a replayed run, never dispatched
+	Resumed []string `json:"resumed,omitempty"`
+	// Cycle is a dependency cycle among the tasks, each depending on the
+	// next, starting and ending with the same task
+	Cycle []string `json:"cycle,omitempty"`
+	// Unreachable are the tasks that can never be dispatched because they
+	// are part of a cycle or depend on one
+	Unreachable []string `json:"unreachable,omitempty"`
+}
+
+// plan resolves the workflow's dependencies into dispatch stages. The first
+// stage is the tasks readyTasks returns; each later stage is the tasks whose
+// dependencies have all completed in an earlier one. It expects task IDs to
+// be unique and dependencies to be known, as validate checks
+func (w *WorkflowMessage) plan() *ExecutionPlan {
+	plan := &ExecutionPlan{Resumed: w.ResumedTasks}
+	done := w.resumedSet()
+
+	remaining := make([]TaskSpec, 0, len(w.Tasks))
+	for _, task := range w.Tasks {
+		if _, ok := done[task.ID]; !ok {
+			remaining = append(remaining, task)
+		}
+	}
+
+	for len(remaining) > 0 {
+		var stage []string
+		var blocked []TaskSpec
+		for _, task := range remaining {
+			if dependsOnlyOn(task, done) {
+				stage = append(stage, task.ID)
+			} else {
+				blocked = append(blocked, task)
+			}
+		}
+		if len(stage) == 0 {
+			break
+		}
+		for _, id := range stage {
+			done[id] = struct{}{}
+		}
+		plan.Stages = append(plan.Stages, stage)
+		remaining = blocked
+	}
+
+	for _, task := range remaining {
+		plan.Unreachable = append(plan.Unreachable, task.ID)
+	}
+	if len(remaining) > 0 {
+		plan.Cycle = findCycle(remaining)
+	}
+	return plan
+}
+
+// dependsOnlyOn reports whether every dependency of task is in done
+func dependsOnlyOn(task TaskSpec, done map[string]struct{}) bool {
+	for _, dep := range task.DependsOn {
+		if _, ok := done[dep]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle returns a dependency cycle among tasks, or nil when there is
+// none. The tasks left over once no more can be planned always include one
+func findCycle(tasks []TaskSpec) []string {
+	deps := make(map[string][]string, len(tasks))
+	for _, task := range tasks {
+		deps[task.ID] = task.DependsOn
+	}
+
+	// Depth-first search along dependencies; reaching a task already on the
+	// path closes a cycle
+	const (
+		unvisited = iota
+		onPath
+		finished
+	)
+	state := make(map[string]int, len(tasks))
+	var path []string
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		state[id] = onPath
+		path = append(path, id)
+		for _, dep := range deps[id] {
+			if _, ok := deps[dep]; !ok {
+				continue
+			}
+			switch state[dep] {
+			case onPath:
+				for i, pathID := range path {
+					if pathID == dep {
+						return append(append([]string{}, path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = finished
+		return nil
+	}
+
+	for _, task := range tasks {
+		if state[task.ID] == unvisited {
+			if cycle := visit(task.ID); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Run and task states recorded by the executor
+const (
+	runStateRunning    = "RUNNING"
+	runStateCompleted  = "COMPLETED"
+	runStateFailed     = "FAILED"
+	taskStatePending   = "PENDING"
+	taskStateRunning   = "RUNNING"
+	taskStateCompleted = "COMPLETED"
+	taskStateFailed    = "FAILED"
+)
+
+// recordWorkflowProgress records a run as started along with its task
+// states, so the observatory can report progress. Dispatched tasks are
+// marked running and the rest pending
+func recordWorkflowProgress(ctx context.Context, store StateStore, workflow *WorkflowMessage, dispatched []TaskSpec) error {
+	now := time.Now()
+	transition := &Transition{
+		TenantID:   tenantOrDefault(workflow.TenantID),
+		RunID:      workflow.RunID,
+		WorkflowID: workflow.WorkflowID,
+		Name:       workflow.Name,
+		Labels:     workflow.Labels,
+		State:      runStateRunning,
+		TaskStates: make(map[string]string, len(workflow.Tasks)),
+		ReplayOf:   workflow.ReplayOf,
+		StartedAt:  now,
+		At:         now,
+	}
+	if transition.Labels == nil {
+		transition.Labels = map[string]string{}
+	}
+	for _, task := range workflow.Tasks {
+		transition.TaskStates[task.ID] = taskStatePending
+	}
+	for _, id := range workflow.ResumedTasks {
+		transition.TaskStates[id] = taskStateCompleted
+	}
+	for _, task := range dispatched {
+		transition.TaskStates[task.ID] = taskStateRunning
+	}
+
+	if err := store.RecordTransition(ctx, transition); err != nil {
+		return fmt.Errorf("recording progress for run %s: %w", workflow.RunID, err)
+	}
+	return nil
+}
+
+// recordWorkflowSubmitted records when a run was submitted, so its duration
+// covers the time spent queued on the workflows topic
+func recordWorkflowSubmitted(ctx context.Context, store StateStore, workflow *WorkflowMessage, at time.Time) error {
+	return store.RecordTransition(ctx, &Transition{
+		TenantID:    tenantOrDefault(workflow.TenantID),
+		RunID:       workflow.RunID,
+		WorkflowID:  workflow.WorkflowID,
+		Name:        workflow.Name,
+		SubmittedAt: at,
+		At:          at,
+	})
+}
+
+// recordWorkflowFinished marks a run as having reached a terminal state,
+// observes its duration from submission, and schedules its cleanup
+func recordWorkflowFinished(ctx context.Context, store StateStore, tenantID, runID, state string) error {
+	now := time.Now()
+	err := store.RecordTransition(ctx, &Transition{
+		TenantID: tenantID,
+		RunID:    runID,
+		State:    state,
+		At:       now,
+	})
+	if err != nil {
+		return err
+	}
+
+	run, err := store.GetRun(ctx, tenantID, runID)
+	if err != nil {
+		return fmt.Errorf("reading run %s: %w", runID, err)
+	}
+	if err := retainFinishedRun(ctx, store, run, state); err != nil {
+		log.Printf("Error scheduling cleanup of run %s: %v", runID, err)
+	}
+	if submitted := run.submittedAt(); !submitted.IsZero() {
+		workflowDuration.WithLabelValues(state, workflowNames.label(run.Name)).Observe(now.Sub(submitted).Seconds())
+	} else {
+		log.Printf("Run %s has no submission time, skipping its duration", runID)
+	}
+	return nil
+}
+
+// workflowNameSet bounds the workflow names used as metric labels: the first
+// WORKFLOW_METRIC_MAX_NAMES names seen are kept and the rest reported as
+// "other", so a flood of generated names can't blow up cardinality
+type workflowNameSet struct {
+	mu    sync.Mutex
+	names map[string]struct{}
+}
+
+var workflowNames = &workflowNameSet{names: make(map[string]struct{})}
+
+// label returns the metric label for a workflow name
+func (s *workflowNameSet) label(name string) string {
+	if name == "" {
+		return "unnamed"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.names[name]; ok {
+		return name
+	}
+	if len(s.names) >= viper.GetInt("WORKFLOW_METRIC_MAX_NAMES") {
+		return "other"
+	}
+	s.names[name] = struct{}{}
+	return name
+}
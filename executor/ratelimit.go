@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// dispatchLimit caps how fast tasks of one type, optionally only those
+// targeting one host, are dispatched. Tasks over the limit are held in the
+// bucket's delay queue in the state store rather than dropped
+type dispatchLimit struct {
+	// bucket names the limit, "http" or "http@api.example.com"
+	bucket string
+	// rate is the number of tasks dispatched per second
+	rate float64
+	// burst is the number of tasks that can be dispatched at once after
+	// the bucket has been idle
+	burst int
+}
+
+// dispatchLimits are the limits set by DISPATCH_RATE_LIMITS, by bucket
+var dispatchLimits map[string]dispatchLimit
+
+// DelayedTask is a task message held back from the task topic: by a
+// dispatch limit until its bucket has a token, by a circuit breaker until it
+// closes, or until its delay passes
+type DelayedTask struct {
+	TaskID   string `json:"task_id"`
+	RunID    string `json:"run_id"`
+	TaskType string `json:"task_type"`
+	// Bucket is the dispatch limit a deferred or held task is dispatched
+	// under once it's released, if any
+	Bucket    string            `json:"bucket,omitempty"`
+	Key       string            `json:"key"`
+	Value     []byte            `json:"value"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	DelayedAt time.Time         `json:"delayed_at"`
+	// Claim identifies a task claimed from the state store, to ack or
+	// release it
+	Claim string `json:"-"`
+}
+
+// newDelayedTask holds back a task's message
+func newDelayedTask(task TaskSpec, runID string, message kafka.Message) *DelayedTask {
+	delayed := &DelayedTask{
+		TaskID:    task.ID,
+		RunID:     runID,
+		TaskType:  task.Type,
+		Key:       string(message.Key),
+		Value:     message.Value,
+		Headers:   make(map[string]string, len(message.Headers)),
+		DelayedAt: time.Now(),
+	}
+	for _, h := range message.Headers {
+		delayed.Headers[h.Key] = string(h.Value)
+	}
+	return delayed
+}
+
+// message rebuilds the task's message for the task topic
+func (d *DelayedTask) message() kafka.Message {
+	message := kafka.Message{Key: []byte(d.Key), Value: d.Value}
+	for key, value := range d.Headers {
+		message.Headers = append(message.Headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return message
+}
+
+// parseDispatchLimits parses a comma-separated list of limits such as
+// "http=10,http@api.example.com=2:5": a task type, optionally with a target
+// host, and the tasks per second allowed, optionally with a burst. The
+// burst defaults to the rate rounded up
+func parseDispatchLimits(spec string) (map[string]dispatchLimit, error) {
+	limits := make(map[string]dispatchLimit)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		bucket, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("dispatch rate limit %q must be TYPE[@HOST]=RATE[:BURST]", item)
+		}
+		taskType, _, _ := strings.Cut(bucket, "@")
+		if _, known := knownTaskTypes[taskType]; !known {
+			return nil, fmt.Errorf("dispatch rate limit %q is for unknown task type %q", item, taskType)
+		}
+		if _, dup := limits[bucket]; dup {
+			return nil, fmt.Errorf("duplicate dispatch rate limit for %s", bucket)
+		}
+
+		rateValue, burstValue, hasBurst := strings.Cut(value, ":")
+		rate, err := strconv.ParseFloat(rateValue, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("dispatch rate limit %q needs a positive rate", item)
+		}
+		burst := int(math.Ceil(rate))
+		if hasBurst {
+			if burst, err = strconv.Atoi(burstValue); err != nil || burst < 1 {
+				return nil, fmt.Errorf("dispatch rate limit %q needs a burst of at least 1", item)
+			}
+		}
+		limits[bucket] = dispatchLimit{bucket: bucket, rate: rate, burst: burst}
+	}
+	return limits, nil
+}
+
+// taskHost returns the host an http task targets, from its url parameter
+func taskHost(task TaskSpec) string {
+	target, err := url.Parse(task.Parameters["url"])
+	if err != nil {
+		return ""
+	}
+	return target.Hostname()
+}
+
+// limitFor returns the limit a task is dispatched under: the one for its type
+// and target host when there is one, otherwise the one for its type
+func limitFor(task TaskSpec) (dispatchLimit, bool) {
+	if host := taskHost(task); host != "" {
+		if limit, ok := dispatchLimits[task.Type+"@"+host]; ok {
+			return limit, true
+		}
+	}
+	limit, ok := dispatchLimits[task.Type]
+	return limit, ok
+}
+
+// admitTask reports whether a rate-limited task can be dispatched now, which
+// it can when its bucket has a token and no tasks already waiting. Otherwise
+// it's added to the bucket's delay queue. Limits can't be enforced while the
+// state store is unreachable, so the task is let through
+func admitTask(ctx context.Context, store StateStore, limit dispatchLimit, task *DelayedTask) bool {
+	waiting, err := store.CountDelayedTasks(ctx, limit.bucket)
+	if err != nil {
+		log.Printf("Could not check the delay queue of %s, dispatching task %s: %v", limit.bucket, task.TaskID, err)
+		return true
+	}
+	if waiting == 0 {
+		ok, err := store.TakeToken(ctx, limit.bucket, limit.rate, limit.burst)
+		if err != nil {
+			log.Printf("Could not check the rate limit of %s, dispatching task %s: %v", limit.bucket, task.TaskID, err)
+			return true
+		}
+		if ok {
+			countLimitedDispatch(limit.bucket)
+			return true
+		}
+	}
+
+	task.DelayedAt = time.Now()
+	if err := store.DelayTask(ctx, limit.bucket, task); err != nil {
+		log.Printf("Could not delay task %s over the rate limit of %s, dispatching it: %v", task.TaskID, limit.bucket, err)
+		return true
+	}
+	delayedTasks.WithLabelValues(limit.bucket).Inc()
+	return false
+}
+
+// dispatchRateWindow is how often the observed dispatch rate of each
+// bucket is reported
+const dispatchRateWindow = 10 * time.Second
+
+// dispatchRates counts the tasks dispatched under each limit since the
+// observed rates were last reported
+var dispatchRates = &rateMeter{counts: make(map[string]int), since: time.Now()}
+
+// rateMeter measures how many tasks per second this executor dispatches
+// under each limit
+type rateMeter struct {
+	mu     sync.Mutex
+	counts map[string]int
+	since  time.Time
+}
+
+func (m *rateMeter) observe(bucket string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[bucket]++
+}
+
+// rates returns each bucket's dispatches per second since the last call, or
+// nil when less than window has passed
+func (m *rateMeter) rates(now time.Time, window time.Duration) map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elapsed := now.Sub(m.since)
+	if elapsed < window {
+		return nil
+	}
+	rates := make(map[string]float64, len(m.counts))
+	for bucket, count := range m.counts {
+		rates[bucket] = float64(count) / elapsed.Seconds()
+	}
+	m.counts = make(map[string]int)
+	m.since = now
+	return rates
+}
+
+// countLimitedDispatch counts a task dispatched under a limit
+func countLimitedDispatch(bucket string) {
+	rateLimitedDispatches.WithLabelValues(bucket).Inc()
+	dispatchRates.observe(bucket)
+}
+
+// reportDispatchRates sets the observed rate of every limit once a window
+// has passed. Limits every executor shares are summed across them
+func reportDispatchRates(now time.Time) {
+	rates := dispatchRates.rates(now, dispatchRateWindow)
+	if rates == nil {
+		return
+	}
+	for bucket := range dispatchLimits {
+		observedDispatchRate.WithLabelValues(bucket).Set(rates[bucket])
+	}
+}
+
+// dispatchDelayedTasks dispatches delayed tasks as their buckets' tokens
+// free up, checking every interval until ctx is cancelled. Every executor
+// runs it; the state store hands each delayed task to only one of them at a
+// time, claimed for claimTimeout
+func dispatchDelayedTasks(ctx context.Context, writer *kafka.Writer, store StateStore, interval, claimTimeout time.Duration) {
+	if len(dispatchLimits) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, limit := range dispatchLimits {
+			releaseDelayedTasks(ctx, writer, store, limit, claimTimeout)
+		}
+		reportDispatchRates(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseDelayedTasks dispatches a bucket's delayed tasks, oldest first, for
+// as long as the bucket has tokens. It stops at a task that fails to be
+// written, which is left at the front of the queue for the next interval
+func releaseDelayedTasks(ctx context.Context, writer *kafka.Writer, store StateStore, limit dispatchLimit, claimTimeout time.Duration) {
+	for {
+		waiting, err := store.CountDelayedTasks(ctx, limit.bucket)
+		if err != nil {
+			log.Printf("Error checking the delay queue of %s: %v", limit.bucket, err)
+			return
+		}
+		delayedTasks.WithLabelValues(limit.bucket).Set(float64(waiting))
+		if waiting == 0 {
+			return
+		}
+
+		ok, err := store.TakeToken(ctx, limit.bucket, limit.rate, limit.burst)
+		if err != nil {
+			log.Printf("Error checking the rate limit of %s: %v", limit.bucket, err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		task, err := store.ClaimDelayedTask(ctx, limit.bucket, claimTimeout)
+		if errors.Is(err, errNotFound) {
+			// Another executor took the last task
+			return
+		}
+		if err != nil {
+			log.Printf("Error taking a task from the delay queue of %s: %v", limit.bucket, err)
+			return
+		}
+
+		if !writeDelayedTask(ctx, writer, store, limit.bucket, task) {
+			return
+		}
+		countLimitedDispatch(limit.bucket)
+	}
+}
+
+// writeDelayedTask dispatches a task claimed from a delay queue, reporting
+// whether it was written. The task is removed from the queue once written,
+// and released back to the front of it if the write fails
+func writeDelayedTask(ctx context.Context, writer *kafka.Writer, store StateStore, bucket string, task *DelayedTask) bool {
+	if err := writer.WriteMessages(ctx, task.message()); err != nil {
+		log.Printf("Error dispatching delayed task %s of run %s, releasing it: %v", task.TaskID, task.RunID, err)
+		if err := store.ReleaseDelayedTask(ctx, bucket, task); err != nil {
+			log.Printf("Error releasing delayed task %s, it's claimed again once its claim expires: %v", task.TaskID, err)
+		}
+		return false
+	}
+	ackDelayedTask(ctx, store, bucket, task)
+	tasksDispatched.WithLabelValues(taskTypeLabel(task.TaskType)).Inc()
+	return true
+}
+
+// ackDelayedTask removes a delayed task once it has left its delay queue. If
+// that fails the task is dispatched again when its claim expires
+func ackDelayedTask(ctx context.Context, store StateStore, bucket string, task *DelayedTask) {
+	if err := store.AckDelayedTask(ctx, bucket, task); err != nil {
+		log.Printf("Error removing dispatched delayed task %s, it may be dispatched again: %v", task.TaskID, err)
+	}
+}
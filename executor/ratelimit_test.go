@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func withDispatchLimits(t *testing.T, limits map[string]dispatchLimit) {
+	previous := dispatchLimits
+	dispatchLimits = limits
+	t.Cleanup(func() { dispatchLimits = previous })
+}
+
+func TestReleaseDelayedTasksKeepsTasksThatFailToBeWritten(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	broker := newFakeKafka()
+	writer := broker.writer("chronos-tasks")
+	ctx := context.Background()
+	limit := dispatchLimit{bucket: "http", rate: 100, burst: 100}
+	for _, id := range []string{"a", "b"} {
+		if err := store.DelayTask(ctx, limit.bucket, deferredTask(id)); err != nil {
+			t.Fatalf("DelayTask: %v", err)
+		}
+	}
+
+	broker.err = errors.New("broker unavailable")
+	releaseDelayedTasks(ctx, writer, store, limit, time.Minute)
+	if count, err := store.CountDelayedTasks(ctx, limit.bucket); err != nil || count != 2 {
+		t.Fatalf("delayed tasks after a failed write = %d, %v, want both kept", count, err)
+	}
+	if letters, _ := store.ListDeadLetters(ctx, "acme", deadLetterSourceTask, 10); len(letters) != 0 {
+		t.Errorf("dead letters = %d, want the task retried instead", len(letters))
+	}
+
+	// The failed task kept its place at the front of the queue
+	broker.err = nil
+	releaseDelayedTasks(ctx, writer, store, limit, time.Minute)
+	produced := broker.produced("chronos-tasks")
+	if len(produced) != 2 || string(produced[0].Value) != string(deferredTask("a").Value) {
+		t.Fatalf("dispatched %d tasks, want a then b", len(produced))
+	}
+	if count, err := store.CountDelayedTasks(ctx, limit.bucket); err != nil || count != 0 {
+		t.Errorf("delayed tasks after dispatch = %d, %v, want none", count, err)
+	}
+}
+
+func TestClaimedDelayedTasksAreClaimedAgainAfterTheirClaimExpires(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	ctx := context.Background()
+	server.SetTime(time.Now())
+	if err := store.DelayTask(ctx, "http", deferredTask("a")); err != nil {
+		t.Fatalf("DelayTask: %v", err)
+	}
+
+	if _, err := store.ClaimDelayedTask(ctx, "http", time.Minute); err != nil {
+		t.Fatalf("ClaimDelayedTask: %v", err)
+	}
+	if _, err := store.ClaimDelayedTask(ctx, "http", time.Minute); !errors.Is(err, errNotFound) {
+		t.Fatalf("second claim error = %v, want errNotFound while the first holds it", err)
+	}
+	if count, _ := store.CountDelayedTasks(ctx, "http"); count != 0 {
+		t.Errorf("claimable tasks = %d, want 0", count)
+	}
+
+	server.SetTime(time.Now().Add(2 * time.Minute))
+	if count, _ := store.CountDelayedTasks(ctx, "http"); count != 1 {
+		t.Errorf("claimable tasks after the claim expired = %d, want 1", count)
+	}
+	task, err := store.ClaimDelayedTask(ctx, "http", time.Minute)
+	if err != nil || task.TaskID != "a" {
+		t.Fatalf("ClaimDelayedTask after the claim expired = %v, %v, want task a", task, err)
+	}
+}
+
+func TestObservedDispatchRate(t *testing.T) {
+	withDispatchLimits(t, map[string]dispatchLimit{
+		"http":  {bucket: "http", rate: 10, burst: 10},
+		"shell": {bucket: "shell", rate: 1, burst: 1},
+	})
+	start := time.Now()
+	previous := dispatchRates
+	dispatchRates = &rateMeter{counts: make(map[string]int), since: start}
+	t.Cleanup(func() { dispatchRates = previous })
+
+	for i := 0; i < 50; i++ {
+		countLimitedDispatch("http")
+	}
+	if rates := dispatchRates.rates(start.Add(time.Second), dispatchRateWindow); rates != nil {
+		t.Fatalf("rates = %v before a full window passed", rates)
+	}
+
+	reportDispatchRates(start.Add(dispatchRateWindow))
+	if got := testutil.ToFloat64(observedDispatchRate.WithLabelValues("http")); got != 5 {
+		t.Errorf("observed http rate = %v, want 5 per second", got)
+	}
+	if got := testutil.ToFloat64(observedDispatchRate.WithLabelValues("shell")); got != 0 {
+		t.Errorf("observed shell rate = %v, want 0", got)
+	}
+}
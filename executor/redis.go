@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+)
+
+// monitorRedis pings Redis periodically, reporting its health through the
+// redis up gauge and logging when it goes down or recovers. The client
+// reconnects on its own; this only makes outages visible
+func monitorRedis(ctx context.Context, redisClient *redis.Client) {
+	ticker := time.NewTicker(viper.GetDuration("REDIS_HEALTH_CHECK_INTERVAL"))
+	defer ticker.Stop()
+
+	up := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, time.Second)
+			err := redisClient.Ping(pingCtx).Err()
+			cancel()
+
+			switch {
+			case err != nil && up:
+				log.Printf("Redis is down: %v", err)
+				redisUp.Set(0)
+			case err == nil && !up:
+				log.Println("Redis has recovered")
+				redisUp.Set(1)
+			}
+			up = err == nil
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// definitionKey is the state store key holding a run's workflow definition
+func definitionKey(tenantID, runID string) string {
+	return tenantKey(tenantID, "definition", runID)
+}
+
+// storeWorkflowDefinition keeps a run's workflow definition for as long as
+// its progress, so the run can be replayed without resubmitting it. The
+// janitor deletes both once the run's retention passes
+func storeWorkflowDefinition(ctx context.Context, store StateStore, workflow *WorkflowMessage) error {
+	definition, err := json.Marshal(workflow)
+	if err != nil {
+		return fmt.Errorf("encoding definition of run %s: %w", workflow.RunID, err)
+	}
+	_, err = store.SetNXWithTTL(ctx, definitionKey(workflow.TenantID, workflow.RunID), string(definition), 0)
+	return err
+}
+
+// loadWorkflowDefinition returns the workflow definition stored for a run
+func loadWorkflowDefinition(ctx context.Context, store StateStore, tenantID, runID string) (*WorkflowMessage, error) {
+	definition, err := store.Get(ctx, definitionKey(tenantID, runID))
+	if err != nil {
+		return nil, err
+	}
+	var workflow WorkflowMessage
+	if err := json.Unmarshal([]byte(definition), &workflow); err != nil {
+		return nil, fmt.Errorf("decoding definition of run %s: %w", runID, err)
+	}
+	return &workflow, nil
+}
+
+// resumableTasks returns the tasks a replay from fromTask resumes rather
+// than executes again: every task except fromTask and those downstream of
+// it. Each of them must have completed in the replayed run
+func resumableTasks(workflow *WorkflowMessage, run *RunState, fromTask string) ([]string, error) {
+	dependents := make(map[string][]string, len(workflow.Tasks))
+	found := false
+	for _, task := range workflow.Tasks {
+		if task.ID == fromTask {
+			found = true
+		}
+		for _, dep := range task.DependsOn {
+			dependents[dep] = append(dependents[dep], task.ID)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("workflow %s has no task %s", workflow.WorkflowID, fromTask)
+	}
+
+	// Walk downstream from fromTask to find the tasks to execute again
+	replayed := map[string]struct{}{fromTask: {}}
+	queue := []string{fromTask}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, dependent := range dependents[id] {
+			if _, ok := replayed[dependent]; !ok {
+				replayed[dependent] = struct{}{}
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	var resumed []string
+	for _, task := range workflow.Tasks {
+		if _, ok := replayed[task.ID]; ok {
+			continue
+		}
+		if state := run.TaskStates[task.ID]; state != taskStateCompleted {
+			return nil, fmt.Errorf("task %s is %s in run %s, so it can't be resumed; replay from it or a task upstream of it",
+				task.ID, state, run.RunID)
+		}
+		resumed = append(resumed, task.ID)
+	}
+	return resumed, nil
+}
+
+// ReplayWorkflow submits a finished run again as a new run linked to the
+// original. With fromTask set, tasks that aren't fromTask or downstream of
+// it are resumed from the original run's results instead of executed again.
+// It returns the new run's ID
+func (s *executorServer) ReplayWorkflow(ctx context.Context, runID, fromTask string) (string, error) {
+	tenant := tenantOrDefault(tenantFromContext(ctx))
+
+	run, err := s.store.GetRun(ctx, tenant, runID)
+	if errors.Is(err, errNotFound) {
+		return "", fmt.Errorf("run %s not found", runID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading run %s: %w", runID, err)
+	}
+	if run.State == runStateRunning {
+		return "", fmt.Errorf("run %s is still running", runID)
+	}
+
+	original, err := loadWorkflowDefinition(ctx, s.store, tenant, runID)
+	if errors.Is(err, errNotFound) {
+		return "", fmt.Errorf("definition of run %s has expired", runID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading definition of run %s: %w", runID, err)
+	}
+
+	replay := *original
+	replay.TenantID = tenant
+	replay.RunID = newRunID()
+	replay.ReplayOf = runID
+	replay.ResumedTasks = nil
+	if fromTask != "" {
+		if replay.ResumedTasks, err = resumableTasks(original, run, fromTask); err != nil {
+			return "", err
+		}
+	}
+
+	results, err := s.SubmitWorkflows(ctx, []*WorkflowMessage{&replay}, false)
+	if err != nil {
+		return "", err
+	}
+	if results[0].Err != nil {
+		return "", results[0].Err
+	}
+
+	// The replay reads the original run, so its retention starts over
+	if err := s.store.RetainRun(ctx, tenant, runID, time.Now().Add(runRetention(run.State))); err != nil {
+		log.Printf("Error extending retention of replayed run %s: %v", runID, err)
+	}
+
+	log.Printf("Replaying run %s of workflow %s as run %s, resuming %d tasks",
+		runID, replay.WorkflowID, replay.RunID, len(replay.ResumedTasks))
+	return replay.RunID, nil
+}
+
+// replayRequest is the JSON body of a replay request
+type replayRequest struct {
+	RunID    string `json:"run_id"`
+	FromTask string `json:"from_task,omitempty"`
+}
+
+// handleReplayWorkflow serves POST /workflows/replay for the tenant named by
+// the X-Chronos-Tenant header or tenant query parameter, responding with the
+// new run's ID
+func (s *executorServer) handleReplayWorkflow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request replayRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("decoding replay request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if request.RunID == "" {
+		http.Error(w, "run_id is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx = withRequestTenant(ctx, r)
+	runID, err := s.ReplayWorkflow(ctx, request.RunID, request.FromTask)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"run_id": runID})
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// replayFixture is an executor whose submitted runs are started by hand, as
+// the workflows consumer would start them
+type replayFixture struct {
+	t      *testing.T
+	store  *redisStore
+	kafka  *fakeKafka
+	tasks  *kafka.Writer
+	server *executorServer
+}
+
+func newReplayFixture(t *testing.T) *replayFixture {
+	store, _ := newTestRedisStore(t)
+	broker := newFakeKafka()
+	tasks := broker.writer("chronos-tasks")
+	return &replayFixture{
+		t:      t,
+		store:  store,
+		kafka:  broker,
+		tasks:  tasks,
+		server: newExecutorServer(broker.writer("chronos-workflows"), tasks, store),
+	}
+}
+
+// startSubmitted starts the run of the last workflow submitted
+func (f *replayFixture) startSubmitted() *WorkflowMessage {
+	f.t.Helper()
+	submitted := f.kafka.produced("chronos-workflows")
+	if len(submitted) == 0 {
+		f.t.Fatal("no workflow submitted")
+	}
+	message := submitted[len(submitted)-1]
+	if err := processWorkflow(context.Background(), message, f.tasks, f.store); err != nil {
+		f.t.Fatalf("processWorkflow: %v", err)
+	}
+	var workflow WorkflowMessage
+	if err := json.Unmarshal(message.Value, &workflow); err != nil {
+		f.t.Fatalf("decoding submitted workflow: %v", err)
+	}
+	return &workflow
+}
+
+// report applies a task result to a run
+func (f *replayFixture) report(workflow *WorkflowMessage, taskID, status string) {
+	f.t.Helper()
+	result := completed(workflow, taskID)
+	result.Status = status
+	if err := advanceRun(context.Background(), f.tasks, f.store, result); err != nil {
+		f.t.Fatalf("advanceRun(%s): %v", taskID, err)
+	}
+}
+
+// dispatchedFor returns the IDs of the tasks dispatched for a run
+func (f *replayFixture) dispatchedFor(runID string) []string {
+	var ids []string
+	for _, message := range f.kafka.produced("chronos-tasks") {
+		var task TaskMessage
+		if err := json.Unmarshal(message.Value, &task); err != nil {
+			f.t.Fatalf("decoding task message: %v", err)
+		}
+		if task.RunID == runID {
+			ids = append(ids, task.TaskID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (f *replayFixture) state(runID string) *RunState {
+	f.t.Helper()
+	run, err := f.store.GetRun(context.Background(), "acme", runID)
+	if err != nil {
+		f.t.Fatalf("GetRun(%s): %v", runID, err)
+	}
+	return run
+}
+
+// failedDiamond runs the diamond workflow until c fails, with a and b
+// completed and d never dispatched
+func (f *replayFixture) failedDiamond() *WorkflowMessage {
+	f.t.Helper()
+	results, err := f.server.SubmitWorkflows(withTenant(context.Background(), "acme"),
+		[]*WorkflowMessage{diamondWorkflow("", "")}, false)
+	if err != nil || results[0].Err != nil {
+		f.t.Fatalf("SubmitWorkflows: %v, %v", err, results[0].Err)
+	}
+	original := f.startSubmitted()
+	f.report(original, "a", taskResultCompleted)
+	f.report(original, "b", taskResultCompleted)
+	f.report(original, "c", taskResultFailed)
+	if got := f.state(original.RunID).State; got != runStateFailed {
+		f.t.Fatalf("original run state = %s, want FAILED", got)
+	}
+	return original
+}
+
+func withTenant(ctx context.Context, tenant string) context.Context {
+	request := httptest.NewRequest(http.MethodPost, "/", nil)
+	request.Header.Set(tenantHeader, tenant)
+	return withRequestTenant(ctx, request)
+}
+
+func TestReplayWorkflowInFull(t *testing.T) {
+	f := newReplayFixture(t)
+	original := f.failedDiamond()
+
+	runID, err := f.server.ReplayWorkflow(withTenant(context.Background(), "acme"), original.RunID, "")
+	if err != nil {
+		t.Fatalf("ReplayWorkflow: %v", err)
+	}
+	replay := f.startSubmitted()
+	if replay.RunID != runID || replay.ReplayOf != original.RunID || len(replay.ResumedTasks) != 0 {
+		t.Fatalf("replay = run %s of %s resuming %v, want run %s of %s resuming nothing",
+			replay.RunID, replay.ReplayOf, replay.ResumedTasks, runID, original.RunID)
+	}
+	if got := f.state(runID).ReplayOf; got != original.RunID {
+		t.Errorf("recorded replay_of = %q, want %q", got, original.RunID)
+	}
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		f.report(replay, id, taskResultCompleted)
+	}
+	if got := strings.Join(f.dispatchedFor(runID), ","); got != "a,b,c,d" {
+		t.Errorf("replay dispatched %s, want every task", got)
+	}
+	if got := f.state(runID).State; got != runStateCompleted {
+		t.Errorf("replay state = %s, want COMPLETED", got)
+	}
+}
+
+func TestReplayWorkflowFromMidDAGTask(t *testing.T) {
+	f := newReplayFixture(t)
+	original := f.failedDiamond()
+
+	runID, err := f.server.ReplayWorkflow(withTenant(context.Background(), "acme"), original.RunID, "c")
+	if err != nil {
+		t.Fatalf("ReplayWorkflow: %v", err)
+	}
+	replay := f.startSubmitted()
+	sort.Strings(replay.ResumedTasks)
+	if got := strings.Join(replay.ResumedTasks, ","); got != "a,b" {
+		t.Fatalf("resumed tasks = %s, want a,b", got)
+	}
+
+	// Only c starts; d follows it, and a and b are never executed again
+	if got := strings.Join(f.dispatchedFor(runID), ","); got != "c" {
+		t.Fatalf("dispatched on start = %s, want c", got)
+	}
+	f.report(replay, "c", taskResultCompleted)
+	if got := strings.Join(f.dispatchedFor(runID), ","); got != "c,d" {
+		t.Fatalf("dispatched after c = %s, want c,d", got)
+	}
+	f.report(replay, "d", taskResultCompleted)
+	if got := f.state(runID).State; got != runStateCompleted {
+		t.Errorf("replay state = %s, want COMPLETED", got)
+	}
+}
+
+func TestReplayWorkflowRejectsUnreplayableRuns(t *testing.T) {
+	f := newReplayFixture(t)
+	original := f.failedDiamond()
+	ctx := withTenant(context.Background(), "acme")
+
+	// d never ran, so the run can't be resumed past it
+	if _, err := f.server.ReplayWorkflow(ctx, original.RunID, "d"); err == nil {
+		t.Error("replayed from d although c never completed")
+	}
+	if _, err := f.server.ReplayWorkflow(ctx, original.RunID, "z"); err == nil {
+		t.Error("replayed from an unknown task")
+	}
+
+	runID, err := f.server.ReplayWorkflow(ctx, original.RunID, "")
+	if err != nil {
+		t.Fatalf("ReplayWorkflow: %v", err)
+	}
+	f.startSubmitted()
+	if _, err := f.server.ReplayWorkflow(ctx, runID, ""); err == nil {
+		t.Error("replayed a run that is still running")
+	}
+	if _, err := f.server.ReplayWorkflow(withTenant(context.Background(), "globex"), original.RunID, ""); err == nil {
+		t.Error("replayed another tenant's run")
+	}
+}
+
+func TestHandleReplayWorkflowReadsTenant(t *testing.T) {
+	f := newReplayFixture(t)
+	original := f.failedDiamond()
+	body := `{"run_id":"` + original.RunID + `","from_task":"c"}`
+
+	for name, request := range map[string]*http.Request{
+		"header": httptest.NewRequest(http.MethodPost, "/workflows/replay", strings.NewReader(body)),
+		"query":  httptest.NewRequest(http.MethodPost, "/workflows/replay?tenant=acme", strings.NewReader(body)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if name == "header" {
+				request.Header.Set(tenantHeader, "acme")
+			}
+			recorder := httptest.NewRecorder()
+			f.server.handleReplayWorkflow(recorder, request)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+			}
+			var response map[string]string
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if response["run_id"] == "" {
+				t.Error("response has no run ID")
+			}
+		})
+	}
+
+	// Without a tenant, the run is looked up under the default tenant
+	recorder := httptest.NewRecorder()
+	f.server.handleReplayWorkflow(recorder, httptest.NewRequest(http.MethodPost, "/workflows/replay", strings.NewReader(body)))
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("status without a tenant = %d, want %d", recorder.Code, http.StatusConflict)
+	}
+}
+
+func TestHandleSubmitWorkflowsReadsTenant(t *testing.T) {
+	f := newReplayFixture(t)
+	body, _ := json.Marshal([]*WorkflowMessage{diamondWorkflow("", "")})
+	request := httptest.NewRequest(http.MethodPost, "/workflows/submit", strings.NewReader(string(body)))
+	request.Header.Set(tenantHeader, "acme")
+
+	recorder := httptest.NewRecorder()
+	f.server.handleSubmitWorkflows(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+	}
+	if got := f.startSubmitted().TenantID; got != "acme" {
+		t.Errorf("submitted tenant = %q, want acme", got)
+	}
+}
+
+func TestHandleListActiveRunsRequiresTenant(t *testing.T) {
+	f := newReplayFixture(t)
+	recordRun(t, f.store, "acme", "run-1", "a")
+	recordRun(t, f.store, "globex", "run-2", "a")
+
+	recorder := httptest.NewRecorder()
+	f.server.handleListActiveRuns(recorder, httptest.NewRequest(http.MethodGet, "/workflows/active", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("status without a tenant = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/workflows/active", nil)
+	request.Header.Set(tenantHeader, "acme")
+	recorder = httptest.NewRecorder()
+	f.server.handleListActiveRuns(recorder, request)
+	var runs []*ActiveRun
+	if err := json.NewDecoder(recorder.Body).Decode(&runs); err != nil {
+		t.Fatalf("decoding runs: %v", err)
+	}
+	if len(runs) != 1 || runs[0].RunID != "run-1" || runs[0].TaskStates["a"] != taskStatePending {
+		t.Errorf("acme runs = %+v, want only run-1", runs)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A run is started by dispatching its ready tasks, and advanced by the
+// results the workers publish onto the results topic: each completed task
+// dispatches the tasks it unblocks, and the run finishes once every task
+// has completed or one has failed. Results are keyed by tenant and
+// workflow like the tasks, so a run's results are consumed in order by a
+// single executor.
+
+// initRunResultsReader creates the reader advancing runs from the results
+// topic. Unlike the circuit breakers' readers, it's shared by every executor
+// so each result advances its run once
+func initRunResultsReader() *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     []string{viper.GetString("KAFKA_BROKERS")},
+		GroupID:     "chronos-executor-runs",
+		Topic:       viper.GetString("KAFKA_TOPIC_RESULTS"),
+		Dialer:      kafkaDialer,
+		StartOffset: kafka.FirstOffset,
+	})
+}
+
+// resultReader is the part of a Kafka reader run results are consumed through
+type resultReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, messages ...kafka.Message) error
+}
+
+// consumeRunResults advances runs on task results until ctx is cancelled. A
+// result is committed once its run has been advanced
+func consumeRunResults(ctx context.Context, reader resultReader, writer *kafka.Writer, store StateStore) {
+	log.Println("Starting Kafka consumer for run results")
+
+	for {
+		message, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Println("Stopping run results consumer")
+				return
+			}
+			log.Printf("Error reading run result: %v", err)
+			continue
+		}
+
+		var result TaskResultMessage
+		if err := json.Unmarshal(message.Value, &result); err != nil {
+			log.Printf("Skipping malformed task result at offset %d: %v", message.Offset, err)
+		} else if !applyRunResult(ctx, writer, store, &result) {
+			log.Println("Stopping run results consumer")
+			return
+		}
+
+		if err := reader.CommitMessages(ctx, message); err != nil && ctx.Err() == nil {
+			log.Printf("Error committing run result at offset %d: %v", message.Offset, err)
+		}
+	}
+}
+
+// applyRunResult advances a result's run, retrying with backoff until it
+// succeeds. Committing a later result commits this one too, and the run's
+// later results depend on it, so a result is never skipped. It returns
+// false when ctx is cancelled first
+func applyRunResult(ctx context.Context, writer *kafka.Writer, store StateStore, result *TaskResultMessage) bool {
+	backoff := time.Second
+	for {
+		err := advanceRun(ctx, writer, store, result)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		log.Printf("Error advancing run %s on task %s, retrying in %s: %v", result.RunID, result.TaskID, backoff, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// advanceRun applies a task's result to its run: a completed task
+// dispatches the tasks it unblocks and completes the run once every task
+// has, and a failed task fails the run. Results of tasks outside a run, of
+// unknown runs, and of finished runs are ignored
+func advanceRun(ctx context.Context, writer *kafka.Writer, store StateStore, result *TaskResultMessage) (err error) {
+	if result.RunID == "" {
+		return nil
+	}
+	tenant := tenantOrDefault(result.TenantID)
+
+	ctx, span := tracer.Start(ctx, "executor.advance_run",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("workflow.run_id", result.RunID),
+			attribute.String("task.id", result.TaskID),
+			attribute.String("task.status", result.Status),
+			attribute.String("tenant.id", tenant),
+		))
+	defer func() { endSpan(span, err) }()
+
+	run, err := store.GetRun(ctx, tenant, result.RunID)
+	if errors.Is(err, errNotFound) {
+		log.Printf("Ignoring result of task %s of unknown run %s", result.TaskID, result.RunID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading run %s: %w", result.RunID, err)
+	}
+	if run.State != runStateRunning {
+		return nil
+	}
+	workflow, err := loadWorkflowDefinition(ctx, store, tenant, result.RunID)
+	if err != nil {
+		return fmt.Errorf("reading definition of run %s: %w", result.RunID, err)
+	}
+	if _, ok := workflow.task(result.TaskID); !ok {
+		log.Printf("Ignoring result of unknown task %s of run %s", result.TaskID, result.RunID)
+		return nil
+	}
+
+	switch result.Status {
+	case taskResultCompleted:
+	case taskResultFailed:
+		if err := recordTaskStates(ctx, store, run, map[string]string{result.TaskID: taskStateFailed}); err != nil {
+			return err
+		}
+		log.Printf("Run %s failed: task %s failed: %s", result.RunID, result.TaskID, result.Error)
+		return finishRun(ctx, store, workflow, runStateFailed)
+	default:
+		log.Printf("Ignoring result of task %s with unknown status %q", result.TaskID, result.Status)
+		return nil
+	}
+
+	run.TaskStates[result.TaskID] = taskStateCompleted
+	unblocked := workflow.unblockedTasks(run.TaskStates)
+	states := map[string]string{result.TaskID: taskStateCompleted}
+	for _, task := range unblocked {
+		states[task.ID] = taskStateRunning
+	}
+	if err := recordTaskStates(ctx, store, run, states); err != nil {
+		return err
+	}
+
+	if len(unblocked) > 0 {
+		if err := dispatchTasks(ctx, writer, store, workflow, unblocked); err != nil {
+			// The tasks go back to pending so the retried result dispatches them
+			reverted := make(map[string]string, len(unblocked))
+			for _, task := range unblocked {
+				reverted[task.ID] = taskStatePending
+			}
+			if err := recordTaskStates(ctx, store, run, reverted); err != nil {
+				log.Printf("Error reverting tasks of run %s to pending: %v", run.RunID, err)
+			}
+			return err
+		}
+		return nil
+	}
+
+	for _, task := range workflow.Tasks {
+		if run.TaskStates[task.ID] != taskStateCompleted {
+			return nil
+		}
+	}
+	return finishRun(ctx, store, workflow, runStateCompleted)
+}
+
+// recordTaskStates records new states of some of a run's tasks
+func recordTaskStates(ctx context.Context, store StateStore, run *RunState, states map[string]string) error {
+	err := store.RecordTransition(ctx, &Transition{
+		TenantID:   run.TenantID,
+		RunID:      run.RunID,
+		TaskStates: states,
+		At:         time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("recording task states of run %s: %w", run.RunID, err)
+	}
+	return nil
+}
+
+// finishRun moves a run to a terminal state and frees its tenant's slot.
+// The workflow event goes out first, so a run whose event couldn't be
+// published is still running and publishes it again when retried
+func finishRun(ctx context.Context, store StateStore, workflow *WorkflowMessage, state string) error {
+	tenant := tenantOrDefault(workflow.TenantID)
+	if err := publishWorkflowEvent(ctx, workflow, state, time.Now()); err != nil {
+		return err
+	}
+	if err := recordWorkflowFinished(ctx, store, tenant, workflow.RunID, state); err != nil {
+		return fmt.Errorf("recording %s run %s: %w", state, workflow.RunID, err)
+	}
+	releaseWorkflowSlot(ctx, store, tenant, workflow.RunID)
+	log.Printf("Run %s of workflow %s %s", workflow.RunID, workflow.WorkflowID, state)
+	return nil
+}
+
+// task returns the workflow's task with the given ID
+func (w *WorkflowMessage) task(id string) (TaskSpec, bool) {
+	for _, task := range w.Tasks {
+		if task.ID == id {
+			return task, true
+		}
+	}
+	return TaskSpec{}, false
+}
+
+// unblockedTasks returns the pending tasks whose dependencies have all
+// completed, given the states of the run's tasks
+func (w *WorkflowMessage) unblockedTasks(states map[string]string) []TaskSpec {
+	var unblocked []TaskSpec
+	for _, task := range w.Tasks {
+		if states[task.ID] != taskStatePending {
+			continue
+		}
+		ready := true
+		for _, dep := range task.DependsOn {
+			if states[dep] != taskStateCompleted {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			unblocked = append(unblocked, task)
+		}
+	}
+	return unblocked
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/segmentio/kafka-go"
+)
+
+// newTestRedisStore returns a Redis state store backed by an in-memory server
+func newTestRedisStore(t *testing.T) (*redisStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return newRedisStore(client), server
+}
+
+// startRun processes a workflow message as the workflows consumer does
+func startRun(t *testing.T, writer *kafka.Writer, store StateStore, workflow *WorkflowMessage) {
+	t.Helper()
+	value, err := json.Marshal(workflow)
+	if err != nil {
+		t.Fatalf("encoding workflow: %v", err)
+	}
+	if err := processWorkflow(context.Background(), kafka.Message{Value: value}, writer, store); err != nil {
+		t.Fatalf("processWorkflow: %v", err)
+	}
+}
+
+func dispatchedTaskIDs(t *testing.T, messages []kafka.Message) []string {
+	t.Helper()
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		var task TaskMessage
+		if err := json.Unmarshal(message.Value, &task); err != nil {
+			t.Fatalf("decoding task message: %v", err)
+		}
+		ids = append(ids, task.TaskID)
+	}
+	return ids
+}
+
+func diamondWorkflow(tenantID, runID string) *WorkflowMessage {
+	return &WorkflowMessage{
+		WorkflowID: "wf-diamond",
+		RunID:      runID,
+		TenantID:   tenantID,
+		Name:       "diamond",
+		Tasks: []TaskSpec{
+			{ID: "a", Type: "http"},
+			{ID: "b", Type: "http", DependsOn: []string{"a"}},
+			{ID: "c", Type: "http", DependsOn: []string{"a"}},
+			{ID: "d", Type: "http", DependsOn: []string{"b", "c"}},
+		},
+	}
+}
+
+func completed(workflow *WorkflowMessage, taskID string) *TaskResultMessage {
+	return &TaskResultMessage{
+		TaskID:     taskID,
+		RunID:      workflow.RunID,
+		WorkflowID: workflow.WorkflowID,
+		TenantID:   workflow.TenantID,
+		TaskType:   "http",
+		Status:     taskResultCompleted,
+	}
+}
+
+func TestRunCompletesFromTaskResults(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	kafkaBroker := newFakeKafka()
+	writer := kafkaBroker.writer("chronos-tasks")
+	ctx := context.Background()
+	workflow := diamondWorkflow("acme", "run-1")
+
+	startRun(t, writer, store, workflow)
+	if got := dispatchedTaskIDs(t, kafkaBroker.produced("chronos-tasks")); strings.Join(got, ",") != "a" {
+		t.Fatalf("dispatched on start = %v, want [a]", got)
+	}
+
+	if err := advanceRun(ctx, writer, store, completed(workflow, "a")); err != nil {
+		t.Fatalf("advanceRun(a): %v", err)
+	}
+	if got := dispatchedTaskIDs(t, kafkaBroker.produced("chronos-tasks")); strings.Join(got, ",") != "a,b,c" {
+		t.Fatalf("dispatched after a = %v, want [a b c]", got)
+	}
+
+	// d waits for both of its dependencies
+	if err := advanceRun(ctx, writer, store, completed(workflow, "b")); err != nil {
+		t.Fatalf("advanceRun(b): %v", err)
+	}
+	if got := len(kafkaBroker.produced("chronos-tasks")); got != 3 {
+		t.Fatalf("dispatched after b = %d tasks, want d held back for c", got)
+	}
+	if err := advanceRun(ctx, writer, store, completed(workflow, "c")); err != nil {
+		t.Fatalf("advanceRun(c): %v", err)
+	}
+	if got := dispatchedTaskIDs(t, kafkaBroker.produced("chronos-tasks")); strings.Join(got, ",") != "a,b,c,d" {
+		t.Fatalf("dispatched after c = %v, want [a b c d]", got)
+	}
+
+	run, err := store.GetRun(ctx, "acme", "run-1")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.State != runStateRunning {
+		t.Fatalf("state before the last task = %s, want RUNNING", run.State)
+	}
+
+	if err := advanceRun(ctx, writer, store, completed(workflow, "d")); err != nil {
+		t.Fatalf("advanceRun(d): %v", err)
+	}
+	run, err = store.GetRun(ctx, "acme", "run-1")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.State != runStateCompleted {
+		t.Errorf("state after every task completed = %s, want COMPLETED", run.State)
+	}
+	for id, state := range run.TaskStates {
+		if state != taskStateCompleted {
+			t.Errorf("task %s state = %s, want COMPLETED", id, state)
+		}
+	}
+	if active, _ := store.client.SCard(ctx, tenantKey("acme", "active")).Result(); active != 0 {
+		t.Errorf("active runs of acme = %d, want the completed run's slot released", active)
+	}
+}
+
+func TestRunFailsOnFailedTask(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	kafkaBroker := newFakeKafka()
+	writer := kafkaBroker.writer("chronos-tasks")
+	ctx := context.Background()
+	workflow := diamondWorkflow("acme", "run-1")
+	startRun(t, writer, store, workflow)
+
+	failed := completed(workflow, "a")
+	failed.Status = taskResultFailed
+	failed.Error = "connection refused"
+	if err := advanceRun(ctx, writer, store, failed); err != nil {
+		t.Fatalf("advanceRun: %v", err)
+	}
+
+	run, err := store.GetRun(ctx, "acme", "run-1")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.State != runStateFailed {
+		t.Errorf("state = %s, want FAILED", run.State)
+	}
+	if run.TaskStates["a"] != taskStateFailed {
+		t.Errorf("task a state = %s, want FAILED", run.TaskStates["a"])
+	}
+	if active, _ := store.client.SCard(ctx, tenantKey("acme", "active")).Result(); active != 0 {
+		t.Errorf("active runs of acme = %d, want the failed run's slot released", active)
+	}
+
+	// A late result of a finished run changes nothing
+	if err := advanceRun(ctx, writer, store, completed(workflow, "a")); err != nil {
+		t.Fatalf("advanceRun after the run failed: %v", err)
+	}
+	if got := len(kafkaBroker.produced("chronos-tasks")); got != 1 {
+		t.Errorf("dispatched tasks = %d, want none after the run failed", got)
+	}
+}
+
+func TestAdvanceRunRevertsTasksItCouldNotDispatch(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	kafkaBroker := newFakeKafka()
+	writer := kafkaBroker.writer("chronos-tasks")
+	ctx := context.Background()
+	workflow := diamondWorkflow("acme", "run-1")
+	startRun(t, writer, store, workflow)
+
+	kafkaBroker.err = kafka.LeaderNotAvailable
+	if err := advanceRun(ctx, writer, store, completed(workflow, "a")); err == nil {
+		t.Fatal("advanceRun succeeded without dispatching the unblocked tasks")
+	}
+	run, err := store.GetRun(ctx, "acme", "run-1")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.TaskStates["b"] != taskStatePending || run.TaskStates["c"] != taskStatePending {
+		t.Fatalf("task states = %v, want b and c back to PENDING", run.TaskStates)
+	}
+
+	// The redelivered result dispatches them
+	kafkaBroker.err = nil
+	if err := advanceRun(ctx, writer, store, completed(workflow, "a")); err != nil {
+		t.Fatalf("advanceRun on redelivery: %v", err)
+	}
+	if got := dispatchedTaskIDs(t, kafkaBroker.produced("chronos-tasks")); strings.Join(got, ",") != "a,b,c" {
+		t.Errorf("dispatched = %v, want [a b c]", got)
+	}
+}
+
+func TestTenantStateIsIsolatedInRedis(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	kafkaBroker := newFakeKafka()
+	writer := kafkaBroker.writer("chronos-tasks")
+	ctx := context.Background()
+	setConfig(t, "TENANT_MAX_CONCURRENT_WORKFLOWS", 1)
+
+	// Both tenants use the same run ID
+	acme := diamondWorkflow("acme", "run-1")
+	globex := diamondWorkflow("globex", "run-1")
+	startRun(t, writer, store, acme)
+	startRun(t, writer, store, globex)
+
+	for _, key := range server.Keys() {
+		if !strings.HasPrefix(key, "chronos:tenant:acme:") && !strings.HasPrefix(key, "chronos:tenant:globex:") {
+			t.Errorf("key %q is not namespaced by tenant", key)
+		}
+	}
+
+	// acme's cap doesn't count globex's run, and is enforced
+	value, _ := json.Marshal(diamondWorkflow("acme", "run-2"))
+	if err := processWorkflow(ctx, kafka.Message{Value: value}, writer, store); err == nil {
+		t.Error("acme started a second run over its limit of 1")
+	}
+
+	// Completing acme's run leaves globex's untouched
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := advanceRun(ctx, writer, store, completed(acme, id)); err != nil {
+			t.Fatalf("advanceRun(%s): %v", id, err)
+		}
+	}
+	acmeRun, err := store.GetRun(ctx, "acme", "run-1")
+	if err != nil {
+		t.Fatalf("GetRun(acme): %v", err)
+	}
+	globexRun, err := store.GetRun(ctx, "globex", "run-1")
+	if err != nil {
+		t.Fatalf("GetRun(globex): %v", err)
+	}
+	if acmeRun.State != runStateCompleted {
+		t.Errorf("acme run state = %s, want COMPLETED", acmeRun.State)
+	}
+	if globexRun.State != runStateRunning || globexRun.TaskStates["a"] != taskStateRunning {
+		t.Errorf("globex run = %s with tasks %v, want RUNNING with only a dispatched", globexRun.State, globexRun.TaskStates)
+	}
+	if members, _ := store.client.SMembers(ctx, tenantKey("globex", "active")).Result(); len(members) != 1 {
+		t.Errorf("active runs of globex = %v, want [run-1]", members)
+	}
+
+	// With its slot released, acme can start another run
+	if err := processWorkflow(ctx, kafka.Message{Value: value}, writer, store); err != nil {
+		t.Errorf("acme could not start a run after its first completed: %v", err)
+	}
+
+	// A result naming the wrong tenant doesn't reach the other tenant's run
+	stray := completed(globex, "a")
+	stray.TenantID = "initech"
+	if err := advanceRun(ctx, writer, store, stray); err != nil {
+		t.Fatalf("advanceRun: %v", err)
+	}
+	if globexRun, _ = store.GetRun(ctx, "globex", "run-1"); globexRun.TaskStates["a"] != taskStateRunning {
+		t.Errorf("globex task a = %s after another tenant's result, want RUNNING", globexRun.TaskStates["a"])
+	}
+}
+
+// durationSamples returns how many run durations were observed for a
+// terminal state and workflow name
+func durationSamples(t *testing.T, state, name string) uint64 {
+	t.Helper()
+	metric := &dto.Metric{}
+	if err := workflowDuration.WithLabelValues(state, name).(prometheus.Metric).Write(metric); err != nil {
+		t.Fatalf("reading workflow duration: %v", err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestWorkflowDurationObservedOnEveryTerminalState(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	kafkaBroker := newFakeKafka()
+	writer := kafkaBroker.writer("chronos-tasks")
+	ctx := context.Background()
+	completedBefore := durationSamples(t, runStateCompleted, "diamond")
+	failedBefore := durationSamples(t, runStateFailed, "diamond")
+
+	succeeding := diamondWorkflow("acme", "run-1")
+	startRun(t, writer, store, succeeding)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := advanceRun(ctx, writer, store, completed(succeeding, id)); err != nil {
+			t.Fatalf("advanceRun(%s): %v", id, err)
+		}
+	}
+	if got := durationSamples(t, runStateCompleted, "diamond") - completedBefore; got != 1 {
+		t.Errorf("COMPLETED durations observed = %d, want 1", got)
+	}
+
+	failing := diamondWorkflow("acme", "run-2")
+	startRun(t, writer, store, failing)
+	failed := completed(failing, "a")
+	failed.Status = taskResultFailed
+	if err := advanceRun(ctx, writer, store, failed); err != nil {
+		t.Fatalf("advanceRun: %v", err)
+	}
+	if got := durationSamples(t, runStateFailed, "diamond") - failedBefore; got != 1 {
+		t.Errorf("FAILED durations observed = %d, want 1", got)
+	}
+
+	// A run failing to dispatch is a terminal transition too
+	kafkaBroker.err = kafka.LeaderNotAvailable
+	value, _ := json.Marshal(diamondWorkflow("acme", "run-3"))
+	if err := processWorkflow(ctx, kafka.Message{Value: value}, writer, store); err == nil {
+		t.Fatal("processWorkflow succeeded without dispatching")
+	}
+	if got := durationSamples(t, runStateFailed, "diamond") - failedBefore; got != 2 {
+		t.Errorf("FAILED durations observed = %d, want 2 with the undispatched run", got)
+	}
+}
+
+// queuedResults is a results reader serving a fixed set of messages, then
+// blocking until ctx is cancelled
+type queuedResults struct {
+	messages  []kafka.Message
+	committed []int64
+}
+
+func (q *queuedResults) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(q.messages) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	message := q.messages[0]
+	q.messages = q.messages[1:]
+	return message, nil
+}
+
+func (q *queuedResults) CommitMessages(ctx context.Context, messages ...kafka.Message) error {
+	for _, message := range messages {
+		q.committed = append(q.committed, message.Offset)
+	}
+	return nil
+}
+
+func TestConsumeRunResultsDoesNotCommitUnappliedResults(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	kafkaBroker := newFakeKafka()
+	writer := kafkaBroker.writer("chronos-tasks")
+	workflow := diamondWorkflow("acme", "run-1")
+	startRun(t, writer, store, workflow)
+
+	value, _ := json.Marshal(completed(workflow, "a"))
+	reader := &queuedResults{messages: []kafka.Message{
+		{Offset: 1, Value: []byte("not json")},
+		{Offset: 2, Value: value},
+	}}
+
+	// b and c can't be dispatched, so the result of a is retried until the
+	// consumer stops, and never committed
+	kafkaBroker.err = kafka.LeaderNotAvailable
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		consumeRunResults(ctx, reader, writer, store)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	if len(reader.committed) != 1 || reader.committed[0] != 1 {
+		t.Errorf("committed offsets = %v, want only the malformed result at 1", reader.committed)
+	}
+}
+
+func withEventsWriter(t *testing.T, writer *kafka.Writer) {
+	previous := eventsWriter
+	eventsWriter = writer
+	t.Cleanup(func() { eventsWriter = previous })
+}
+
+func TestFinishedRunsPublishWorkflowEvents(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	kafkaBroker := newFakeKafka()
+	writer := kafkaBroker.writer("chronos-tasks")
+	withEventsWriter(t, kafkaBroker.writer("chronos-workflow-events"))
+	ctx := context.Background()
+
+	workflow := diamondWorkflow("acme", "run-1")
+	workflow.ScheduleID = "schedule-ingest"
+	startRun(t, writer, store, workflow)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := advanceRun(ctx, writer, store, completed(workflow, id)); err != nil {
+			t.Fatalf("advanceRun(%s): %v", id, err)
+		}
+	}
+	if got := len(kafkaBroker.produced("chronos-workflow-events")); got != 0 {
+		t.Fatalf("events before the run finished = %d, want 0", got)
+	}
+
+	// An event that can't be published keeps the run going, to publish it
+	// again when the result is retried
+	kafkaBroker.err = kafka.LeaderNotAvailable
+	if err := advanceRun(ctx, writer, store, completed(workflow, "d")); err == nil {
+		t.Fatal("advanceRun finished the run without publishing its event")
+	}
+	if run, _ := store.GetRun(ctx, "acme", "run-1"); run.State != runStateRunning {
+		t.Fatalf("state after the event failed = %s, want RUNNING", run.State)
+	}
+	kafkaBroker.err = nil
+	if err := advanceRun(ctx, writer, store, completed(workflow, "d")); err != nil {
+		t.Fatalf("advanceRun(d): %v", err)
+	}
+
+	events := kafkaBroker.produced("chronos-workflow-events")
+	if len(events) != 1 {
+		t.Fatalf("events = %d, want 1", len(events))
+	}
+	var event WorkflowEvent
+	if err := json.Unmarshal(events[0].Value, &event); err != nil {
+		t.Fatalf("decoding event: %v", err)
+	}
+	want := WorkflowEvent{
+		WorkflowID: "wf-diamond",
+		RunID:      "run-1",
+		TenantID:   "acme",
+		ScheduleID: "schedule-ingest",
+		State:      runStateCompleted,
+	}
+	if event.CompletedAt.IsZero() {
+		t.Error("event has no completion time")
+	}
+	event.CompletedAt = time.Time{}
+	if event != want {
+		t.Errorf("event = %+v, want %+v", event, want)
+	}
+	if got := string(events[0].Key); got != "acme/wf-diamond" {
+		t.Errorf("event key = %q, want acme/wf-diamond", got)
+	}
+}
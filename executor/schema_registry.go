@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaRegistry is a minimal client for a Confluent-compatible schema
+// registry. Registered IDs and fetched schemas are cached, since both are
+// immutable once assigned
+type schemaRegistry struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	ids     map[string]int
+	schemas map[int]string
+}
+
+func newSchemaRegistry(registryURL string, timeout time.Duration) *schemaRegistry {
+	return &schemaRegistry{
+		url:     strings.TrimSuffix(registryURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+		ids:     make(map[string]int),
+		schemas: make(map[int]string),
+	}
+}
+
+// register registers a schema under a subject, returning its ID
+func (r *schemaRegistry) register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	cacheKey := subject + "\x00" + schema
+	r.mu.Lock()
+	id, ok := r.ids[cacheKey]
+	r.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"schemaType": schemaType, "schema": schema})
+	if err != nil {
+		return 0, err
+	}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", body, &resp); err != nil {
+		return 0, fmt.Errorf("registering schema for %s: %w", subject, err)
+	}
+
+	r.mu.Lock()
+	r.ids[cacheKey] = resp.ID
+	r.schemas[resp.ID] = schema
+	r.mu.Unlock()
+	return resp.ID, nil
+}
+
+// schemaByID fetches the schema a message was written with
+func (r *schemaRegistry) schemaByID(ctx context.Context, id int) (string, error) {
+	r.mu.Lock()
+	schema, ok := r.schemas[id]
+	r.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	var resp struct {
+		Schema string `json:"schema"`
+	}
+	if err := r.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return "", fmt.Errorf("fetching schema %d: %w", id, err)
+	}
+
+	r.mu.Lock()
+	r.schemas[id] = resp.Schema
+	r.mu.Unlock()
+	return resp.Schema, nil
+}
+
+func (r *schemaRegistry) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("schema registry returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Confluent wire format: a zero magic byte and a big-endian schema ID ahead
+// of the payload. Protobuf payloads also carry the index of the message
+// within its schema; the executor's messages are always the first, which is
+// encoded as a single zero byte
+const wireMagic = 0
+
+var errBadFraming = errors.New("message is not in schema registry wire format")
+
+func frame(schemaID int, protobuf bool, payload []byte) []byte {
+	out := make([]byte, 5, 6+len(payload))
+	out[0] = wireMagic
+	binary.BigEndian.PutUint32(out[1:5], uint32(schemaID))
+	if protobuf {
+		out = append(out, 0)
+	}
+	return append(out, payload...)
+}
+
+func unframe(data []byte, protobuf bool) (int, []byte, error) {
+	if len(data) < 5 || data[0] != wireMagic {
+		return 0, nil, errBadFraming
+	}
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+	payload := data[5:]
+	if protobuf {
+		// Skip the message index array: a count followed by that many indexes
+		count, n := binary.Varint(payload)
+		if n <= 0 || count < 0 {
+			return 0, nil, errBadFraming
+		}
+		payload = payload[n:]
+		for i := int64(0); i < count; i++ {
+			if _, n = binary.Varint(payload); n <= 0 {
+				return 0, nil, errBadFraming
+			}
+			payload = payload[n:]
+		}
+	}
+	return id, payload, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import "github.com/segmentio/kafka-go"
+
+// executorServer implements the executor gRPC service
+type executorServer struct {
+	// submitWriter publishes submitted workflows onto the workflows topic,
+	// where the consumer picks them up like any other run
+	submitWriter *kafka.Writer
+	// taskWriter publishes onto the tasks topic, for redriving dead-lettered tasks
+	taskWriter *kafka.Writer
+	// store records when each run was submitted and holds the DLQ
+	store StateStore
+}
+
+// newExecutorServer creates an executor server that submits workflows through the given writer
+func newExecutorServer(submitWriter, taskWriter *kafka.Writer, store StateStore) *executorServer {
+	return &executorServer{submitWriter: submitWriter, taskWriter: taskWriter, store: store}
+}
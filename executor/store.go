@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// errNotFound is returned by StateStore.Get for missing or expired keys
+var errNotFound = errors.New("not found")
+
+// errDeadLetterClaimed is returned by StateStore.ClaimDeadLetter for an entry
+// another redrive has claimed
+var errDeadLetterClaimed = errors.New("dead letter already claimed")
+
+// StateStore persists the executor's dedup keys and run state. Redis is the
+// default; Postgres is available for deployments without Redis
+type StateStore interface {
+	// SetNXWithTTL sets key to value unless it already holds an unexpired
+	// value, reporting whether it was set. A zero ttl keeps the value until
+	// it's deleted
+	SetNXWithTTL(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// Get returns the value of key, or errNotFound
+	Get(ctx context.Context, key string) (string, error)
+	// Delete removes key
+	Delete(ctx context.Context, key string) error
+	// RecordTransition records a change of a run's state or of its tasks' states
+	RecordTransition(ctx context.Context, transition *Transition) error
+	// AddActive marks a run as active for its tenant and returns how many
+	// runs the tenant now has active
+	AddActive(ctx context.Context, tenantID, runID string) (int64, error)
+	// RemoveActive marks a run as no longer active
+	RemoveActive(ctx context.Context, tenantID, runID string) error
+	// GetRun returns the state of a run, or errNotFound
+	GetRun(ctx context.Context, tenantID, runID string) (*RunState, error)
+	// ListActive returns the state of a tenant's active runs
+	ListActive(ctx context.Context, tenantID string) ([]*RunState, error)
+	// RetainRun keeps a finished run's state until at least until, after
+	// which it's due for cleanup. It never brings a run's cleanup forward
+	RetainRun(ctx context.Context, tenantID, runID string, until time.Time) error
+	// PopExpiredRuns removes and returns up to limit runs whose retention
+	// has passed, the longest expired first
+	PopExpiredRuns(ctx context.Context, limit int) ([]ExpiredRun, error)
+	// DeleteRun removes a run's state and history, reporting whether it
+	// did. Active and running runs are never removed
+	DeleteRun(ctx context.Context, tenantID, runID string) (bool, error)
+	// AddDeadLetter adds an entry to the DLQ
+	AddDeadLetter(ctx context.Context, entry *DeadLetter) error
+	// ListDeadLetters returns up to limit of a tenant's DLQ entries from
+	// source, or from every source when source is empty, oldest first
+	ListDeadLetters(ctx context.Context, tenantID, source string, limit int) ([]*DeadLetter, error)
+	// ClaimDeadLetter claims one of a tenant's DLQ entries for timeout while
+	// it's redriven. It returns errNotFound for a missing entry or another
+	// tenant's, and errDeadLetterClaimed while another claim is unexpired
+	ClaimDeadLetter(ctx context.Context, tenantID, id string, timeout time.Duration) (*DeadLetter, error)
+	// ReleaseDeadLetter gives up the claim on a DLQ entry
+	ReleaseDeadLetter(ctx context.Context, tenantID, id string) error
+	// DeleteDeadLetter removes one of a tenant's DLQ entries
+	DeleteDeadLetter(ctx context.Context, tenantID, id string) error
+	// CountDeadLetters returns the number of DLQ entries by source
+	CountDeadLetters(ctx context.Context) (map[string]int64, error)
+	// TakeToken takes a token from a dispatch rate limit's bucket, refilled
+	// at rate tokens per second up to burst, reporting whether one was left
+	TakeToken(ctx context.Context, bucket string, rate float64, burst int) (bool, error)
+	// DelayTask appends a task to a bucket's delay queue
+	DelayTask(ctx context.Context, bucket string, task *DelayedTask) error
+	// ClaimDelayedTask claims the oldest task in a bucket's delay queue for
+	// timeout, or returns errNotFound when there's none left to claim. A
+	// task that is never acked or released is claimed again once its claim
+	// expires
+	ClaimDelayedTask(ctx context.Context, bucket string, timeout time.Duration) (*DelayedTask, error)
+	// AckDelayedTask removes a claimed task once it has been dispatched
+	AckDelayedTask(ctx context.Context, bucket string, task *DelayedTask) error
+	// ReleaseDelayedTask gives up the claim on a task that couldn't be
+	// dispatched, returning it to the front of its delay queue
+	ReleaseDelayedTask(ctx context.Context, bucket string, task *DelayedTask) error
+	// CountDelayedTasks returns the number of tasks in a bucket's delay queue
+	// that can be claimed
+	CountDelayedTasks(ctx context.Context, bucket string) (int64, error)
+	// DeferTask holds a task until delay has passed by the store's clock
+	DeferTask(ctx context.Context, task *DelayedTask, delay time.Duration) error
+	// ClaimDueTasks claims up to limit deferred tasks that are due, the
+	// earliest first, for timeout. A claimed task isn't handed out again
+	// until its claim expires, so one that is never acked or released, as
+	// when its executor crashes, is claimed again
+	ClaimDueTasks(ctx context.Context, limit int, timeout time.Duration) ([]*DelayedTask, error)
+	// AckDeferredTask removes a claimed task once it has been dispatched
+	AckDeferredTask(ctx context.Context, task *DelayedTask) error
+	// ReleaseDeferredTask gives up the claim on a task that couldn't be
+	// dispatched, leaving it due to be claimed again
+	ReleaseDeferredTask(ctx context.Context, task *DelayedTask) error
+	// CountDeferredTasks returns the number of deferred tasks not yet due
+	// or not yet dispatched
+	CountDeferredTasks(ctx context.Context) (int64, error)
+	// Ping checks that the store is reachable
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Transition is a change of a run's state or of some of its tasks' states.
+// Empty fields leave the recorded values untouched
+type Transition struct {
+	TenantID   string
+	RunID      string
+	WorkflowID string
+	Name       string
+	Labels     map[string]string
+	// State is the run's new state
+	State string
+	// TaskStates maps task IDs to their new states
+	TaskStates map[string]string
+	// ReplayOf is the run this run replays, recorded for audit
+	ReplayOf string
+	// SubmittedAt is when the run was submitted, recorded once before it starts
+	SubmittedAt time.Time
+	StartedAt   time.Time
+	At          time.Time
+}
+
+// ExpiredRun identifies a finished run whose retention has passed
+type ExpiredRun struct {
+	TenantID string `json:"tenant_id"`
+	RunID    string `json:"run_id"`
+}
+
+// RunState is the recorded state of a workflow run
+type RunState struct {
+	TenantID    string
+	RunID       string
+	WorkflowID  string
+	Name        string
+	Labels      map[string]string
+	State       string
+	TaskStates  map[string]string
+	ReplayOf    string
+	SubmittedAt time.Time
+	StartedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// submittedAt returns when the run was submitted. Runs published straight
+// onto the workflows topic are never submitted through the executor, so
+// their start time stands in
+func (r *RunState) submittedAt() time.Time {
+	if r.SubmittedAt.IsZero() {
+		return r.StartedAt
+	}
+	return r.SubmittedAt
+}
+
+// initStateStore connects to the state store selected by STATE_STORE
+func initStateStore() (StateStore, error) {
+	switch backend := viper.GetString("STATE_STORE"); backend {
+	case "redis":
+		client, err := initRedis()
+		if err != nil {
+			return nil, err
+		}
+		return newRedisStore(client), nil
+	case "postgres":
+		return newPostgresStore(viper.GetString("DATABASE_URL"))
+	default:
+		return nil, fmt.Errorf("unknown state store %q, expected redis or postgres", backend)
+	}
+}
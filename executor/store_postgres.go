@@ -0,0 +1,689 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresSchema creates the executor's tables. Transitions are kept as an
+// append-only history alongside the latest run and task states
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS executor_kv (
+	key        TEXT PRIMARY KEY,
+	value      TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS executor_runs (
+	tenant_id   TEXT NOT NULL,
+	run_id      TEXT NOT NULL,
+	workflow_id TEXT NOT NULL DEFAULT '',
+	name        TEXT NOT NULL DEFAULT '',
+	labels      JSONB NOT NULL DEFAULT '{}',
+	state       TEXT NOT NULL DEFAULT '',
+	active      BOOLEAN NOT NULL DEFAULT FALSE,
+	started_at  TIMESTAMPTZ,
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, run_id)
+);
+ALTER TABLE executor_runs ADD COLUMN IF NOT EXISTS submitted_at TIMESTAMPTZ;
+ALTER TABLE executor_runs ADD COLUMN IF NOT EXISTS replay_of TEXT NOT NULL DEFAULT '';
+ALTER TABLE executor_runs ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS executor_runs_active ON executor_runs (tenant_id) WHERE active;
+CREATE INDEX IF NOT EXISTS executor_runs_expires_at ON executor_runs (expires_at) WHERE expires_at IS NOT NULL;
+CREATE TABLE IF NOT EXISTS executor_task_states (
+	tenant_id  TEXT NOT NULL,
+	run_id     TEXT NOT NULL,
+	task_id    TEXT NOT NULL,
+	state      TEXT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tenant_id, run_id, task_id)
+);
+CREATE TABLE IF NOT EXISTS executor_dead_letters (
+	id        TEXT PRIMARY KEY,
+	source    TEXT NOT NULL,
+	entry     JSONB NOT NULL,
+	failed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS executor_dead_letters_failed_at ON executor_dead_letters (source, failed_at);
+ALTER TABLE executor_dead_letters ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE executor_dead_letters ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS executor_dead_letters_tenant ON executor_dead_letters (tenant_id, source, failed_at);
+CREATE TABLE IF NOT EXISTS executor_rate_buckets (
+	bucket     TEXT PRIMARY KEY,
+	tokens     DOUBLE PRECISION NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS executor_delayed_tasks (
+	id         BIGSERIAL PRIMARY KEY,
+	bucket     TEXT NOT NULL,
+	task       JSONB NOT NULL,
+	delayed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS executor_delayed_tasks_bucket ON executor_delayed_tasks (bucket, id);
+CREATE TABLE IF NOT EXISTS executor_deferred_tasks (
+	id     BIGSERIAL PRIMARY KEY,
+	task   JSONB NOT NULL,
+	due_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS executor_deferred_tasks_due_at ON executor_deferred_tasks (due_at);
+ALTER TABLE executor_delayed_tasks ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
+ALTER TABLE executor_deferred_tasks ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
+CREATE TABLE IF NOT EXISTS executor_transitions (
+	id        BIGSERIAL PRIMARY KEY,
+	tenant_id TEXT NOT NULL,
+	run_id    TEXT NOT NULL,
+	task_id   TEXT NOT NULL DEFAULT '',
+	state     TEXT NOT NULL,
+	at        TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS executor_transitions_run ON executor_transitions (tenant_id, run_id);
+`
+
+// postgresStore keeps run state in Postgres
+type postgresStore struct {
+	db *sql.DB
+}
+
+// newPostgresStore connects to Postgres and creates the executor's tables
+func newPostgresStore(databaseURL string) (*postgresStore, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("opening Postgres: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to Postgres: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating executor tables: %w", err)
+	}
+
+	return &postgresStore{db: db}, nil
+}
+
+func (s *postgresStore) SetNXWithTTL(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	// An expired row counts as absent, so it is overwritten in place
+	row := s.db.QueryRowContext(ctx, `
+		INSERT INTO executor_kv (key, value, expires_at)
+		VALUES ($1, $2, CASE WHEN $3 > 0 THEN now() + $3 * interval '1 millisecond' ELSE 'infinity' END)
+		ON CONFLICT (key) DO UPDATE
+			SET value = excluded.value, expires_at = excluded.expires_at
+			WHERE executor_kv.expires_at <= now()
+		RETURNING key`,
+		key, value, ttl.Milliseconds())
+
+	var inserted string
+	err := row.Scan(&inserted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *postgresStore) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT value FROM executor_kv WHERE key = $1 AND expires_at > now()`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errNotFound
+	}
+	return value, err
+}
+
+func (s *postgresStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM executor_kv WHERE key = $1`, key)
+	return err
+}
+
+func (s *postgresStore) RecordTransition(ctx context.Context, t *Transition) error {
+	tenant := tenantOrDefault(t.TenantID)
+	var labels []byte
+	if t.Labels != nil {
+		var err error
+		if labels, err = json.Marshal(t.Labels); err != nil {
+			return fmt.Errorf("encoding labels for run %s: %w", t.RunID, err)
+		}
+	}
+	var submittedAt, startedAt sql.NullTime
+	if !t.SubmittedAt.IsZero() {
+		submittedAt = sql.NullTime{Time: t.SubmittedAt, Valid: true}
+	}
+	if !t.StartedAt.IsZero() {
+		startedAt = sql.NullTime{Time: t.StartedAt, Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO executor_runs (tenant_id, run_id, workflow_id, name, labels, state, replay_of, submitted_at, started_at, updated_at)
+		VALUES ($1, $2, $3, $4, COALESCE($5::jsonb, '{}'), $6, $7, $8, $9, $10)
+		ON CONFLICT (tenant_id, run_id) DO UPDATE SET
+			workflow_id = COALESCE(NULLIF(excluded.workflow_id, ''), executor_runs.workflow_id),
+			name        = COALESCE(NULLIF(excluded.name, ''), executor_runs.name),
+			labels      = CASE WHEN $5::jsonb IS NULL THEN executor_runs.labels ELSE excluded.labels END,
+			state       = COALESCE(NULLIF(excluded.state, ''), executor_runs.state),
+			replay_of   = COALESCE(NULLIF(excluded.replay_of, ''), executor_runs.replay_of),
+			submitted_at = COALESCE(excluded.submitted_at, executor_runs.submitted_at),
+			started_at  = COALESCE(excluded.started_at, executor_runs.started_at),
+			updated_at  = excluded.updated_at`,
+		tenant, t.RunID, t.WorkflowID, t.Name, nullableJSON(labels), t.State, t.ReplayOf, submittedAt, startedAt, t.At)
+	if err != nil {
+		return err
+	}
+
+	if t.State != "" {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO executor_transitions (tenant_id, run_id, state, at) VALUES ($1, $2, $3, $4)`,
+			tenant, t.RunID, t.State, t.At)
+		if err != nil {
+			return err
+		}
+	}
+	for taskID, state := range t.TaskStates {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO executor_task_states (tenant_id, run_id, task_id, state, updated_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (tenant_id, run_id, task_id) DO UPDATE SET
+				state = excluded.state, updated_at = excluded.updated_at`,
+			tenant, t.RunID, taskID, state, t.At)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO executor_transitions (tenant_id, run_id, task_id, state, at) VALUES ($1, $2, $3, $4, $5)`,
+			tenant, t.RunID, taskID, state, t.At)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresStore) AddActive(ctx context.Context, tenantID, runID string) (int64, error) {
+	tenant := tenantOrDefault(tenantID)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO executor_runs (tenant_id, run_id, active) VALUES ($1, $2, TRUE)
+		ON CONFLICT (tenant_id, run_id) DO UPDATE SET active = TRUE`,
+		tenant, runID)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT count(*) FROM executor_runs WHERE tenant_id = $1 AND active`, tenant).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit()
+}
+
+func (s *postgresStore) RemoveActive(ctx context.Context, tenantID, runID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE executor_runs SET active = FALSE WHERE tenant_id = $1 AND run_id = $2`,
+		tenantOrDefault(tenantID), runID)
+	return err
+}
+
+func (s *postgresStore) RetainRun(ctx context.Context, tenantID, runID string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE executor_runs SET expires_at = GREATEST(expires_at, $3)
+		WHERE tenant_id = $1 AND run_id = $2`,
+		tenantOrDefault(tenantID), runID, until)
+	return err
+}
+
+func (s *postgresStore) PopExpiredRuns(ctx context.Context, limit int) ([]ExpiredRun, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE executor_runs SET expires_at = NULL
+		WHERE (tenant_id, run_id) IN (
+			SELECT tenant_id, run_id FROM executor_runs
+			WHERE expires_at <= now()
+			ORDER BY expires_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING tenant_id, run_id`,
+		limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []ExpiredRun
+	for rows.Next() {
+		var run ExpiredRun
+		if err := rows.Scan(&run.TenantID, &run.RunID); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (s *postgresStore) DeleteRun(ctx context.Context, tenantID, runID string) (bool, error) {
+	tenant := tenantOrDefault(tenantID)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// A redelivered run can be running again after failing
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM executor_runs
+		WHERE tenant_id = $1 AND run_id = $2 AND NOT active AND state <> $3`,
+		tenant, runID, runStateRunning)
+	if err != nil {
+		return false, err
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM executor_task_states WHERE tenant_id = $1 AND run_id = $2`, tenant, runID); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM executor_transitions WHERE tenant_id = $1 AND run_id = $2`, tenant, runID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// runColumns selects a run joined with its task states, one row per task
+const runColumns = `
+	SELECT r.run_id, r.workflow_id, r.name, r.labels, r.state, r.replay_of, r.submitted_at, r.started_at, r.updated_at,
+	       COALESCE(t.task_id, ''), COALESCE(t.state, '')
+	FROM executor_runs r
+	LEFT JOIN executor_task_states t ON t.tenant_id = r.tenant_id AND t.run_id = r.run_id`
+
+func (s *postgresStore) GetRun(ctx context.Context, tenantID, runID string) (*RunState, error) {
+	rows, err := s.db.QueryContext(ctx, runColumns+`
+		WHERE r.tenant_id = $1 AND r.run_id = $2`,
+		tenantOrDefault(tenantID), runID)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := scanRuns(rows, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, errNotFound
+	}
+	return runs[0], nil
+}
+
+func (s *postgresStore) ListActive(ctx context.Context, tenantID string) ([]*RunState, error) {
+	rows, err := s.db.QueryContext(ctx, runColumns+`
+		WHERE r.tenant_id = $1 AND r.active
+		ORDER BY r.run_id`,
+		tenantOrDefault(tenantID))
+	if err != nil {
+		return nil, err
+	}
+	return scanRuns(rows, tenantID)
+}
+
+// scanRuns decodes rows selected with runColumns and closes them. Rows must
+// arrive grouped by run
+func scanRuns(rows *sql.Rows, tenantID string) ([]*RunState, error) {
+	defer rows.Close()
+
+	var runs []*RunState
+	var run *RunState
+	for rows.Next() {
+		var (
+			runID, workflowID, name, state, replayOf, taskID, taskState string
+			labels                                                      []byte
+			submittedAt, startedAt                                      sql.NullTime
+			updatedAt                                                   time.Time
+		)
+		if err := rows.Scan(&runID, &workflowID, &name, &labels, &state, &replayOf, &submittedAt, &startedAt, &updatedAt, &taskID, &taskState); err != nil {
+			return nil, err
+		}
+		// Rows arrive grouped by run, one per task
+		if run == nil || run.RunID != runID {
+			run = &RunState{
+				TenantID:    tenantOrDefault(tenantID),
+				RunID:       runID,
+				WorkflowID:  workflowID,
+				Name:        name,
+				State:       state,
+				TaskStates:  make(map[string]string),
+				ReplayOf:    replayOf,
+				SubmittedAt: submittedAt.Time,
+				StartedAt:   startedAt.Time,
+				UpdatedAt:   updatedAt,
+			}
+			json.Unmarshal(labels, &run.Labels)
+			runs = append(runs, run)
+		}
+		if taskID != "" {
+			run.TaskStates[taskID] = taskState
+		}
+	}
+
+	return runs, rows.Err()
+}
+
+func (s *postgresStore) AddDeadLetter(ctx context.Context, entry *DeadLetter) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding dead letter %s: %w", entry.ID, err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO executor_dead_letters (id, tenant_id, source, entry, failed_at) VALUES ($1, $2, $3, $4, $5)`,
+		entry.ID, entry.TenantID, entry.Source, data, entry.FailedAt)
+	return err
+}
+
+func (s *postgresStore) ListDeadLetters(ctx context.Context, tenantID, source string, limit int) ([]*DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT entry FROM executor_dead_letters
+		WHERE tenant_id = $1 AND ($2 = '' OR source = $2)
+		ORDER BY failed_at
+		LIMIT $3`,
+		tenantID, source, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*DeadLetter
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var entry DeadLetter
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("decoding dead letter: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *postgresStore) ClaimDeadLetter(ctx context.Context, tenantID, id string, timeout time.Duration) (*DeadLetter, error) {
+	// The row lock serializes claims, and the claim is only taken when none
+	// is left unexpired
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var data []byte
+	var claimed bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT entry, claimed_until IS NOT NULL AND claimed_until > now()
+		FROM executor_dead_letters
+		WHERE tenant_id = $1 AND id = $2
+		FOR UPDATE`,
+		tenantID, id).Scan(&data, &claimed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if claimed {
+		return nil, errDeadLetterClaimed
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE executor_dead_letters SET claimed_until = now() + $2 * interval '1 millisecond' WHERE id = $1`,
+		id, timeout.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	var entry DeadLetter
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("decoding dead letter %s: %w", id, err)
+	}
+	return &entry, nil
+}
+
+func (s *postgresStore) ReleaseDeadLetter(ctx context.Context, tenantID, id string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE executor_dead_letters SET claimed_until = NULL WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	return err
+}
+
+func (s *postgresStore) DeleteDeadLetter(ctx context.Context, tenantID, id string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM executor_dead_letters WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	return err
+}
+
+func (s *postgresStore) CountDeadLetters(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT source, count(*) FROM executor_dead_letters GROUP BY source`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var source string
+		var count int64
+		if err := rows.Scan(&source, &count); err != nil {
+			return nil, err
+		}
+		counts[source] = count
+	}
+	return counts, rows.Err()
+}
+
+func (s *postgresStore) TakeToken(ctx context.Context, bucket string, rate float64, burst int) (bool, error) {
+	// The bucket is refilled for the time since it was last used, by the
+	// database's clock so every executor agrees. When no token is left the
+	// update is skipped and no row is returned
+	row := s.db.QueryRowContext(ctx, `
+		INSERT INTO executor_rate_buckets AS b (bucket, tokens, updated_at)
+		VALUES ($1, $3 - 1, now())
+		ON CONFLICT (bucket) DO UPDATE
+			SET tokens = LEAST($3, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $2) - 1,
+				updated_at = now()
+			WHERE LEAST($3, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $2) >= 1
+		RETURNING bucket`,
+		bucket, rate, burst)
+
+	var taken string
+	err := row.Scan(&taken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *postgresStore) DelayTask(ctx context.Context, bucket string, task *DelayedTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("encoding delayed task %s: %w", task.TaskID, err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO executor_delayed_tasks (bucket, task, delayed_at) VALUES ($1, $2, $3)`,
+		bucket, data, task.DelayedAt)
+	return err
+}
+
+func (s *postgresStore) ClaimDelayedTask(ctx context.Context, bucket string, timeout time.Duration) (*DelayedTask, error) {
+	// SKIP LOCKED lets executors claiming at once take different tasks
+	var id int64
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE executor_delayed_tasks
+		SET claimed_until = now() + $2 * interval '1 millisecond'
+		WHERE id = (
+			SELECT id FROM executor_delayed_tasks
+			WHERE bucket = $1 AND (claimed_until IS NULL OR claimed_until <= now())
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, task`,
+		bucket, timeout.Milliseconds()).Scan(&id, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var task DelayedTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, fmt.Errorf("decoding delayed task: %w", err)
+	}
+	task.Claim = strconv.FormatInt(id, 10)
+	return &task, nil
+}
+
+func (s *postgresStore) AckDelayedTask(ctx context.Context, bucket string, task *DelayedTask) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM executor_delayed_tasks WHERE id = $1`, task.Claim)
+	return err
+}
+
+// ReleaseDelayedTask clears the claim; the task keeps its place in the
+// queue, since the queue is ordered by id
+func (s *postgresStore) ReleaseDelayedTask(ctx context.Context, bucket string, task *DelayedTask) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE executor_delayed_tasks SET claimed_until = NULL WHERE id = $1`, task.Claim)
+	return err
+}
+
+func (s *postgresStore) CountDelayedTasks(ctx context.Context, bucket string) (int64, error) {
+	var count int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT count(*) FROM executor_delayed_tasks
+		WHERE bucket = $1 AND (claimed_until IS NULL OR claimed_until <= now())`,
+		bucket).Scan(&count)
+	return count, err
+}
+
+func (s *postgresStore) DeferTask(ctx context.Context, task *DelayedTask, delay time.Duration) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("encoding deferred task %s: %w", task.TaskID, err)
+	}
+	// Due times are by the database's clock, not the executors'
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO executor_deferred_tasks (task, due_at) VALUES ($1, now() + $2 * interval '1 millisecond')`,
+		data, delay.Milliseconds())
+	return err
+}
+
+func (s *postgresStore) ClaimDueTasks(ctx context.Context, limit int, timeout time.Duration) ([]*DelayedTask, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE executor_deferred_tasks
+		SET claimed_until = now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM executor_deferred_tasks
+			WHERE due_at <= now() AND (claimed_until IS NULL OR claimed_until <= now())
+			ORDER BY due_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, task, due_at`,
+		limit, timeout.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type dueTask struct {
+		task  *DelayedTask
+		dueAt time.Time
+	}
+	var due []dueTask
+	for rows.Next() {
+		var id int64
+		var data []byte
+		var dueAt time.Time
+		if err := rows.Scan(&id, &data, &dueAt); err != nil {
+			return nil, err
+		}
+		var task DelayedTask
+		if err := json.Unmarshal(data, &task); err != nil {
+			return nil, fmt.Errorf("decoding deferred task: %w", err)
+		}
+		task.Claim = strconv.FormatInt(id, 10)
+		due = append(due, dueTask{task: &task, dueAt: dueAt})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING doesn't keep the subquery's order
+	sort.Slice(due, func(i, j int) bool { return due[i].dueAt.Before(due[j].dueAt) })
+	tasks := make([]*DelayedTask, len(due))
+	for i, d := range due {
+		tasks[i] = d.task
+	}
+	return tasks, nil
+}
+
+func (s *postgresStore) AckDeferredTask(ctx context.Context, task *DelayedTask) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM executor_deferred_tasks WHERE id = $1`, task.Claim)
+	return err
+}
+
+func (s *postgresStore) ReleaseDeferredTask(ctx context.Context, task *DelayedTask) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE executor_deferred_tasks SET claimed_until = NULL WHERE id = $1`, task.Claim)
+	return err
+}
+
+func (s *postgresStore) CountDeferredTasks(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM executor_deferred_tasks`).Scan(&count)
+	return count, err
+}
+
+func (s *postgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
+
+// nullableJSON passes encoded JSON to Postgres, or NULL when there is none
+func nullableJSON(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
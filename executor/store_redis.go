@@ -0,0 +1,593 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisStore keeps run state in Redis: dedup keys as strings, each tenant's
+// active runs in a set, and each run's progress in a hash that the
+// observatory reads directly. Progress is kept until the run's retention
+// passes and the janitor deletes it
+type redisStore struct {
+	client *redis.Client
+}
+
+func newRedisStore(client *redis.Client) *redisStore {
+	return &redisStore{client: client}
+}
+
+// taskField is the progress hash field holding a task's state
+func taskField(taskID string) string {
+	return "task:" + taskID
+}
+
+func (s *redisStore) SetNXWithTTL(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (string, error) {
+	value, err := s.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", errNotFound
+	}
+	return value, err
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
+
+func (s *redisStore) RecordTransition(ctx context.Context, t *Transition) error {
+	fields := map[string]interface{}{
+		"run_id":     t.RunID,
+		"tenant_id":  tenantOrDefault(t.TenantID),
+		"updated_at": t.At.UTC().Format(time.RFC3339Nano),
+	}
+	if t.WorkflowID != "" {
+		fields["workflow_id"] = t.WorkflowID
+	}
+	if t.Name != "" {
+		fields["name"] = t.Name
+	}
+	if t.Labels != nil {
+		labels, err := json.Marshal(t.Labels)
+		if err != nil {
+			return fmt.Errorf("encoding labels for run %s: %w", t.RunID, err)
+		}
+		fields["labels"] = string(labels)
+	}
+	if t.State != "" {
+		fields["state"] = t.State
+	}
+	if t.ReplayOf != "" {
+		fields["replay_of"] = t.ReplayOf
+	}
+	if !t.SubmittedAt.IsZero() {
+		fields["submitted_at"] = t.SubmittedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if !t.StartedAt.IsZero() {
+		fields["started_at"] = t.StartedAt.UTC().Format(time.RFC3339Nano)
+	}
+	for taskID, state := range t.TaskStates {
+		fields[taskField(taskID)] = state
+	}
+
+	return s.client.HSet(ctx, tenantKey(t.TenantID, "workflow", t.RunID), fields).Err()
+}
+
+func (s *redisStore) AddActive(ctx context.Context, tenantID, runID string) (int64, error) {
+	key := tenantKey(tenantID, "active")
+	pipe := s.client.TxPipeline()
+	pipe.SAdd(ctx, key, runID)
+	count := pipe.SCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+func (s *redisStore) RemoveActive(ctx context.Context, tenantID, runID string) error {
+	return s.client.SRem(ctx, tenantKey(tenantID, "active"), runID).Err()
+}
+
+func (s *redisStore) GetRun(ctx context.Context, tenantID, runID string) (*RunState, error) {
+	fields, err := s.client.HGetAll(ctx, tenantKey(tenantID, "workflow", runID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errNotFound
+	}
+	return parseRunState(fields), nil
+}
+
+func (s *redisStore) ListActive(ctx context.Context, tenantID string) ([]*RunState, error) {
+	runIDs, err := s.client.SMembers(ctx, tenantKey(tenantID, "active")).Result()
+	if err != nil || len(runIDs) == 0 {
+		return nil, err
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(runIDs))
+	for i, runID := range runIDs {
+		cmds[i] = pipe.HGetAll(ctx, tenantKey(tenantID, "workflow", runID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	runs := make([]*RunState, 0, len(cmds))
+	for _, cmd := range cmds {
+		// Runs whose progress has expired are skipped rather than reported empty
+		if fields := cmd.Val(); len(fields) > 0 {
+			runs = append(runs, parseRunState(fields))
+		}
+	}
+	return runs, nil
+}
+
+// Finished runs are indexed by when their retention passes in a sorted set
+// shared by all tenants, so the janitor finds them without scanning keys
+const retentionKey = "chronos:retention"
+
+// retentionMember identifies a run in the retention index
+func retentionMember(tenantID, runID string) (string, error) {
+	member, err := json.Marshal(ExpiredRun{TenantID: tenantOrDefault(tenantID), RunID: runID})
+	return string(member), err
+}
+
+func (s *redisStore) RetainRun(ctx context.Context, tenantID, runID string, until time.Time) error {
+	member, err := retentionMember(tenantID, runID)
+	if err != nil {
+		return fmt.Errorf("encoding retention of run %s: %w", runID, err)
+	}
+	return s.client.ZAddArgs(ctx, retentionKey, redis.ZAddArgs{
+		GT:      true,
+		Members: []redis.Z{{Score: float64(until.Unix()), Member: member}},
+	}).Err()
+}
+
+// popExpiredRunsScript removes the expired runs from the retention index
+// atomically, so each is cleaned up by only one executor
+var popExpiredRunsScript = redis.NewScript(`
+redis.replicate_commands()
+local now = tonumber(redis.call('TIME')[1])
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now, 'LIMIT', 0, tonumber(ARGV[1]))
+if #expired > 0 then
+	redis.call('ZREM', KEYS[1], unpack(expired))
+end
+return expired
+`)
+
+func (s *redisStore) PopExpiredRuns(ctx context.Context, limit int) ([]ExpiredRun, error) {
+	members, err := popExpiredRunsScript.Run(ctx, s.client, []string{retentionKey}, limit).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]ExpiredRun, 0, len(members))
+	for _, member := range members {
+		var run ExpiredRun
+		if err := json.Unmarshal([]byte(member), &run); err != nil {
+			return nil, fmt.Errorf("decoding expired run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// deleteRunScript deletes a run's progress unless the run is active or
+// running, which a redelivered run can be again after failing
+var deleteRunScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[2], ARGV[1]) == 1 or redis.call('HGET', KEYS[1], 'state') == ARGV[2] then
+	return 0
+end
+return redis.call('DEL', KEYS[1])
+`)
+
+func (s *redisStore) DeleteRun(ctx context.Context, tenantID, runID string) (bool, error) {
+	keys := []string{tenantKey(tenantID, "workflow", runID), tenantKey(tenantID, "active")}
+	deleted, err := deleteRunScript.Run(ctx, s.client, keys, runID, runStateRunning).Int()
+	return deleted == 1, err
+}
+
+// DLQ entries are kept in a hash by ID and indexed by failure time in a
+// sorted set per source, which the depth gauge counts, and in one per tenant
+// and source, which tenants list. Entries being redriven are claimed in a
+// hash of claim expiry times by ID
+const (
+	deadLetterEntriesKey = "chronos:dlq:entries"
+	deadLetterClaimsKey  = "chronos:dlq:claimed"
+)
+
+func deadLetterIndexKey(source string) string {
+	return "chronos:dlq:index:" + source
+}
+
+func deadLetterTenantIndexKey(tenantID, source string) string {
+	return tenantKey(tenantID, "dlq", source)
+}
+
+// deadLetterKeys are the keys holding one of a tenant's DLQ entries
+func deadLetterKeys(tenantID string) []string {
+	return []string{
+		deadLetterEntriesKey,
+		deadLetterClaimsKey,
+		deadLetterTenantIndexKey(tenantID, deadLetterSourceWorkflow),
+		deadLetterTenantIndexKey(tenantID, deadLetterSourceTask),
+	}
+}
+
+func (s *redisStore) AddDeadLetter(ctx context.Context, entry *DeadLetter) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding dead letter %s: %w", entry.ID, err)
+	}
+	score := float64(entry.FailedAt.UnixNano())
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, deadLetterEntriesKey, entry.ID, data)
+	pipe.ZAdd(ctx, deadLetterIndexKey(entry.Source), &redis.Z{Score: score, Member: entry.ID})
+	pipe.ZAdd(ctx, deadLetterTenantIndexKey(entry.TenantID, entry.Source), &redis.Z{Score: score, Member: entry.ID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *redisStore) ListDeadLetters(ctx context.Context, tenantID, source string, limit int) ([]*DeadLetter, error) {
+	sources := []string{source}
+	if source == "" {
+		sources = []string{deadLetterSourceWorkflow, deadLetterSourceTask}
+	}
+
+	var ids []string
+	for _, source := range sources {
+		members, err := s.client.ZRange(ctx, deadLetterTenantIndexKey(tenantID, source), 0, int64(limit)-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, members...)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	values, err := s.client.HMGet(ctx, deadLetterEntriesKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*DeadLetter, 0, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var entry DeadLetter
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, fmt.Errorf("decoding dead letter %s: %w", ids[i], err)
+		}
+		entries = append(entries, &entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].FailedAt.Before(entries[j].FailedAt) })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// claimDeadLetterScript claims an entry in one of the tenant's indexes
+// unless another claim on it is unexpired, returning the entry once claimed
+var claimDeadLetterScript = redis.NewScript(`
+redis.replicate_commands()
+if not redis.call('ZSCORE', KEYS[3], ARGV[1]) and not redis.call('ZSCORE', KEYS[4], ARGV[1]) then
+	return {0}
+end
+local entry = redis.call('HGET', KEYS[1], ARGV[1])
+if not entry then
+	return {0}
+end
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local claimed = tonumber(redis.call('HGET', KEYS[2], ARGV[1]))
+if claimed and claimed > now then
+	return {1}
+end
+redis.call('HSET', KEYS[2], ARGV[1], tostring(now + tonumber(ARGV[2])))
+return {2, entry}
+`)
+
+func (s *redisStore) ClaimDeadLetter(ctx context.Context, tenantID, id string, timeout time.Duration) (*DeadLetter, error) {
+	result, err := claimDeadLetterScript.Run(ctx, s.client, deadLetterKeys(tenantID), id, timeout.Seconds()).Slice()
+	if err != nil {
+		return nil, err
+	}
+	switch status, _ := result[0].(int64); status {
+	case 0:
+		return nil, errNotFound
+	case 1:
+		return nil, errDeadLetterClaimed
+	}
+	var entry DeadLetter
+	if err := json.Unmarshal([]byte(result[1].(string)), &entry); err != nil {
+		return nil, fmt.Errorf("decoding dead letter %s: %w", id, err)
+	}
+	return &entry, nil
+}
+
+func (s *redisStore) ReleaseDeadLetter(ctx context.Context, tenantID, id string) error {
+	return s.client.HDel(ctx, deadLetterClaimsKey, id).Err()
+}
+
+func (s *redisStore) DeleteDeadLetter(ctx context.Context, tenantID, id string) error {
+	pipe := s.client.TxPipeline()
+	pipe.HDel(ctx, deadLetterEntriesKey, id)
+	pipe.HDel(ctx, deadLetterClaimsKey, id)
+	for _, source := range []string{deadLetterSourceWorkflow, deadLetterSourceTask} {
+		pipe.ZRem(ctx, deadLetterIndexKey(source), id)
+		pipe.ZRem(ctx, deadLetterTenantIndexKey(tenantID, source), id)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *redisStore) CountDeadLetters(ctx context.Context) (map[string]int64, error) {
+	counts := make(map[string]int64, 2)
+	for _, source := range []string{deadLetterSourceWorkflow, deadLetterSourceTask} {
+		count, err := s.client.ZCard(ctx, deadLetterIndexKey(source)).Result()
+		if err != nil {
+			return nil, err
+		}
+		counts[source] = count
+	}
+	return counts, nil
+}
+
+// Dispatch rate limits are shared by all tenants, since they protect the
+// systems tasks call. Each bucket's tokens are kept in a hash refilled by
+// takeTokenScript, its delayed tasks in a list, oldest first, and its claimed
+// tasks in a sorted set scored by when their claims expire
+func rateBucketKey(bucket string) string {
+	return "chronos:ratelimit:bucket:" + bucket
+}
+
+func delayQueueKey(bucket string) string {
+	return "chronos:ratelimit:delayed:" + bucket
+}
+
+func delayClaimsKey(bucket string) string {
+	return "chronos:ratelimit:claimed:" + bucket
+}
+
+// takeTokenScript refills a bucket for the time since it was last used, by
+// the Redis server's clock so every executor agrees, then takes a token
+// if one is left. Idle buckets expire once they would be full again
+var takeTokenScript = redis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated_at')
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+local taken = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	taken = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated_at', tostring(now))
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+return taken
+`)
+
+func (s *redisStore) TakeToken(ctx context.Context, bucket string, rate float64, burst int) (bool, error) {
+	taken, err := takeTokenScript.Run(ctx, s.client, []string{rateBucketKey(bucket)}, rate, burst).Int()
+	return taken == 1, err
+}
+
+func (s *redisStore) DelayTask(ctx context.Context, bucket string, task *DelayedTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("encoding delayed task %s: %w", task.TaskID, err)
+	}
+	return s.client.RPush(ctx, delayQueueKey(bucket), data).Err()
+}
+
+// claimDelayedTaskScript claims a task whose claim has expired, or else the
+// oldest in the queue, so each is handed to only one executor at a time
+var claimDelayedTaskScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local task = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now, 'LIMIT', 0, 1)[1]
+if not task then
+	task = redis.call('LPOP', KEYS[1])
+end
+if not task then
+	return false
+end
+redis.call('ZADD', KEYS[2], now + tonumber(ARGV[1]), task)
+return task
+`)
+
+// releaseDelayedTaskScript puts a claimed task back at the front of its
+// queue, unless its claim has expired and another executor has claimed it
+// since
+var releaseDelayedTaskScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+return redis.call('LPUSH', KEYS[1], ARGV[1])
+`)
+
+// countDelayedTasksScript counts a queue's tasks and its expired claims
+var countDelayedTasksScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+return redis.call('LLEN', KEYS[1]) + redis.call('ZCOUNT', KEYS[2], '-inf', now)
+`)
+
+func (s *redisStore) ClaimDelayedTask(ctx context.Context, bucket string, timeout time.Duration) (*DelayedTask, error) {
+	data, err := claimDelayedTaskScript.Run(ctx, s.client,
+		[]string{delayQueueKey(bucket), delayClaimsKey(bucket)}, timeout.Seconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var task DelayedTask
+	if err := json.Unmarshal([]byte(data), &task); err != nil {
+		return nil, fmt.Errorf("decoding delayed task: %w", err)
+	}
+	task.Claim = data
+	return &task, nil
+}
+
+func (s *redisStore) AckDelayedTask(ctx context.Context, bucket string, task *DelayedTask) error {
+	return s.client.ZRem(ctx, delayClaimsKey(bucket), task.Claim).Err()
+}
+
+func (s *redisStore) ReleaseDelayedTask(ctx context.Context, bucket string, task *DelayedTask) error {
+	return releaseDelayedTaskScript.Run(ctx, s.client,
+		[]string{delayQueueKey(bucket), delayClaimsKey(bucket)}, task.Claim).Err()
+}
+
+func (s *redisStore) CountDelayedTasks(ctx context.Context, bucket string) (int64, error) {
+	return countDelayedTasksScript.Run(ctx, s.client,
+		[]string{delayQueueKey(bucket), delayClaimsKey(bucket)}).Int64()
+}
+
+// Deferred tasks are kept in a sorted set scored by when they're due, and
+// claimed ones in another scored by when their claims expire. The scripts
+// read the Redis server's clock, so due times don't depend on the clocks of
+// the executors that defer and dispatch them
+const (
+	deferredTasksKey = "chronos:deferred"
+	claimedTasksKey  = "chronos:deferred:claimed"
+)
+
+var deferTaskScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call('TIME')
+local due = tonumber(time[1]) + tonumber(time[2]) / 1000000 + tonumber(ARGV[2])
+return redis.call('ZADD', KEYS[1], due, ARGV[1])
+`)
+
+// claimDueTasksScript moves due tasks, and claimed tasks whose claims have
+// expired, to the claimed set atomically, so each is handed to only one
+// executor at a time
+var claimDueTasksScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local limit = tonumber(ARGV[1])
+local tasks = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now, 'LIMIT', 0, limit)
+if #tasks < limit then
+	local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now, 'LIMIT', 0, limit - #tasks)
+	if #due > 0 then
+		redis.call('ZREM', KEYS[1], unpack(due))
+	end
+	for _, task in ipairs(due) do
+		table.insert(tasks, task)
+	end
+end
+for _, task in ipairs(tasks) do
+	redis.call('ZADD', KEYS[2], now + tonumber(ARGV[2]), task)
+end
+return tasks
+`)
+
+// releaseDeferredTaskScript makes a claimed task due again, unless its claim
+// has expired and another executor has claimed it since
+var releaseDeferredTaskScript = redis.NewScript(`
+redis.replicate_commands()
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+local time = redis.call('TIME')
+return redis.call('ZADD', KEYS[1], tonumber(time[1]) + tonumber(time[2]) / 1000000, ARGV[1])
+`)
+
+func (s *redisStore) DeferTask(ctx context.Context, task *DelayedTask, delay time.Duration) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("encoding deferred task %s: %w", task.TaskID, err)
+	}
+	return deferTaskScript.Run(ctx, s.client, []string{deferredTasksKey}, data, delay.Seconds()).Err()
+}
+
+func (s *redisStore) ClaimDueTasks(ctx context.Context, limit int, timeout time.Duration) ([]*DelayedTask, error) {
+	values, err := claimDueTasksScript.Run(ctx, s.client, []string{deferredTasksKey, claimedTasksKey}, limit, timeout.Seconds()).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*DelayedTask, 0, len(values))
+	for _, data := range values {
+		var task DelayedTask
+		if err := json.Unmarshal([]byte(data), &task); err != nil {
+			return nil, fmt.Errorf("decoding deferred task: %w", err)
+		}
+		task.Claim = data
+		tasks = append(tasks, &task)
+	}
+	return tasks, nil
+}
+
+func (s *redisStore) AckDeferredTask(ctx context.Context, task *DelayedTask) error {
+	return s.client.ZRem(ctx, claimedTasksKey, task.Claim).Err()
+}
+
+func (s *redisStore) ReleaseDeferredTask(ctx context.Context, task *DelayedTask) error {
+	return releaseDeferredTaskScript.Run(ctx, s.client, []string{deferredTasksKey, claimedTasksKey}, task.Claim).Err()
+}
+
+func (s *redisStore) CountDeferredTasks(ctx context.Context) (int64, error) {
+	pipe := s.client.Pipeline()
+	deferred := pipe.ZCard(ctx, deferredTasksKey)
+	claimed := pipe.ZCard(ctx, claimedTasksKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return deferred.Val() + claimed.Val(), nil
+}
+
+func (s *redisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
+
+// parseRunState decodes a run's progress hash
+func parseRunState(fields map[string]string) *RunState {
+	run := &RunState{
+		TenantID:   fields["tenant_id"],
+		RunID:      fields["run_id"],
+		WorkflowID: fields["workflow_id"],
+		Name:       fields["name"],
+		State:      fields["state"],
+		TaskStates: make(map[string]string),
+		ReplayOf:   fields["replay_of"],
+	}
+	run.SubmittedAt, _ = time.Parse(time.RFC3339Nano, fields["submitted_at"])
+	run.StartedAt, _ = time.Parse(time.RFC3339Nano, fields["started_at"])
+	run.UpdatedAt, _ = time.Parse(time.RFC3339Nano, fields["updated_at"])
+	json.Unmarshal([]byte(fields["labels"]), &run.Labels)
+
+	for field, state := range fields {
+		if taskID, ok := strings.CutPrefix(field, "task:"); ok {
+			run.TaskStates[taskID] = state
+		}
+	}
+	return run
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stateStores runs a test against every state store backend. Postgres runs
+// only when TEST_DATABASE_URL points at a database the test can clear
+func stateStores(t *testing.T, test func(t *testing.T, store StateStore)) {
+	t.Run("redis", func(t *testing.T) {
+		store, _ := newTestRedisStore(t)
+		test(t, store)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("TEST_DATABASE_URL")
+		if url == "" {
+			t.Skip("TEST_DATABASE_URL is not set")
+		}
+		store, err := newPostgresStore(url)
+		if err != nil {
+			t.Fatalf("newPostgresStore: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		_, err = store.db.Exec(`TRUNCATE executor_kv, executor_runs, executor_task_states, executor_dead_letters,
+			executor_rate_buckets, executor_delayed_tasks, executor_deferred_tasks, executor_transitions`)
+		if err != nil {
+			t.Fatalf("clearing tables: %v", err)
+		}
+		test(t, store)
+	})
+}
+
+// recordRun records a running run with its tasks pending
+func recordRun(t *testing.T, store StateStore, tenant, runID string, tasks ...string) {
+	t.Helper()
+	ctx := context.Background()
+	states := make(map[string]string, len(tasks))
+	for _, task := range tasks {
+		states[task] = taskStatePending
+	}
+	now := time.Now().UTC()
+	err := store.RecordTransition(ctx, &Transition{
+		TenantID: tenant, RunID: runID, WorkflowID: "wf-" + runID, Name: "etl",
+		State: runStateRunning, TaskStates: states, StartedAt: now, At: now,
+	})
+	if err != nil {
+		t.Fatalf("RecordTransition: %v", err)
+	}
+	if _, err := store.AddActive(ctx, tenant, runID); err != nil {
+		t.Fatalf("AddActive: %v", err)
+	}
+}
+
+func activeRunIDs(t *testing.T, store StateStore, tenant string) string {
+	t.Helper()
+	runs, err := store.ListActive(context.Background(), tenant)
+	if err != nil {
+		t.Fatalf("ListActive(%s): %v", tenant, err)
+	}
+	ids := make([]string, len(runs))
+	for i, run := range runs {
+		ids[i] = run.RunID
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func TestStateStoreListActive(t *testing.T) {
+	stateStores(t, func(t *testing.T, store StateStore) {
+		recordRun(t, store, "acme", "run-1", "a", "b")
+		recordRun(t, store, "acme", "run-2", "a")
+		recordRun(t, store, "globex", "run-3", "a")
+
+		if got := activeRunIDs(t, store, "acme"); got != "run-1,run-2" {
+			t.Errorf("acme active runs = %s, want run-1,run-2", got)
+		}
+		if got := activeRunIDs(t, store, "globex"); got != "run-3" {
+			t.Errorf("globex active runs = %s, want run-3", got)
+		}
+
+		runs, _ := store.ListActive(context.Background(), "globex")
+		if run := runs[0]; run.WorkflowID != "wf-run-3" || run.State != runStateRunning || run.TaskStates["a"] != taskStatePending {
+			t.Errorf("listed run = %+v, want its recorded state", run)
+		}
+
+		if err := store.RemoveActive(context.Background(), "acme", "run-1"); err != nil {
+			t.Fatalf("RemoveActive: %v", err)
+		}
+		if got := activeRunIDs(t, store, "acme"); got != "run-2" {
+			t.Errorf("acme active runs after removal = %s, want run-2", got)
+		}
+	})
+}
+
+func TestStateStoreDeferredTaskClaims(t *testing.T) {
+	stateStores(t, func(t *testing.T, store StateStore) {
+		ctx := context.Background()
+		for _, id := range []string{"a", "b"} {
+			if err := store.DeferTask(ctx, deferredTask(id), 0); err != nil {
+				t.Fatalf("DeferTask: %v", err)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		tasks, err := store.ClaimDueTasks(ctx, 10, time.Minute)
+		if err != nil || len(tasks) != 2 {
+			t.Fatalf("ClaimDueTasks = %d tasks, %v, want 2", len(tasks), err)
+		}
+		if again, err := store.ClaimDueTasks(ctx, 10, time.Minute); err != nil || len(again) != 0 {
+			t.Fatalf("claimed %d claimed tasks again, %v", len(again), err)
+		}
+
+		if err := store.AckDeferredTask(ctx, tasks[0]); err != nil {
+			t.Fatalf("AckDeferredTask: %v", err)
+		}
+		if err := store.ReleaseDeferredTask(ctx, tasks[1]); err != nil {
+			t.Fatalf("ReleaseDeferredTask: %v", err)
+		}
+		released, err := store.ClaimDueTasks(ctx, 10, time.Minute)
+		if err != nil || len(released) != 1 || released[0].TaskID != tasks[1].TaskID {
+			t.Fatalf("ClaimDueTasks after release = %v, %v, want the released task", released, err)
+		}
+		if count, err := store.CountDeferredTasks(ctx); err != nil || count != 1 {
+			t.Errorf("CountDeferredTasks = %d, %v, want the unacked task counted", count, err)
+		}
+	})
+}
+
+func TestStateStoreDelayedTaskClaims(t *testing.T) {
+	stateStores(t, func(t *testing.T, store StateStore) {
+		ctx := context.Background()
+		for _, id := range []string{"a", "b"} {
+			if err := store.DelayTask(ctx, "http", deferredTask(id)); err != nil {
+				t.Fatalf("DelayTask: %v", err)
+			}
+		}
+
+		first, err := store.ClaimDelayedTask(ctx, "http", time.Minute)
+		if err != nil || first.TaskID != "a" {
+			t.Fatalf("ClaimDelayedTask = %v, %v, want a", first, err)
+		}
+		if count, err := store.CountDelayedTasks(ctx, "http"); err != nil || count != 1 {
+			t.Errorf("CountDelayedTasks with a claimed = %d, %v, want 1", count, err)
+		}
+
+		// A released task keeps its place ahead of later ones
+		if err := store.ReleaseDelayedTask(ctx, "http", first); err != nil {
+			t.Fatalf("ReleaseDelayedTask: %v", err)
+		}
+		again, err := store.ClaimDelayedTask(ctx, "http", time.Minute)
+		if err != nil || again.TaskID != "a" {
+			t.Fatalf("ClaimDelayedTask after release = %v, %v, want a", again, err)
+		}
+		if err := store.AckDelayedTask(ctx, "http", again); err != nil {
+			t.Fatalf("AckDelayedTask: %v", err)
+		}
+		second, err := store.ClaimDelayedTask(ctx, "http", time.Minute)
+		if err != nil || second.TaskID != "b" {
+			t.Fatalf("ClaimDelayedTask = %v, %v, want b", second, err)
+		}
+		if _, err := store.ClaimDelayedTask(ctx, "http", time.Minute); !errors.Is(err, errNotFound) {
+			t.Errorf("ClaimDelayedTask on an empty queue error = %v, want errNotFound", err)
+		}
+	})
+}
+
+func TestStateStoreDeadLetterClaims(t *testing.T) {
+	stateStores(t, func(t *testing.T, store StateStore) {
+		ctx := context.Background()
+		entry := addDeadLetter(t, store, "acme")
+		addDeadLetter(t, store, "globex")
+
+		entries, err := store.ListDeadLetters(ctx, "acme", "", 10)
+		if err != nil || len(entries) != 1 || entries[0].ID != entry.ID {
+			t.Fatalf("ListDeadLetters(acme) = %d entries, %v, want its own", len(entries), err)
+		}
+		if _, err := store.ClaimDeadLetter(ctx, "globex", entry.ID, time.Minute); !errors.Is(err, errNotFound) {
+			t.Errorf("another tenant's claim error = %v, want errNotFound", err)
+		}
+		if _, err := store.ClaimDeadLetter(ctx, "acme", entry.ID, time.Minute); err != nil {
+			t.Fatalf("ClaimDeadLetter: %v", err)
+		}
+		if _, err := store.ClaimDeadLetter(ctx, "acme", entry.ID, time.Minute); !errors.Is(err, errDeadLetterClaimed) {
+			t.Errorf("second claim error = %v, want errDeadLetterClaimed", err)
+		}
+		if err := store.DeleteDeadLetter(ctx, "acme", entry.ID); err != nil {
+			t.Fatalf("DeleteDeadLetter: %v", err)
+		}
+		if entries, _ := store.ListDeadLetters(ctx, "acme", "", 10); len(entries) != 0 {
+			t.Errorf("deleted entry still listed")
+		}
+	})
+}
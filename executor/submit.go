@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// SubmitResult reports the outcome of one workflow in a bulk submission
+type SubmitResult struct {
+	WorkflowID string
+	RunID      string
+	// Plan is set by a dry run, for valid workflows and those only failing
+	// with a dependency cycle
+	Plan *ExecutionPlan
+	Err  error
+}
+
+// newRunID generates a random identifier for a workflow run
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "run-" + hex.EncodeToString(b)
+}
+
+// SubmitWorkflows publishes a batch of workflows onto the workflows topic in
+// a single write. Invalid or unwritable workflows fail individually without
+// aborting the rest of the batch; the returned error is reserved for
+// rejecting the batch as a whole. A dry run only validates the workflows and
+// returns their execution plans, publishing nothing and starting no runs
+func (s *executorServer) SubmitWorkflows(ctx context.Context, workflows []*WorkflowMessage, dryRun bool) ([]SubmitResult, error) {
+	if limit := viper.GetInt("MAX_SUBMIT_BATCH_SIZE"); len(workflows) > limit {
+		return nil, fmt.Errorf("batch of %d workflows exceeds the limit of %d", len(workflows), limit)
+	}
+
+	results := make([]SubmitResult, len(workflows))
+	messages := make([]kafka.Message, 0, len(workflows))
+	// indexes maps each message back to its position in the batch
+	indexes := make([]int, 0, len(workflows))
+	tenant := tenantFromContext(ctx)
+
+	for i, workflow := range workflows {
+		if workflow == nil {
+			results[i].Err = fmt.Errorf("workflow is required")
+			continue
+		}
+		if tenant != "" {
+			workflow.TenantID = tenant
+		}
+		if workflow.RunID == "" {
+			workflow.RunID = newRunID()
+		}
+		results[i].WorkflowID = workflow.WorkflowID
+
+		err := workflow.validate()
+		if dryRun {
+			if err == nil || errors.Is(err, errDependencyCycle) {
+				results[i].Plan = workflow.plan()
+			}
+			results[i].Err = err
+			continue
+		}
+		results[i].RunID = workflow.RunID
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		value, err := codecs.encoder.EncodeWorkflow(ctx, s.submitWriter.Topic, workflow)
+		if err != nil {
+			results[i].Err = fmt.Errorf("encoding workflow: %w", err)
+			continue
+		}
+
+		message := kafka.Message{
+			Key:     []byte(tenantOrDefault(workflow.TenantID) + "/" + workflow.WorkflowID),
+			Value:   value,
+			Headers: []kafka.Header{codecs.header()},
+		}
+		// The run joins the submitter's trace and carries its baggage
+		otel.GetTextMapPropagator().Inject(ctx, kafkaHeaderCarrier{headers: &message.Headers})
+		messages = append(messages, message)
+		indexes = append(indexes, i)
+	}
+
+	if dryRun {
+		log.Printf("Planned dry run of %d workflows", len(workflows))
+		return results, nil
+	}
+	if len(messages) == 0 {
+		return results, nil
+	}
+
+	err := s.submitWriter.WriteMessages(ctx, messages...)
+	var writeErrs kafka.WriteErrors
+	switch {
+	case err == nil:
+	case errors.As(err, &writeErrs):
+		for j, writeErr := range writeErrs {
+			if writeErr != nil {
+				results[indexes[j]].Err = fmt.Errorf("publishing workflow: %w", writeErr)
+			}
+		}
+	default:
+		for _, i := range indexes {
+			results[i].Err = fmt.Errorf("publishing workflow: %w", err)
+		}
+	}
+
+	// The submission time only feeds the duration metric, so failing to
+	// record it doesn't fail the submission
+	now := time.Now()
+	failed := 0
+	for i, result := range results {
+		if result.Err != nil {
+			failed++
+			continue
+		}
+		if err := recordWorkflowSubmitted(ctx, s.store, workflows[i], now); err != nil {
+			log.Printf("Error recording submission of run %s: %v", result.RunID, err)
+		}
+	}
+	log.Printf("Submitted batch of %d workflows, %d failed", len(workflows), failed)
+
+	return results, nil
+}
+
+// submitResponseItem is the JSON form of a SubmitResult
+type submitResponseItem struct {
+	WorkflowID string         `json:"workflow_id"`
+	RunID      string         `json:"run_id,omitempty"`
+	Success    bool           `json:"success"`
+	Plan       *ExecutionPlan `json:"plan,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// handleSubmitWorkflows serves POST /workflows/submit, accepting a JSON array
+// of workflow messages and responding with one result per workflow. The
+// workflows are submitted for the tenant named by the X-Chronos-Tenant header
+// or tenant query parameter. With ?dry_run=true the results carry execution
+// plans instead of run IDs
+func (s *executorServer) handleSubmitWorkflows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var workflows []*WorkflowMessage
+	if err := json.NewDecoder(r.Body).Decode(&workflows); err != nil {
+		http.Error(w, fmt.Sprintf("decoding workflows: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx = withRequestTenant(ctx, r)
+	results, err := s.SubmitWorkflows(ctx, workflows, dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	items := make([]submitResponseItem, len(results))
+	for i, result := range results {
+		items[i] = submitResponseItem{
+			WorkflowID: result.WorkflowID,
+			RunID:      result.RunID,
+			Success:    result.Err == nil,
+			Plan:       result.Plan,
+		}
+		if result.Err != nil {
+			items[i].Error = result.Err.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
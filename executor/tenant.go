@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/metadata"
+)
+
+// defaultTenant owns workflows submitted without a tenant ID
+const defaultTenant = "default"
+
+// tenantMetadataKey is the gRPC metadata key carrying the caller's tenant ID
+const tenantMetadataKey = "x-chronos-tenant"
+
+// tenantFromContext returns the tenant ID of the calling client, or an empty
+// string when the request carries none
+func tenantFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(tenantMetadataKey); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// tenantHeader is the HTTP header carrying the caller's tenant ID, the HTTP
+// API's counterpart of tenantMetadataKey
+const tenantHeader = "X-Chronos-Tenant"
+
+// withRequestTenant returns ctx carrying the tenant ID of an HTTP request,
+// read from the X-Chronos-Tenant header or else the tenant query parameter,
+// as tenantFromContext reads it for gRPC callers
+func withRequestTenant(ctx context.Context, r *http.Request) context.Context {
+	tenant := r.Header.Get(tenantHeader)
+	if tenant == "" {
+		tenant = r.URL.Query().Get("tenant")
+	}
+	if tenant == "" {
+		return ctx
+	}
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(tenantMetadataKey, tenant))
+}
+
+// tenantOrDefault returns the tenant ID, falling back to the default tenant
+func tenantOrDefault(tenantID string) string {
+	if tenantID == "" {
+		return defaultTenant
+	}
+	return tenantID
+}
+
+// tenantKey builds a Redis key namespaced by tenant, so one tenant's state
+// can never collide with or be read through another tenant's keys
+func tenantKey(tenantID string, parts ...string) string {
+	return "chronos:tenant:" + tenantOrDefault(tenantID) + ":" + strings.Join(parts, ":")
+}
+
+// acquireWorkflowSlot records a run as active for its tenant, enforcing the
+// per-tenant cap on concurrent workflows when one is configured. The cap
+// can't be checked while the state store is unreachable, so the run is let through
+func acquireWorkflowSlot(ctx context.Context, store StateStore, tenantID, runID string) error {
+	active, err := store.AddActive(ctx, tenantID, runID)
+	if err != nil {
+		log.Printf("Could not record active run %s for tenant %s, skipping the concurrency check: %v", runID, tenantID, err)
+		return nil
+	}
+
+	limit := viper.GetInt64("TENANT_MAX_CONCURRENT_WORKFLOWS")
+	if limit > 0 && active > limit {
+		releaseWorkflowSlot(ctx, store, tenantID, runID)
+		return fmt.Errorf("tenant %s is at its limit of %d concurrent workflows", tenantID, limit)
+	}
+
+	return nil
+}
+
+// releaseWorkflowSlot removes a run from its tenant's active runs
+func releaseWorkflowSlot(ctx context.Context, store StateStore, tenantID, runID string) {
+	if err := store.RemoveActive(ctx, tenantID, runID); err != nil {
+		log.Printf("Error releasing active run %s for tenant %s: %v", runID, tenantID, err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the executor's spans. It resolves the global tracer
+// provider lazily, so it is safe to create before initTracer runs
+var tracer = otel.Tracer("chronos-executor")
+
+// kafkaHeaderCarrier adapts Kafka message headers for trace context
+// propagation, so the executor joins the trace of the message producer and
+// the worker joins the executor's
+type kafkaHeaderCarrier struct {
+	headers *[]kafka.Header
+}
+
+// Get returns the value of the first header with the given key
+func (c kafkaHeaderCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces any headers with the given key
+func (c kafkaHeaderCarrier) Set(key, value string) {
+	headers := (*c.headers)[:0]
+	for _, h := range *c.headers {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+	*c.headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// Keys returns the keys of all headers
+func (c kafkaHeaderCarrier) Keys() []string {
+	keys := make([]string, len(*c.headers))
+	for i, h := range *c.headers {
+		keys[i] = h.Key
+	}
+	return keys
+}
+
+// endSpan marks the span as failed when err is set, then ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WorkflowMessage is a workflow run published onto the workflows topic
+type WorkflowMessage struct {
+	WorkflowID string            `json:"workflow_id" avro:"workflow_id"`
+	RunID      string            `json:"run_id" avro:"run_id"`
+	TenantID   string            `json:"tenant_id,omitempty" avro:"tenant_id"`
+	ScheduleID string            `json:"schedule_id,omitempty" avro:"schedule_id"`
+	Name       string            `json:"name" avro:"name"`
+	Labels     map[string]string `json:"labels,omitempty" avro:"labels"`
+	Parameters map[string]string `json:"parameters,omitempty" avro:"parameters"`
+	Tasks      []TaskSpec        `json:"tasks" avro:"tasks"`
+	// ReplayOf is the run this run replays, if any
+	ReplayOf string `json:"replay_of,omitempty" avro:"replay_of"`
+	// ResumedTasks completed in the replayed run and aren't executed again;
+	// their results are read from that run
+	ResumedTasks []string `json:"resumed_tasks,omitempty" avro:"resumed_tasks"`
+}
+
+// TaskSpec describes a single task within a workflow
+type TaskSpec struct {
+	ID             string            `json:"id" avro:"id"`
+	Name           string            `json:"name" avro:"name"`
+	Type           string            `json:"type" avro:"type"`
+	Parameters     map[string]string `json:"parameters,omitempty" avro:"parameters"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" avro:"timeout_seconds"`
+	MaxRetries     int               `json:"max_retries,omitempty" avro:"max_retries"`
+	DependsOn      []string          `json:"depends_on,omitempty" avro:"depends_on"`
+	// Priority is "high", "normal" (the default), or "low"
+	Priority string `json:"priority,omitempty" avro:"priority"`
+	// DelaySeconds defers dispatching the task until this long after it's
+	// ready
+	DelaySeconds int `json:"delay_seconds,omitempty" avro:"delay_seconds"`
+}
+
+// TaskMessage is a task dispatched onto the tasks topic for the worker pool
+type TaskMessage struct {
+	TaskID         string            `json:"task_id" avro:"task_id"`
+	WorkflowID     string            `json:"workflow_id" avro:"workflow_id"`
+	RunID          string            `json:"run_id" avro:"run_id"`
+	TenantID       string            `json:"tenant_id" avro:"tenant_id"`
+	Name           string            `json:"name" avro:"name"`
+	Type           string            `json:"type" avro:"type"`
+	Parameters     map[string]string `json:"parameters,omitempty" avro:"parameters"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" avro:"timeout_seconds"`
+	MaxRetries     int               `json:"max_retries,omitempty" avro:"max_retries"`
+	Priority       string            `json:"priority" avro:"priority"`
+	// ReplayOf is the run holding the results of upstream tasks resumed
+	// rather than executed again
+	ReplayOf string `json:"replay_of,omitempty" avro:"replay_of"`
+}
+
+// Task priorities, the only values accepted in TaskSpec.Priority
+const (
+	priorityHigh   = "high"
+	priorityNormal = "normal"
+	priorityLow    = "low"
+)
+
+// knownTaskTypes are the task types the worker pool executes. Other types are
+// reported as "other" in metrics so labels never carry free text
+var knownTaskTypes = map[string]struct{}{
+	"http":     {},
+	"process":  {},
+	"database": {},
+	"file":     {},
+}
+
+// taskTypeLabel returns the metric label for a task type
+func taskTypeLabel(taskType string) string {
+	if _, ok := knownTaskTypes[taskType]; ok {
+		return taskType
+	}
+	return "other"
+}
+
+// priorityOrDefault returns the task's priority, defaulting to normal
+func (t *TaskSpec) priorityOrDefault() string {
+	if t.Priority == "" {
+		return priorityNormal
+	}
+	return t.Priority
+}
+
+// validate checks that a workflow message is complete enough to execute
+func (w *WorkflowMessage) validate() error {
+	if w.WorkflowID == "" {
+		return fmt.Errorf("workflow ID is required")
+	}
+	if w.RunID == "" {
+		return fmt.Errorf("run ID is required")
+	}
+	if len(w.Tasks) == 0 {
+		return fmt.Errorf("workflow %s has no tasks", w.WorkflowID)
+	}
+
+	ids := make(map[string]struct{}, len(w.Tasks))
+	for _, task := range w.Tasks {
+		if task.ID == "" {
+			return fmt.Errorf("workflow %s has a task without an ID", w.WorkflowID)
+		}
+		if _, dup := ids[task.ID]; dup {
+			return fmt.Errorf("workflow %s has duplicate task ID %s", w.WorkflowID, task.ID)
+		}
+		switch task.priorityOrDefault() {
+		case priorityHigh, priorityNormal, priorityLow:
+		default:
+			return fmt.Errorf("task %s has unknown priority %q", task.ID, task.Priority)
+		}
+		if task.DelaySeconds < 0 {
+			return fmt.Errorf("task %s has a negative delay of %d seconds", task.ID, task.DelaySeconds)
+		}
+		ids[task.ID] = struct{}{}
+	}
+	for _, task := range w.Tasks {
+		for _, dep := range task.DependsOn {
+			if _, ok := ids[dep]; !ok {
+				return fmt.Errorf("task %s depends on unknown task %s", task.ID, dep)
+			}
+		}
+	}
+	if len(w.ResumedTasks) > 0 && w.ReplayOf == "" {
+		return fmt.Errorf("workflow %s resumes tasks without replaying a run", w.WorkflowID)
+	}
+	for _, id := range w.ResumedTasks {
+		if _, ok := ids[id]; !ok {
+			return fmt.Errorf("workflow %s resumes unknown task %s", w.WorkflowID, id)
+		}
+	}
+	if cycle := w.plan().Cycle; cycle != nil {
+		return fmt.Errorf("workflow %s has a %w: %s", w.WorkflowID, errDependencyCycle, strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
+// readyTasks returns the tasks that can be dispatched immediately: those
+// whose dependencies are all resumed from a replayed run, which for a fresh
+// run means those without dependencies
+func (w *WorkflowMessage) readyTasks() []TaskSpec {
+	resumed := w.resumedSet()
+	var ready []TaskSpec
+	for _, task := range w.Tasks {
+		if _, ok := resumed[task.ID]; ok {
+			continue
+		}
+		blocked := false
+		for _, dep := range task.DependsOn {
+			if _, ok := resumed[dep]; !ok {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			ready = append(ready, task)
+		}
+	}
+	return ready
+}
+
+// resumedSet returns the IDs of the tasks resumed from a replayed run
+func (w *WorkflowMessage) resumedSet() map[string]struct{} {
+	resumed := make(map[string]struct{}, len(w.ResumedTasks))
+	for _, id := range w.ResumedTasks {
+		resumed[id] = struct{}{}
+	}
+	return resumed
+}
+
+// processWorkflow parses a workflow message, drops duplicates, and fans out
+// its ready tasks to the task topic, tracing each step under the trace
+// carried in the message headers
+func processWorkflow(ctx context.Context, message kafka.Message, writer *kafka.Writer, store StateStore) (err error) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, kafkaHeaderCarrier{headers: &message.Headers})
+	ctx, span := tracer.Start(ctx, "executor.process_workflow",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.kafka.topic", message.Topic),
+			attribute.Int("messaging.kafka.partition", message.Partition),
+			attribute.Int64("messaging.kafka.offset", message.Offset),
+		))
+	defer func() { endSpan(span, err) }()
+
+	workflow, err := parseWorkflow(ctx, message)
+	if err != nil {
+		return err
+	}
+	tenant := tenantOrDefault(workflow.TenantID)
+	span.SetAttributes(
+		attribute.String("workflow.id", workflow.WorkflowID),
+		attribute.String("workflow.run_id", workflow.RunID),
+		attribute.String("tenant.id", tenant),
+	)
+
+	dedupKey := tenantKey(tenant, "run", workflow.RunID)
+	if !checkFreshRun(ctx, store, dedupKey) {
+		span.SetAttributes(attribute.Bool("workflow.duplicate", true))
+		log.Printf("Skipping duplicate run %s of workflow %s", workflow.RunID, workflow.WorkflowID)
+		return nil
+	}
+
+	if err := acquireWorkflowSlot(ctx, store, tenant, workflow.RunID); err != nil {
+		store.Delete(ctx, dedupKey)
+		return err
+	}
+
+	// The run is advanced from its definition and task states as results
+	// come in, so it can't start without either
+	if err := storeWorkflowDefinition(ctx, store, workflow); err != nil {
+		releaseWorkflowSlot(ctx, store, tenant, workflow.RunID)
+		store.Delete(ctx, dedupKey)
+		return fmt.Errorf("storing definition of run %s: %w", workflow.RunID, err)
+	}
+	ready := workflow.readyTasks()
+	if err := recordWorkflowProgress(ctx, store, workflow, ready); err != nil {
+		releaseWorkflowSlot(ctx, store, tenant, workflow.RunID)
+		store.Delete(ctx, dedupKey)
+		return err
+	}
+
+	if err := dispatchTasks(ctx, writer, store, workflow, ready); err != nil {
+		// The run is failed and the dedup key dropped so a redelivery can retry it
+		if err := finishRun(ctx, store, workflow, runStateFailed); err != nil {
+			log.Printf("Error failing run %s: %v", workflow.RunID, err)
+			releaseWorkflowSlot(ctx, store, tenant, workflow.RunID)
+		}
+		store.Delete(ctx, dedupKey)
+		return err
+	}
+
+	workflowsStarted.WithLabelValues(tenant).Inc()
+	log.Printf("Started run %s of workflow %s for tenant %s", workflow.RunID, workflow.WorkflowID, tenant)
+
+	return nil
+}
+
+// parseWorkflow decodes a workflow message with the codec named in its
+// headers and validates it
+func parseWorkflow(ctx context.Context, message kafka.Message) (_ *WorkflowMessage, err error) {
+	ctx, span := tracer.Start(ctx, "executor.parse")
+	defer func() { endSpan(span, err) }()
+
+	codec, err := codecs.forMessage(message)
+	if err != nil {
+		return nil, fmt.Errorf("parsing workflow message: %w", err)
+	}
+	span.SetAttributes(attribute.String("messaging.codec", codec.Name()))
+
+	workflow, err := codec.DecodeWorkflow(ctx, message.Value)
+	if err != nil {
+		return nil, fmt.Errorf("parsing workflow message: %w", err)
+	}
+	if err := workflow.validate(); err != nil {
+		return nil, fmt.Errorf("invalid workflow: %w", err)
+	}
+	return workflow, nil
+}
+
+// checkFreshRun claims a run's dedup key so a redelivered message doesn't
+// start the run twice. When the state store is unreachable the run is
+// treated as new: starting a duplicate is safer than silently dropping a
+// workflow
+func checkFreshRun(ctx context.Context, store StateStore, dedupKey string) bool {
+	ctx, span := tracer.Start(ctx, "executor.dedup_check")
+	defer span.End()
+
+	fresh, err := store.SetNXWithTTL(ctx, dedupKey, "started", viper.GetDuration("DEDUP_TTL"))
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Could not check %s for duplicates, treating the run as new: %v", dedupKey, err)
+		return true
+	}
+	return fresh
+}
+
+// dispatchTasks writes tasks to the task topic, keyed by tenant and workflow so
+// a workflow's tasks stay ordered on a single partition. Each task message
+// carries the trace context so the worker's execution joins the trace. Tasks
+// with a delay are deferred, tasks of a type whose circuit breaker is open
+// held, and tasks over a dispatch rate limit delayed. When only some of the
+// tasks fail to be written, those are dead-lettered and the run goes on; when
+// all of them fail, the error is returned
+func dispatchTasks(ctx context.Context, writer *kafka.Writer, store StateStore, workflow *WorkflowMessage, tasks []TaskSpec) (err error) {
+	ctx, span := tracer.Start(ctx, "executor.dispatch",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("workflow.id", workflow.WorkflowID),
+			attribute.Int("workflow.tasks_dispatched", len(tasks)),
+		))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	tenant := tenantOrDefault(workflow.TenantID)
+
+	// dispatchLabels pairs a task type label with a priority label
+	type dispatchLabels struct{ taskType, priority string }
+	counts := make(map[dispatchLabels]int)
+
+	messages := make([]kafka.Message, 0, len(tasks))
+	// sent are the tasks of messages, less those deferred, held by a circuit
+	// breaker, or delayed by a rate limit
+	sent := make([]TaskSpec, 0, len(tasks))
+	for _, task := range tasks {
+		priority := dispatchPriority(ctx, task)
+		value, err := codecs.encoder.EncodeTask(ctx, writer.Topic, &TaskMessage{
+			TaskID:         task.ID,
+			WorkflowID:     workflow.WorkflowID,
+			RunID:          workflow.RunID,
+			TenantID:       tenant,
+			Name:           task.Name,
+			Type:           task.Type,
+			Parameters:     task.Parameters,
+			TimeoutSeconds: task.TimeoutSeconds,
+			MaxRetries:     task.MaxRetries,
+			Priority:       priority,
+			ReplayOf:       workflow.ReplayOf,
+		})
+		if err != nil {
+			return fmt.Errorf("encoding task %s: %w", task.ID, err)
+		}
+		message := kafka.Message{
+			Key:     []byte(tenant + "/" + workflow.WorkflowID),
+			Value:   value,
+			Headers: []kafka.Header{codecs.header()},
+		}
+		otel.GetTextMapPropagator().Inject(ctx, kafkaHeaderCarrier{headers: &message.Headers})
+		delayed := newDelayedTask(task, workflow.RunID, message)
+		limit, limited := limitFor(task)
+		if limited {
+			delayed.Bucket = limit.bucket
+		}
+		if task.DelaySeconds > 0 {
+			deferTask(ctx, store, writer.Topic, delayed, time.Duration(task.DelaySeconds)*time.Second)
+			continue
+		}
+		if holdTask(ctx, store, delayed) || limited && !admitTask(ctx, store, limit, delayed) {
+			continue
+		}
+		messages = append(messages, message)
+		sent = append(sent, task)
+		counts[dispatchLabels{taskTypeLabel(task.Type), priority}]++
+	}
+
+	span.SetAttributes(attribute.Int("workflow.tasks_delayed", len(tasks)-len(sent)))
+	if len(messages) == 0 {
+		return nil
+	}
+
+	err = writer.WriteMessages(ctx, messages...)
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) && writeErrs.Count() < len(messages) {
+		for i, writeErr := range writeErrs {
+			if writeErr != nil {
+				failed := messages[i]
+				failed.Topic = writer.Topic
+				deadLetter(ctx, store, deadLetterSourceTask, failed,
+					fmt.Errorf("dispatching task %s of run %s: %w", sent[i].ID, workflow.RunID, writeErr))
+			}
+		}
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("dispatching tasks for workflow %s: %w", workflow.WorkflowID, err)
+	}
+
+	// Tasks are written as one batch, so each task type and priority in the
+	// batch observes the batch's latency
+	latency := time.Since(start).Seconds()
+	for labels, count := range counts {
+		tasksDispatched.WithLabelValues(labels.taskType).Add(float64(count))
+		dispatchLatency.WithLabelValues(labels.taskType, labels.priority).Observe(latency)
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page size limits for active workflow listings
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// errInvalidQuery is wrapped by errors caused by a malformed query rather
+// than by Redis
+var errInvalidQuery = errors.New("invalid query")
+
+// ActiveWorkflow is a running workflow and its task progress
+type ActiveWorkflow struct {
+	WorkflowID     string            `json:"workflow_id"`
+	RunID          string            `json:"run_id"`
+	TenantID       string            `json:"tenant_id"`
+	Name           string            `json:"name"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	StartedAt      time.Time         `json:"started_at"`
+	ElapsedSeconds float64           `json:"elapsed_seconds"`
+	PendingTasks   int               `json:"pending_tasks"`
+	RunningTasks   int               `json:"running_tasks"`
+	DoneTasks      int               `json:"done_tasks"`
+}
+
+// ActiveWorkflowQuery filters, orders, and pages an active workflow listing
+type ActiveWorkflowQuery struct {
+	TenantID      string
+	LabelSelector string
+	// Order is either "asc" (oldest first, the default) or "desc"
+	Order     string
+	PageSize  int
+	PageToken string
+}
+
+// ActiveWorkflowPage is one page of an active workflow listing
+type ActiveWorkflowPage struct {
+	Workflows     []*ActiveWorkflow `json:"workflows"`
+	NextPageToken string            `json:"next_page_token,omitempty"`
+	Total         int               `json:"total"`
+}
+
+// tenantHeader is the HTTP header carrying the caller's tenant ID, as the
+// executor reads it
+const tenantHeader = "X-Chronos-Tenant"
+
+// tenantKey mirrors the executor's Redis key layout for tenant-scoped state
+func tenantKey(tenantID string, parts ...string) string {
+	return "chronos:tenant:" + tenantID + ":" + strings.Join(parts, ":")
+}
+
+// ListActiveWorkflows aggregates the executor's per-run progress of one
+// tenant into a filtered, sorted, and paginated listing
+func (s *observatoryServer) ListActiveWorkflows(ctx context.Context, query *ActiveWorkflowQuery) (*ActiveWorkflowPage, error) {
+	if query.TenantID == "" {
+		return nil, fmt.Errorf("%w: a tenant is required", errInvalidQuery)
+	}
+	required, err := parseLabelSelector(query.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidQuery, err)
+	}
+	descending := false
+	switch query.Order {
+	case "", "asc":
+	case "desc":
+		descending = true
+	default:
+		return nil, fmt.Errorf("%w: unknown order %q, expected asc or desc", errInvalidQuery, query.Order)
+	}
+	pageSize := query.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	} else if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	offset := 0
+	if query.PageToken != "" {
+		offset, err = strconv.Atoi(query.PageToken)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("%w: bad page token %q", errInvalidQuery, query.PageToken)
+		}
+	}
+
+	workflows, err := s.loadActiveWorkflows(ctx, query.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	matched := workflows[:0]
+	for _, w := range workflows {
+		if !matchesLabels(w.Labels, required) {
+			continue
+		}
+		w.ElapsedSeconds = now.Sub(w.StartedAt).Seconds()
+		matched = append(matched, w)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].StartedAt.Equal(matched[j].StartedAt) {
+			return matched[i].RunID < matched[j].RunID
+		}
+		if descending {
+			return matched[i].StartedAt.After(matched[j].StartedAt)
+		}
+		return matched[i].StartedAt.Before(matched[j].StartedAt)
+	})
+
+	page := &ActiveWorkflowPage{Workflows: []*ActiveWorkflow{}, Total: len(matched)}
+	if offset < len(matched) {
+		end := offset + pageSize
+		if end < len(matched) {
+			page.NextPageToken = strconv.Itoa(end)
+		} else {
+			end = len(matched)
+		}
+		page.Workflows = matched[offset:end]
+	}
+
+	return page, nil
+}
+
+// executorRun is a run as served by the executor's GET /workflows/active
+type executorRun struct {
+	WorkflowID string            `json:"workflow_id"`
+	RunID      string            `json:"run_id"`
+	TenantID   string            `json:"tenant_id"`
+	Name       string            `json:"name"`
+	Labels     map[string]string `json:"labels"`
+	TaskStates map[string]string `json:"task_states"`
+	StartedAt  time.Time         `json:"started_at"`
+}
+
+// loadActiveWorkflows asks the executor for a tenant's active runs, so the
+// listing works with whichever state store the executor runs on
+func (s *observatoryServer) loadActiveWorkflows(ctx context.Context, tenantID string) ([]*ActiveWorkflow, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.executorURL+"/workflows/active", nil)
+	if err != nil {
+		return nil, fmt.Errorf("building active runs request: %w", err)
+	}
+	request.Header.Set(tenantHeader, tenantID)
+
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("requesting active runs from the executor: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, fmt.Errorf("executor returned %s listing active runs: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	var runs []*executorRun
+	if err := json.NewDecoder(response.Body).Decode(&runs); err != nil {
+		return nil, fmt.Errorf("decoding active runs: %w", err)
+	}
+	workflows := make([]*ActiveWorkflow, len(runs))
+	for i, run := range runs {
+		workflows[i] = activeWorkflow(run)
+	}
+	return workflows, nil
+}
+
+// activeWorkflow builds an active workflow from the executor's state of
+// the run, counting its tasks by state
+func activeWorkflow(run *executorRun) *ActiveWorkflow {
+	w := &ActiveWorkflow{
+		WorkflowID: run.WorkflowID,
+		RunID:      run.RunID,
+		TenantID:   run.TenantID,
+		Name:       run.Name,
+		Labels:     run.Labels,
+		StartedAt:  run.StartedAt,
+	}
+	for _, state := range run.TaskStates {
+		switch state {
+		case "PENDING", "QUEUED":
+			w.PendingTasks++
+		case "RUNNING", "RETRYING":
+			w.RunningTasks++
+		default:
+			w.DoneTasks++
+		}
+	}
+	return w
+}
+
+// requestTenant returns the caller's tenant, named by the X-Chronos-Tenant
+// header or else the tenant query parameter. A caller whose header names a
+// tenant can't ask for another's workflows through the query parameter
+func requestTenant(r *http.Request) (string, error) {
+	caller := r.Header.Get(tenantHeader)
+	requested := r.URL.Query().Get("tenant")
+	if caller != "" && requested != "" && requested != caller {
+		return "", fmt.Errorf("tenant %s can't list the workflows of tenant %s", caller, requested)
+	}
+	if caller != "" {
+		return caller, nil
+	}
+	return requested, nil
+}
+
+// handleActiveWorkflows serves GET /workflows/active for the caller's tenant
+func (s *observatoryServer) handleActiveWorkflows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenant, err := requestTenant(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	params := r.URL.Query()
+	query := &ActiveWorkflowQuery{
+		TenantID:      tenant,
+		LabelSelector: params.Get("selector"),
+		Order:         params.Get("order"),
+		PageToken:     params.Get("page_token"),
+	}
+	if size := params.Get("page_size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid page_size %q", size), http.StatusBadRequest)
+			return
+		}
+		query.PageSize = n
+	}
+
+	page, err := s.ListActiveWorkflows(r.Context(), query)
+	if errors.Is(err, errInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing active workflows: %v", err)
+		http.Error(w, "listing active workflows failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeExecutor serves active runs by tenant as the executor's GET
+// /workflows/active does
+func fakeExecutor(t *testing.T, runs map[string][]*executorRun) *observatoryServer {
+	executor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := r.Header.Get(tenantHeader)
+		if tenant == "" {
+			http.Error(w, "a tenant is required", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(runs[tenant])
+	}))
+	t.Cleanup(executor.Close)
+	return newObservatoryServer(nil, executor.URL, executor.Client())
+}
+
+func listActive(s *observatoryServer, target, tenant string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	if tenant != "" {
+		request.Header.Set(tenantHeader, tenant)
+	}
+	recorder := httptest.NewRecorder()
+	s.handleActiveWorkflows(recorder, request)
+	return recorder
+}
+
+func TestActiveWorkflowsAreScopedToTheCaller(t *testing.T) {
+	started := time.Now().Add(-time.Minute)
+	s := fakeExecutor(t, map[string][]*executorRun{
+		"acme": {{RunID: "run-1", TenantID: "acme", StartedAt: started,
+			TaskStates: map[string]string{"a": "COMPLETED", "b": "RUNNING", "c": "PENDING"}}},
+		"globex": {{RunID: "run-2", TenantID: "globex", StartedAt: started}},
+	})
+
+	recorder := listActive(s, "/workflows/active", "acme")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+	}
+	var page ActiveWorkflowPage
+	if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+		t.Fatalf("decoding page: %v", err)
+	}
+	if page.Total != 1 || page.Workflows[0].RunID != "run-1" {
+		t.Fatalf("acme page = %+v, want only run-1", page)
+	}
+	if w := page.Workflows[0]; w.DoneTasks != 1 || w.RunningTasks != 1 || w.PendingTasks != 1 {
+		t.Errorf("task counts = %d done, %d running, %d pending, want 1 each", w.DoneTasks, w.RunningTasks, w.PendingTasks)
+	}
+
+	if code := listActive(s, "/workflows/active?tenant=globex", "acme").Code; code != http.StatusForbidden {
+		t.Errorf("status asking for another tenant = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := listActive(s, "/workflows/active", "").Code; code != http.StatusBadRequest {
+		t.Errorf("status without a tenant = %d, want %d", code, http.StatusBadRequest)
+	}
+}
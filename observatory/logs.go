@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Historical tail limits for task logs
+const (
+	defaultLogTail = 100
+	maxLogTail     = 1000
+)
+
+// followBlock is how long a follow read waits for new lines before checking
+// whether the caller has gone away
+const followBlock = 5 * time.Second
+
+// TaskLogLine is a line of a task's execution logs. The final line of a
+// finished task has EOF set and carries its status instead of output
+type TaskLogLine struct {
+	TaskID    string    `json:"task_id"`
+	Stream    string    `json:"stream,omitempty"`
+	Line      string    `json:"line,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	EOF       bool      `json:"eof,omitempty"`
+	Status    string    `json:"status,omitempty"`
+}
+
+// TaskLogQuery selects the logs of one task
+type TaskLogQuery struct {
+	TenantID string
+	TaskID   string
+	// Tail is how many of the most recent lines to send first
+	Tail int
+	// Follow keeps streaming new lines until the task finishes
+	Follow bool
+}
+
+// StreamTaskLogs sends the recent logs the workers shipped for a task and,
+// when following, new lines as they arrive until the task finishes or ctx
+// is cancelled
+func (s *observatoryServer) StreamTaskLogs(ctx context.Context, query *TaskLogQuery, send func(*TaskLogLine) error) error {
+	if query.TaskID == "" {
+		return fmt.Errorf("%w: task ID is required", errInvalidQuery)
+	}
+	tail := query.Tail
+	if tail <= 0 {
+		tail = defaultLogTail
+	} else if tail > maxLogTail {
+		tail = maxLogTail
+	}
+	tenant := query.TenantID
+	if tenant == "" {
+		tenant = "default"
+	}
+	key := tenantKey(tenant, "task", query.TaskID, "logs")
+
+	recent, err := s.redis.XRevRangeN(ctx, key, "+", "-", int64(tail)).Result()
+	if err != nil {
+		return fmt.Errorf("reading logs of task %s: %w", query.TaskID, err)
+	}
+	lastID := "0"
+	for i := len(recent) - 1; i >= 0; i-- {
+		line := parseTaskLogLine(query.TaskID, recent[i])
+		if err := send(line); err != nil {
+			return err
+		}
+		lastID = recent[i].ID
+		if line.EOF {
+			return nil
+		}
+	}
+	if !query.Follow {
+		return nil
+	}
+
+	for {
+		streams, err := s.redis.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{key, lastID},
+			Block:   followBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("following logs of task %s: %w", query.TaskID, err)
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				line := parseTaskLogLine(query.TaskID, message)
+				if err := send(line); err != nil {
+					return err
+				}
+				lastID = message.ID
+				if line.EOF {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// parseTaskLogLine decodes an entry of a task's log stream
+func parseTaskLogLine(taskID string, message redis.XMessage) *TaskLogLine {
+	line := &TaskLogLine{TaskID: taskID}
+	line.Stream, _ = message.Values["stream"].(string)
+	line.Line, _ = message.Values["line"].(string)
+	line.Status, _ = message.Values["status"].(string)
+	line.EOF = message.Values["eof"] == "1"
+	if ts, ok := message.Values["ts"].(string); ok {
+		line.Timestamp, _ = time.Parse(time.RFC3339Nano, ts)
+	}
+	return line
+}
+
+// handleTaskLogs serves GET /tasks/logs as newline-delimited JSON, flushing
+// each line so followers see output as it's produced
+func (s *observatoryServer) handleTaskLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query := &TaskLogQuery{
+		TenantID: params.Get("tenant"),
+		TaskID:   params.Get("task_id"),
+		Follow:   params.Get("follow") == "true",
+	}
+	if tail := params.Get("tail"); tail != "" {
+		n, err := strconv.Atoi(tail)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid tail %q", tail), http.StatusBadRequest)
+			return
+		}
+		query.Tail = n
+	}
+	if query.TaskID == "" {
+		http.Error(w, "task_id is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	err := s.StreamTaskLogs(r.Context(), query, func(line *TaskLogLine) error {
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	// Errors after the first line can't change the response status
+	if err != nil && r.Context().Err() == nil {
+		log.Printf("Error streaming logs of task %s: %v", query.TaskID, err)
+	}
+}
@@ -8,19 +8,23 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 )
 
 // Prometheus metrics
@@ -39,6 +43,36 @@ var (
 		Name: "chronos_observatory_logs_received_total",
 		Help: "Total number of logs received",
 	})
+	
+	remoteWriteRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chronos_observatory_remote_write_requests_total",
+		Help: "Total number of remote write requests by result",
+	}, []string{"result"})
+	
+	remoteWriteSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chronos_observatory_remote_write_samples_total",
+		Help: "Total number of samples sent to the remote write endpoint by result",
+	}, []string{"result"})
+	
+	sloCompliance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chronos_observatory_slo_compliance_ratio",
+		Help: "Fraction of good workflow runs over the SLO window",
+	}, []string{"slo"})
+	
+	sloErrorBudgetRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chronos_observatory_slo_error_budget_remaining_ratio",
+		Help: "Fraction of the SLO error budget left over the SLO window",
+	}, []string{"slo"})
+	
+	sloBurnRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chronos_observatory_slo_burn_rate",
+		Help: "Rate the SLO error budget is being consumed over the burn window",
+	}, []string{"slo"})
+	
+	sloAlerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chronos_observatory_slo_alerts_total",
+		Help: "Total number of SLO burn rate alerts fired",
+	}, []string{"slo"})
 )
 
 func init() {
@@ -46,16 +80,60 @@ func init() {
 	prometheus.MustRegister(tracesReceived)
 	prometheus.MustRegister(metricsReceived)
 	prometheus.MustRegister(logsReceived)
+	prometheus.MustRegister(remoteWriteRequests)
+	prometheus.MustRegister(remoteWriteSamples)
+	prometheus.MustRegister(sloCompliance)
+	prometheus.MustRegister(sloErrorBudgetRemaining)
+	prometheus.MustRegister(sloBurnRate)
+	prometheus.MustRegister(sloAlerts)
 	
 	// Load configuration
 	viper.SetDefault("PORT", "8083")
 	viper.SetDefault("PROMETHEUS_PORT", "9090")
 	viper.SetDefault("JAEGER_ENDPOINT", "http://jaeger:14268/api/traces")
 	viper.SetDefault("OTLP_ENDPOINT", "localhost:4317")
+	viper.SetDefault("METRICS_EXPORT_INTERVAL", "30s")
+	viper.SetDefault("REDIS_URL", "redis://localhost:6379/0")
+	viper.SetDefault("EXECUTOR_URL", "http://localhost:8091")
+	viper.SetDefault("EXECUTOR_TIMEOUT", "10s")
+	viper.SetDefault("REMOTE_WRITE_URL", "")
+	viper.SetDefault("REMOTE_WRITE_INTERVAL", "15s")
+	viper.SetDefault("REMOTE_WRITE_BATCH_SIZE", 500)
+	viper.SetDefault("REMOTE_WRITE_MAX_RETRIES", 3)
+	viper.SetDefault("REMOTE_WRITE_TIMEOUT", "10s")
+	viper.SetDefault("SLO_CONFIG", "")
+	viper.SetDefault("SLO_EVALUATION_INTERVAL", "30s")
+	viper.SetDefault("SLO_SEEN_TTL", "48h")
+	viper.SetDefault("SLO_ALERT_WEBHOOK_URL", "")
+	viper.SetDefault("ENVIRONMENT", "development")
+	viper.SetDefault("HEALTH_CHECK_INTERVAL", "10s")
 	
 	viper.AutomaticEnv()
 }
 
+// reflectionEnabled reports whether the gRPC server exposes reflection for
+// tools like grpcurl. It's on by default except in production, and
+// GRPC_REFLECTION overrides the default either way
+func reflectionEnabled() bool {
+	if viper.IsSet("GRPC_REFLECTION") {
+		return viper.GetBool("GRPC_REFLECTION")
+	}
+	switch viper.GetString("ENVIRONMENT") {
+	case "prod", "production":
+		return false
+	}
+	return true
+}
+
+// serviceResource describes the service in its traces and metrics
+func serviceResource() *resource.Resource {
+	return resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String("chronos-observatory"),
+		semconv.ServiceVersionKey.String("0.1.0"),
+	)
+}
+
 func initTracer() (*sdktrace.TracerProvider, error) {
 	ctx := context.Background()
 	
@@ -70,22 +148,63 @@ func initTracer() (*sdktrace.TracerProvider, error) {
 		return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
 	}
 	
-	resource := resource.NewWithAttributes(
-		semconv.SchemaURL,
-		semconv.ServiceNameKey.String("chronos-observatory"),
-		semconv.ServiceVersionKey.String("0.1.0"),
-	)
-	
 	provider := sdktrace.NewTracerProvider(
 		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource),
+		sdktrace.WithResource(serviceResource()),
 	)
 	
 	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
 	
 	return provider, nil
 }
 
+func initRedis() (*redis.Client, error) {
+	opts, err := redis.ParseURL(viper.GetString("REDIS_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing Redis URL: %w", err)
+	}
+	
+	client := redis.NewClient(opts)
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("connecting to Redis: %w", err)
+	}
+	
+	return client, nil
+}
+
+// initRemoteWriter returns the remote-write exporter, or nil when
+// REMOTE_WRITE_URL isn't set
+func initRemoteWriter() *remoteWriter {
+	url := viper.GetString("REMOTE_WRITE_URL")
+	if url == "" {
+		return nil
+	}
+	
+	batchSize := viper.GetInt("REMOTE_WRITE_BATCH_SIZE")
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	
+	return &remoteWriter{
+		url:        url,
+		client:     &http.Client{Timeout: viper.GetDuration("REMOTE_WRITE_TIMEOUT")},
+		gatherer:   prometheus.DefaultGatherer,
+		interval:   viper.GetDuration("REMOTE_WRITE_INTERVAL"),
+		batchSize:  batchSize,
+		maxRetries: viper.GetInt("REMOTE_WRITE_MAX_RETRIES"),
+		minBackoff: 500 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+	}
+}
+
 func setupOTLPCollector() error {
 	// In a real implementation, this would set up the OpenTelemetry Collector
 	// with appropriate receivers, processors, and exporters
@@ -116,11 +235,58 @@ func main() {
 		}
 	}()
 	
+	// Export the Prometheus metrics over OTLP too, alongside /metrics
+	mp, err := initMeter()
+	if err != nil {
+		log.Fatalf("Failed to initialize meter: %v", err)
+	}
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}()
+	
 	// Set up OpenTelemetry Collector
 	if err := setupOTLPCollector(); err != nil {
 		log.Fatalf("Failed to set up OpenTelemetry Collector: %v", err)
 	}
 	
+	// Initialize Redis, where the executor records workflow progress
+	redisClient, err := initRedis()
+	if err != nil {
+		log.Fatalf("Failed to initialize Redis: %v", err)
+	}
+	defer redisClient.Close()
+	
+	server := newObservatoryServer(redisClient, strings.TrimSuffix(viper.GetString("EXECUTOR_URL"), "/"),
+		&http.Client{Timeout: viper.GetDuration("EXECUTOR_TIMEOUT")})
+	
+	// Push metrics to a remote TSDB when configured
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if writer := initRemoteWriter(); writer != nil {
+		log.Printf("Pushing metrics to remote write endpoint %s", writer.url)
+		go writer.run(ctx)
+	}
+	
+	// Track workflow SLOs and their error budgets
+	slos, err := loadSLOs(viper.GetString("SLO_CONFIG"))
+	if err != nil {
+		log.Fatalf("Failed to load SLOs: %v", err)
+	}
+	tracker := newSLOTracker(redisClient, slos, viper.GetDuration("SLO_SEEN_TTL"), viper.GetString("SLO_ALERT_WEBHOOK_URL"))
+	if len(slos) > 0 {
+		go tracker.run(ctx, viper.GetDuration("SLO_EVALUATION_INTERVAL"))
+	}
+	
+	// Readiness follows Redis, which every query reads from
+	ready := newReadiness("observatory.ObservatoryService",
+		readinessCheck{name: "redis", check: func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}},
+	)
+	go ready.watch(ctx, viper.GetDuration("HEALTH_CHECK_INTERVAL"))
+	
 	// Set up gRPC server
 	port := viper.GetString("PORT")
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
@@ -130,6 +296,11 @@ func main() {
 	
 	grpcServer := grpc.NewServer()
 	// In a real implementation, this would register the observatory service
+	// observatory.RegisterObservatoryServiceServer(grpcServer, server)
+	ready.register(grpcServer)
+	if reflectionEnabled() {
+		reflection.Register(grpcServer)
+	}
 	
 	// Start gRPC server in a goroutine
 	go func() {
@@ -141,6 +312,10 @@ func main() {
 	
 	// Set up HTTP server for metrics
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/readyz", ready.handleReadyz)
+	
+	// Effective configuration, with secrets redacted
+	http.HandleFunc("/config", handleConfig)
 	
 	// Add a simple status endpoint
 	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
@@ -148,6 +323,15 @@ func main() {
 		w.Write([]byte("Observatory service is running"))
 	})
 	
+	// Live view of running workflows and their task progress
+	http.HandleFunc("/workflows/active", server.handleActiveWorkflows)
+	
+	// Task execution logs shipped by the workers
+	http.HandleFunc("/tasks/logs", server.handleTaskLogs)
+	
+	// SLO compliance and remaining error budgets
+	http.HandleFunc("/slos", tracker.handleSLOs)
+	
 	// Start HTTP server in a goroutine
 	prometheusPort := viper.GetString("PROMETHEUS_PORT")
 	httpServer := &http.Server{Addr: fmt.Sprintf(":%s", prometheusPort)}
@@ -165,6 +349,9 @@ func main() {
 	
 	log.Println("Shutting down servers...")
 	
+	// Report NOT_SERVING so traffic drains before the servers stop
+	ready.shutdown()
+	
 	// Shutdown HTTP server
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/viper"
+	promexporter "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// initMeter exports metrics over OTLP to OTLP_ENDPOINT every
+// METRICS_EXPORT_INTERVAL. The Prometheus collectors are bridged into the
+// export, so the observatory's own metrics flow through the same OTLP
+// pipeline as every other service's
+func initMeter() (*sdkmetric.MeterProvider, error) {
+	exporter, err := otlpmetricgrpc.New(
+		context.Background(),
+		otlpmetricgrpc.WithInsecure(),
+		otlpmetricgrpc.WithEndpoint(viper.GetString("OTLP_ENDPOINT")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP metric exporter: %w", err)
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(viper.GetDuration("METRICS_EXPORT_INTERVAL")),
+		sdkmetric.WithProducer(promexporter.NewMetricProducer()),
+	)
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(serviceResource()),
+	)
+
+	otel.SetMeterProvider(provider)
+	return provider, nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriteLabel is a single label of a remote-write time series
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+// remoteWriteSeries is one sample of a time series, as sent over remote-write
+type remoteWriteSeries struct {
+	labels    []remoteWriteLabel
+	value     float64
+	timestamp int64
+}
+
+// remoteWriter pushes the observatory's metrics to a Prometheus remote-write
+// endpoint (Mimir, Cortex, Thanos, ...) for deployments that can't scrape it
+type remoteWriter struct {
+	url        string
+	client     *http.Client
+	gatherer   prometheus.Gatherer
+	interval   time.Duration
+	batchSize  int
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// errRetryable marks a remote-write failure worth retrying
+var errRetryable = errors.New("retryable remote-write failure")
+
+// run gathers and pushes metrics every interval until ctx is cancelled
+func (w *remoteWriter) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.push(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Error pushing metrics to remote write endpoint: %v", err)
+			}
+		}
+	}
+}
+
+// push gathers the current metrics and sends them in batches
+func (w *remoteWriter) push(ctx context.Context) error {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics: %w", err)
+	}
+
+	series := seriesFromFamilies(families, time.Now().UnixMilli())
+	for start := 0; start < len(series); start += w.batchSize {
+		end := start + w.batchSize
+		if end > len(series) {
+			end = len(series)
+		}
+		batch := series[start:end]
+
+		if err := w.send(ctx, batch); err != nil {
+			remoteWriteRequests.WithLabelValues("failure").Inc()
+			remoteWriteSamples.WithLabelValues("failure").Add(float64(len(batch)))
+			return err
+		}
+		remoteWriteRequests.WithLabelValues("success").Inc()
+		remoteWriteSamples.WithLabelValues("success").Add(float64(len(batch)))
+	}
+
+	return nil
+}
+
+// send writes one batch, retrying transient failures with exponential backoff
+func (w *remoteWriter) send(ctx context.Context, batch []remoteWriteSeries) error {
+	body := snappy.Encode(nil, encodeWriteRequest(batch))
+	backoff := w.minBackoff
+
+	var err error
+	for attempt := 0; attempt <= w.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > w.maxBackoff {
+				backoff = w.maxBackoff
+			}
+		}
+
+		err = w.sendOnce(ctx, body)
+		if err == nil || !errors.Is(err, errRetryable) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// sendOnce makes a single remote-write request
+func (w *remoteWriter) sendOnce(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating remote write request: %w", err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "chronos-observatory")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRetryable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	// Server errors and rate limiting are transient; other client errors
+	// mean the batch itself was rejected and retrying won't help
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", errRetryable, err)
+	}
+	return err
+}
+
+// seriesFromFamilies flattens gathered metric families into remote-write
+// series, expanding histograms and summaries the way the text format does
+func seriesFromFamilies(families []*dto.MetricFamily, now int64) []remoteWriteSeries {
+	var series []remoteWriteSeries
+
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			ts := now
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			add := func(metricName string, value float64, extra ...remoteWriteLabel) {
+				series = append(series, remoteWriteSeries{
+					labels:    seriesLabels(metricName, m.GetLabel(), extra...),
+					value:     value,
+					timestamp: ts,
+				})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add(name+"_bucket", float64(b.GetCumulativeCount()),
+						remoteWriteLabel{"le", formatFloat(b.GetUpperBound())})
+				}
+				add(name+"_bucket", float64(h.GetSampleCount()), remoteWriteLabel{"le", "+Inf"})
+				add(name+"_sum", h.GetSampleSum())
+				add(name+"_count", float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, q.GetValue(), remoteWriteLabel{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", s.GetSampleSum())
+				add(name+"_count", float64(s.GetSampleCount()))
+			default:
+				add(name, m.GetUntyped().GetValue())
+			}
+		}
+	}
+
+	return series
+}
+
+// seriesLabels builds a sorted label set including __name__, as remote-write requires
+func seriesLabels(name string, pairs []*dto.LabelPair, extra ...remoteWriteLabel) []remoteWriteLabel {
+	labels := make([]remoteWriteLabel, 0, len(pairs)+len(extra)+1)
+	labels = append(labels, remoteWriteLabel{"__name__", name})
+	for _, p := range pairs {
+		labels = append(labels, remoteWriteLabel{p.GetName(), p.GetValue()})
+	}
+	labels = append(labels, extra...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest protobuf message:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []remoteWriteSeries) []byte {
+	var out []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendBytes(out, ts)
+	}
+	return out
+}
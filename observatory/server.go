@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// observatoryServer implements the ObservatoryService defined in
+// proto/observatory.proto
+type observatoryServer struct {
+	redis *redis.Client
+	// executorURL is the base URL of the executor's HTTP API, which serves
+	// the active runs
+	executorURL string
+	httpClient  *http.Client
+}
+
+func newObservatoryServer(redisClient *redis.Client, executorURL string, httpClient *http.Client) *observatoryServer {
+	return &observatoryServer{redis: redisClient, executorURL: executorURL, httpClient: httpClient}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// sloBucketSize is the granularity of the persisted SLO windows
+const sloBucketSize = 5 * time.Minute
+
+// Terminal run states the executor and durable engine record
+var terminalRunStates = map[string]bool{
+	"COMPLETED": true,
+	"FAILED":    true,
+	"CANCELLED": true,
+	"TIMED_OUT": true,
+}
+
+// SLO is an objective for one workflow, e.g. "99% of runs complete under
+// 5 minutes over 30 days"
+type SLO struct {
+	Name     string `json:"name"`
+	Workflow string `json:"workflow"`
+	// Objective is the target fraction of good runs, e.g. 0.99
+	Objective float64 `json:"objective"`
+	// Latency, when set, also requires good runs to finish within it
+	Latency duration `json:"latency,omitempty"`
+	Window  duration `json:"window"`
+	// BurnRateThreshold is the burn rate over BurnWindow that fires an alert
+	BurnRateThreshold float64  `json:"burn_rate_threshold"`
+	BurnWindow        duration `json:"burn_window"`
+}
+
+// duration is a time.Duration that decodes from strings like "5m"
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// SLOStatus is an SLO's current compliance and error budget
+type SLOStatus struct {
+	SLO                  *SLO    `json:"slo"`
+	TotalRuns            int64   `json:"total_runs"`
+	GoodRuns             int64   `json:"good_runs"`
+	Compliance           float64 `json:"compliance"`
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"`
+	BurnRate             float64 `json:"burn_rate"`
+	Alerting             bool    `json:"alerting"`
+}
+
+// loadSLOs parses the SLO definitions from SLO_CONFIG, a JSON array
+func loadSLOs(config string) ([]*SLO, error) {
+	if strings.TrimSpace(config) == "" {
+		return nil, nil
+	}
+
+	var slos []*SLO
+	if err := json.Unmarshal([]byte(config), &slos); err != nil {
+		return nil, fmt.Errorf("parsing SLO config: %w", err)
+	}
+
+	seen := make(map[string]bool, len(slos))
+	for _, slo := range slos {
+		if slo.Name == "" {
+			slo.Name = slo.Workflow
+		}
+		if slo.Workflow == "" {
+			return nil, fmt.Errorf("SLO %q has no workflow", slo.Name)
+		}
+		if seen[slo.Name] {
+			return nil, fmt.Errorf("duplicate SLO %q", slo.Name)
+		}
+		seen[slo.Name] = true
+		if slo.Objective <= 0 || slo.Objective >= 1 {
+			return nil, fmt.Errorf("SLO %q objective must be between 0 and 1", slo.Name)
+		}
+		if slo.Window <= 0 {
+			slo.Window = duration(30 * 24 * time.Hour)
+		}
+		if slo.BurnWindow <= 0 {
+			slo.BurnWindow = duration(time.Hour)
+		}
+		if slo.BurnRateThreshold <= 0 {
+			slo.BurnRateThreshold = 14.4
+		}
+	}
+
+	return slos, nil
+}
+
+// sloTracker counts good and total runs per SLO in time buckets kept in
+// Redis, so windows survive observatory restarts
+type sloTracker struct {
+	redis      *redis.Client
+	slos       []*SLO
+	seenTTL    time.Duration
+	webhookURL string
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	alerting map[string]bool
+}
+
+func newSLOTracker(client *redis.Client, slos []*SLO, seenTTL time.Duration, webhookURL string) *sloTracker {
+	return &sloTracker{
+		redis:      client,
+		slos:       slos,
+		seenTTL:    seenTTL,
+		webhookURL: webhookURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		alerting:   make(map[string]bool),
+	}
+}
+
+func sloBucketsKey(name string) string {
+	return "chronos:slo:" + name + ":buckets"
+}
+
+func sloSeenKey(runID string) string {
+	return "chronos:slo:seen:" + runID
+}
+
+// run ingests finished runs and re-evaluates every SLO each interval
+func (t *sloTracker) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.ingest(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error ingesting runs for SLOs: %v", err)
+		}
+		if _, err := t.evaluate(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error evaluating SLOs: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ingest scans the executor's run progress for finished runs and counts
+// each one once against the SLOs for its workflow
+func (t *sloTracker) ingest(ctx context.Context) error {
+	byWorkflow := make(map[string][]*SLO)
+	for _, slo := range t.slos {
+		byWorkflow[slo.Workflow] = append(byWorkflow[slo.Workflow], slo)
+	}
+
+	iter := t.redis.Scan(ctx, 0, tenantKey("*", "workflow", "*"), 100).Iterator()
+	for iter.Next(ctx) {
+		fields, err := t.redis.HGetAll(ctx, iter.Val()).Result()
+		if err != nil {
+			return fmt.Errorf("reading run progress %s: %w", iter.Val(), err)
+		}
+		slos := byWorkflow[fields["name"]]
+		if len(slos) == 0 || !terminalRunStates[fields["state"]] {
+			continue
+		}
+
+		// Count the run only the first time it's seen finished
+		first, err := t.redis.SetNX(ctx, sloSeenKey(fields["run_id"]), 1, t.seenTTL).Result()
+		if err != nil {
+			return fmt.Errorf("marking run %s counted: %w", fields["run_id"], err)
+		}
+		if !first {
+			continue
+		}
+
+		startedAt, _ := time.Parse(time.RFC3339Nano, fields["started_at"])
+		finishedAt, _ := time.Parse(time.RFC3339Nano, fields["updated_at"])
+		for _, slo := range slos {
+			good := fields["state"] == "COMPLETED" &&
+				(slo.Latency <= 0 || finishedAt.Sub(startedAt) <= time.Duration(slo.Latency))
+			if err := t.record(ctx, slo, finishedAt, good); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("scanning run progress: %w", err)
+	}
+
+	return nil
+}
+
+// record counts one run in the bucket covering its finish time
+func (t *sloTracker) record(ctx context.Context, slo *SLO, at time.Time, good bool) error {
+	bucket := strconv.FormatInt(at.Truncate(sloBucketSize).Unix(), 10)
+	pipe := t.redis.TxPipeline()
+	pipe.HIncrBy(ctx, sloBucketsKey(slo.Name), bucket+":total", 1)
+	if good {
+		pipe.HIncrBy(ctx, sloBucketsKey(slo.Name), bucket+":good", 1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("recording run for SLO %s: %w", slo.Name, err)
+	}
+	return nil
+}
+
+// evaluate computes every SLO's status, updates the gauges, prunes expired
+// buckets, and fires an alert when an SLO starts burning its budget too fast
+func (t *sloTracker) evaluate(ctx context.Context) ([]*SLOStatus, error) {
+	now := time.Now()
+	statuses := make([]*SLOStatus, 0, len(t.slos))
+
+	for _, slo := range t.slos {
+		buckets, err := t.redis.HGetAll(ctx, sloBucketsKey(slo.Name)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("reading SLO %s buckets: %w", slo.Name, err)
+		}
+
+		windowStart := now.Add(-time.Duration(slo.Window))
+		burnStart := now.Add(-time.Duration(slo.BurnWindow))
+		var burnTotal, burnGood int64
+		var expired []string
+		status := &SLOStatus{SLO: slo}
+
+		for field, value := range buckets {
+			bucket, kind, ok := strings.Cut(field, ":")
+			unix, err := strconv.ParseInt(bucket, 10, 64)
+			if !ok || err != nil {
+				continue
+			}
+			start := time.Unix(unix, 0)
+			if start.Add(sloBucketSize).Before(windowStart) {
+				expired = append(expired, field)
+				continue
+			}
+
+			count, _ := strconv.ParseInt(value, 10, 64)
+			inBurn := !start.Add(sloBucketSize).Before(burnStart)
+			switch kind {
+			case "total":
+				status.TotalRuns += count
+				if inBurn {
+					burnTotal += count
+				}
+			case "good":
+				status.GoodRuns += count
+				if inBurn {
+					burnGood += count
+				}
+			}
+		}
+		if len(expired) > 0 {
+			t.redis.HDel(ctx, sloBucketsKey(slo.Name), expired...)
+		}
+
+		budget := 1 - slo.Objective
+		status.Compliance = 1
+		status.ErrorBudgetRemaining = 1
+		if status.TotalRuns > 0 {
+			status.Compliance = float64(status.GoodRuns) / float64(status.TotalRuns)
+			status.ErrorBudgetRemaining = 1 - (1-status.Compliance)/budget
+		}
+		if burnTotal > 0 {
+			status.BurnRate = (1 - float64(burnGood)/float64(burnTotal)) / budget
+		}
+		status.Alerting = status.BurnRate >= slo.BurnRateThreshold
+
+		sloCompliance.WithLabelValues(slo.Name).Set(status.Compliance)
+		sloErrorBudgetRemaining.WithLabelValues(slo.Name).Set(status.ErrorBudgetRemaining)
+		sloBurnRate.WithLabelValues(slo.Name).Set(status.BurnRate)
+
+		t.mu.Lock()
+		firing := status.Alerting && !t.alerting[slo.Name]
+		t.alerting[slo.Name] = status.Alerting
+		t.mu.Unlock()
+		if firing {
+			t.fireAlert(ctx, status)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// fireAlert reports an SLO whose error budget is burning too fast, posting
+// the status to SLO_ALERT_WEBHOOK_URL when one is configured
+func (t *sloTracker) fireAlert(ctx context.Context, status *SLOStatus) {
+	sloAlerts.WithLabelValues(status.SLO.Name).Inc()
+	log.Printf("SLO %s is burning its error budget at %.1fx (threshold %.1fx), %.1f%% remaining",
+		status.SLO.Name, status.BurnRate, status.SLO.BurnRateThreshold, status.ErrorBudgetRemaining*100)
+
+	if t.webhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(status)
+	if err != nil {
+		log.Printf("Error encoding SLO alert: %v", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error creating SLO alert request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		log.Printf("Error sending SLO alert: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("SLO alert webhook returned %s", resp.Status)
+	}
+}
+
+// handleSLOs serves GET /slos
+func (t *sloTracker) handleSLOs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses, err := t.evaluate(r.Context())
+	if err != nil {
+		log.Printf("Error evaluating SLOs: %v", err)
+		http.Error(w, "evaluating SLOs failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
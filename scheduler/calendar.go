@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
+)
+
+// holidayDateLayout is the layout holiday dates are configured in
+const holidayDateLayout = "2006-01-02"
+
+// maxSkippedDays bounds how far a calendar schedule searches for an allowed day
+const maxSkippedDays = 366
+
+// loadHolidayCalendar reads a named holiday calendar from the
+// HOLIDAY_CALENDAR_<NAME> config key as a comma-separated list of dates
+func loadHolidayCalendar(name string) (map[string]struct{}, error) {
+	key := "HOLIDAY_CALENDAR_" + strings.ToUpper(name)
+	raw := viper.GetString(key)
+	if raw == "" {
+		return nil, fmt.Errorf("holiday calendar %q is not configured (set %s)", name, key)
+	}
+
+	holidays := make(map[string]struct{})
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		date, err := time.Parse(holidayDateLayout, field)
+		if err != nil {
+			return nil, fmt.Errorf("parsing date %q in holiday calendar %q: %w", field, name, err)
+		}
+		holidays[date.Format(holidayDateLayout)] = struct{}{}
+	}
+
+	return holidays, nil
+}
+
+// calendarSchedule wraps a cron schedule and suppresses fires that land on
+// weekends (when businessDaysOnly is set) or on configured holidays
+type calendarSchedule struct {
+	schedule         cron.Schedule
+	location         *time.Location
+	businessDaysOnly bool
+	holidays         map[string]struct{}
+}
+
+// Next returns the next fire time after t that falls on an allowed day
+func (s *calendarSchedule) Next(t time.Time) time.Time {
+	next := s.schedule.Next(t)
+	for i := 0; i < maxSkippedDays && !next.IsZero(); i++ {
+		if !s.excluded(next) {
+			return next
+		}
+		// Jump to the last instant of the excluded day so the next fire
+		// considered is the first one on the following day
+		local := next.In(s.location)
+		year, month, day := local.Date()
+		endOfDay := time.Date(year, month, day+1, 0, 0, 0, 0, s.location).Add(-time.Second)
+		next = s.schedule.Next(endOfDay)
+	}
+
+	return time.Time{}
+}
+
+// excluded reports whether t falls on a weekend or holiday in the schedule's timezone
+func (s *calendarSchedule) excluded(t time.Time) bool {
+	t = t.In(s.location)
+	if s.businessDaysOnly {
+		if weekday := t.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+			return true
+		}
+	}
+	_, holiday := s.holidays[t.Format(holidayDateLayout)]
+	return holiday
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+)
+
+// Policies for a dependent schedule whose upstream workflow failed
+const (
+	upstreamFailureSkip = "skip"
+	upstreamFailureRun  = "run"
+)
+
+// Terminal workflow states reported in workflow events
+const (
+	workflowStateCompleted = "COMPLETED"
+	workflowStateFailed    = "FAILED"
+)
+
+// workflowEvent is published when a workflow run reaches a terminal state
+type workflowEvent struct {
+	WorkflowID  string    `json:"workflow_id"`
+	RunID       string    `json:"run_id"`
+	TenantID    string    `json:"tenant_id"`
+	ScheduleID  string    `json:"schedule_id"`
+	State       string    `json:"state"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// pingKafka checks that the Kafka broker accepts connections
+func pingKafka(ctx context.Context) error {
+	conn, err := kafkaDialer.DialContext(ctx, "tcp", viper.GetString("KAFKA_BROKERS"))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func initKafkaEventReader() *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     []string{viper.GetString("KAFKA_BROKERS")},
+		Topic:       viper.GetString("KAFKA_EVENTS_TOPIC"),
+		GroupID:     "chronos-scheduler",
+		Dialer:      kafkaDialer,
+		MinBytes:    1,
+		MaxBytes:    10e6, // 10MB
+		StartOffset: kafka.LastOffset,
+	})
+}
+
+// eventReader is the part of a Kafka reader workflow events are consumed through
+type eventReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+}
+
+// consumeWorkflowEvents arms dependent schedules as upstream workflows finish
+func consumeWorkflowEvents(ctx context.Context, reader eventReader, server *schedulerServer) {
+	log.Println("Starting Kafka consumer for workflow events")
+
+	for {
+		message, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Println("Stopping Kafka consumer for workflow events")
+				return
+			}
+			log.Printf("Error reading workflow event: %v", err)
+			continue
+		}
+
+		var event workflowEvent
+		if err := json.Unmarshal(message.Value, &event); err != nil {
+			log.Printf("Error decoding workflow event: %v", err)
+			continue
+		}
+
+		server.handleWorkflowEvent(event)
+	}
+}
+
+// handleWorkflowEvent arms every schedule that triggers after the schedule
+// that produced the finished workflow run
+func (s *schedulerServer) handleWorkflowEvent(event workflowEvent) {
+	if event.ScheduleID == "" {
+		return
+	}
+	if event.State != workflowStateCompleted && event.State != workflowStateFailed {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sched := range s.schedules {
+		if sched.TriggerAfter != event.ScheduleID || sched.TenantID != event.TenantID {
+			continue
+		}
+		if event.State == workflowStateFailed && sched.OnUpstreamFailure != upstreamFailureRun {
+			log.Printf("Skipping schedule %s: upstream schedule %s failed", sched.ID, event.ScheduleID)
+			continue
+		}
+
+		log.Printf("Arming schedule %s to fire in %s after schedule %s finished", sched.ID, sched.TriggerDelay, event.ScheduleID)
+		if sched.pending != nil {
+			sched.pending.Stop()
+		}
+		dependent := sched
+		sched.pending = time.AfterFunc(sched.TriggerDelay, func() {
+			s.fire(dependent)
+		})
+	}
+}
+
+// ListSchedules returns the registered schedules matching a label selector,
+// ordered by ID, with each schedule's dependents populated so callers can
+// walk the dependency graph
+func (s *schedulerServer) ListSchedules(ctx context.Context, selector string) ([]*Schedule, error) {
+	required, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dependents := make(map[string][]string)
+	for _, sched := range s.schedules {
+		if sched.TriggerAfter != "" {
+			dependents[sched.TriggerAfter] = append(dependents[sched.TriggerAfter], sched.ID)
+		}
+	}
+
+	schedules := make([]*Schedule, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		if !visibleToTenant(ctx, sched.TenantID) || !matchesLabels(sched.Labels, required) {
+			continue
+		}
+		listed := *sched
+		listed.Dependents = dependents[sched.ID]
+		sort.Strings(listed.Dependents)
+		schedules = append(schedules, &listed)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].ID < schedules[j].ID
+	})
+
+	return schedules, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robfig/cron/v3"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc/metadata"
+)
+
+// withTenant returns a context as a client of the given tenant calls with
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(tenantMetadataKey, tenant))
+}
+
+// queuedEvents is an event reader serving a fixed set of messages, then
+// blocking until ctx is cancelled
+type queuedEvents struct {
+	messages []kafka.Message
+}
+
+func (q *queuedEvents) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	if len(q.messages) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	message := q.messages[0]
+	q.messages = q.messages[1:]
+	return message, nil
+}
+
+// executorEvent is a workflow event as the executor publishes it
+func executorEvent(scheduleID, state string) kafka.Message {
+	return kafka.Message{
+		Key: []byte("acme/wf-ingest"),
+		Value: []byte(`{"workflow_id":"wf-ingest","run_id":"run-1","tenant_id":"acme","schedule_id":"` + scheduleID +
+			`","state":"` + state + `","completed_at":"2026-10-16T08:00:00Z"}`),
+	}
+}
+
+func registerPipeline(t *testing.T, onFailure, team string) (*schedulerServer, string) {
+	t.Helper()
+	server := newSchedulerServer(cron.New())
+	ctx := withTenant(context.Background(), "acme")
+	upstream, err := server.RegisterSchedule(ctx, &Schedule{WorkflowID: "wf-ingest", CronExpr: "0 0 * * * *"})
+	if err != nil {
+		t.Fatalf("registering upstream: %v", err)
+	}
+	_, err = server.RegisterSchedule(ctx, &Schedule{
+		WorkflowID:        "wf-reconcile",
+		TriggerAfter:      upstream,
+		TriggerDelay:      10 * time.Millisecond,
+		OnUpstreamFailure: onFailure,
+		Labels:            map[string]string{metricLabelKey: team},
+	})
+	if err != nil {
+		t.Fatalf("registering dependent: %v", err)
+	}
+	return server, upstream
+}
+
+// consumeEvents runs the events consumer over messages, then waits past the
+// dependent's trigger delay
+func consumeEvents(server *schedulerServer, messages ...kafka.Message) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		consumeWorkflowEvents(ctx, &queuedEvents{messages: messages}, server)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestDependentScheduleFiresAfterUpstreamCompletes(t *testing.T) {
+	server, upstream := registerPipeline(t, upstreamFailureSkip, "deps-completed")
+	fired := scheduledWorkflows.WithLabelValues("deps-completed")
+
+	consumeEvents(server, executorEvent(upstream, workflowStateCompleted))
+	if got := testutil.ToFloat64(fired); got != 1 {
+		t.Errorf("dependent fired %v times, want 1", got)
+	}
+}
+
+func TestDependentScheduleUpstreamFailurePolicy(t *testing.T) {
+	skip, upstream := registerPipeline(t, upstreamFailureSkip, "deps-skip")
+	consumeEvents(skip, executorEvent(upstream, workflowStateFailed))
+	if got := testutil.ToFloat64(scheduledWorkflows.WithLabelValues("deps-skip")); got != 0 {
+		t.Errorf("skipping dependent fired %v times after its upstream failed, want 0", got)
+	}
+
+	run, upstream := registerPipeline(t, upstreamFailureRun, "deps-run")
+	consumeEvents(run, executorEvent(upstream, workflowStateFailed))
+	if got := testutil.ToFloat64(scheduledWorkflows.WithLabelValues("deps-run")); got != 1 {
+		t.Errorf("running dependent fired %v times after its upstream failed, want 1", got)
+	}
+}
+
+func TestDependentScheduleIgnoresOtherTenantsAndSchedules(t *testing.T) {
+	server, upstream := registerPipeline(t, upstreamFailureSkip, "deps-other")
+
+	otherTenant := executorEvent(upstream, workflowStateCompleted)
+	otherTenant.Value = []byte(`{"workflow_id":"wf-ingest","run_id":"run-1","tenant_id":"globex","schedule_id":"` +
+		upstream + `","state":"COMPLETED"}`)
+	consumeEvents(server,
+		otherTenant,
+		executorEvent("schedule-unrelated", workflowStateCompleted),
+		executorEvent("", workflowStateCompleted),
+		kafka.Message{Value: []byte("not json")},
+	)
+	if got := testutil.ToFloat64(scheduledWorkflows.WithLabelValues("deps-other")); got != 0 {
+		t.Errorf("dependent fired %v times, want 0", got)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// metricLabelKey is the only workflow label promoted to a metric label, so
+// series cardinality stays bounded by the number of teams
+const metricLabelKey = "team"
+
+// parseLabelSelector parses a selector such as "team=payments,env=prod"
+// into the labels a resource must carry to match
+func parseLabelSelector(selector string) (map[string]string, error) {
+	required := make(map[string]string)
+	if strings.TrimSpace(selector) == "" {
+		return required, nil
+	}
+
+	for _, term := range strings.Split(selector, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(term), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label selector term %q, expected key=value", term)
+		}
+		required[key] = strings.TrimSpace(value)
+	}
+
+	return required, nil
+}
+
+// matchesLabels reports whether labels carry every required key and value
+func matchesLabels(labels, required map[string]string) bool {
+	for key, value := range required {
+		if actual, ok := labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
@@ -18,18 +18,20 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 )
 
 // Prometheus metrics
 var (
-	scheduledWorkflows = prometheus.NewCounter(prometheus.CounterOpts{
+	scheduledWorkflows = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "chronos_scheduler_workflows_scheduled_total",
 		Help: "Total number of workflows scheduled",
-	})
+	}, []string{metricLabelKey})
 	
 	schedulingLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name:    "chronos_scheduler_scheduling_latency_seconds",
@@ -47,11 +49,46 @@ func init() {
 	viper.SetDefault("PORT", "8080")
 	viper.SetDefault("KAFKA_BROKERS", "localhost:9092")
 	viper.SetDefault("KAFKA_TOPIC", "chronos-workflows")
+	viper.SetDefault("KAFKA_EVENTS_TOPIC", "chronos-workflow-events")
+	viper.SetDefault("KAFKA_SASL_MECHANISM", "")
+	viper.SetDefault("KAFKA_SASL_USERNAME", "")
+	viper.SetDefault("KAFKA_SASL_PASSWORD", "")
+	viper.SetDefault("KAFKA_TLS_ENABLED", false)
+	viper.SetDefault("KAFKA_TLS_CA_FILE", "")
+	viper.SetDefault("KAFKA_TLS_CERT_FILE", "")
+	viper.SetDefault("KAFKA_TLS_KEY_FILE", "")
+	viper.SetDefault("KAFKA_TLS_INSECURE_SKIP_VERIFY", false)
 	viper.SetDefault("OTLP_ENDPOINT", "localhost:4317")
+	viper.SetDefault("METRICS_EXPORT_INTERVAL", "30s")
+	viper.SetDefault("ENVIRONMENT", "development")
+	viper.SetDefault("HEALTH_CHECK_INTERVAL", "10s")
 	
 	viper.AutomaticEnv()
 }
 
+// reflectionEnabled reports whether the gRPC server exposes reflection for
+// tools like grpcurl. It's on by default except in production, and
+// GRPC_REFLECTION overrides the default either way
+func reflectionEnabled() bool {
+	if viper.IsSet("GRPC_REFLECTION") {
+		return viper.GetBool("GRPC_REFLECTION")
+	}
+	switch viper.GetString("ENVIRONMENT") {
+	case "prod", "production":
+		return false
+	}
+	return true
+}
+
+// serviceResource describes the service in its traces and metrics
+func serviceResource() *resource.Resource {
+	return resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String("chronos-scheduler"),
+		semconv.ServiceVersionKey.String("0.1.0"),
+	)
+}
+
 func initTracer() (*sdktrace.TracerProvider, error) {
 	ctx := context.Background()
 	
@@ -66,18 +103,16 @@ func initTracer() (*sdktrace.TracerProvider, error) {
 		return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
 	}
 	
-	resource := resource.NewWithAttributes(
-		semconv.SchemaURL,
-		semconv.ServiceNameKey.String("chronos-scheduler"),
-		semconv.ServiceVersionKey.String("0.1.0"),
-	)
-	
 	provider := sdktrace.NewTracerProvider(
 		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource),
+		sdktrace.WithResource(serviceResource()),
 	)
 	
 	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
 	
 	return provider, nil
 }
@@ -96,13 +131,45 @@ func main() {
 		}
 	}()
 	
+	// Export the Prometheus metrics over OTLP too, alongside /metrics
+	mp, err := initMeter()
+	if err != nil {
+		log.Fatalf("Failed to initialize meter: %v", err)
+	}
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}()
+	
 	// Create a new cron scheduler
-	c := cron.New(cron.WithSeconds())
+	c := cron.New(cron.WithParser(scheduleParser))
 	
 	// Start the cron scheduler
 	c.Start()
 	defer c.Stop()
 	
+	server := newSchedulerServer(c)
+	
+	// Kafka authentication and encryption
+	kafkaDialer, err = initKafkaDialer()
+	if err != nil {
+		log.Fatalf("Failed to configure Kafka security: %v", err)
+	}
+	
+	// Start the workflow event consumer that arms dependent schedules
+	eventReader := initKafkaEventReader()
+	defer eventReader.Close()
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	go consumeWorkflowEvents(ctx, eventReader, server)
+	
+	// Readiness follows Kafka, which carries the workflow events
+	ready := newReadiness("scheduler.SchedulerService",
+		readinessCheck{name: "kafka", check: pingKafka},
+	)
+	go ready.watch(ctx, viper.GetDuration("HEALTH_CHECK_INTERVAL"))
+	
 	// Set up gRPC server
 	port := viper.GetString("PORT")
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
@@ -111,8 +178,12 @@ func main() {
 	}
 	
 	grpcServer := grpc.NewServer()
-	// Register the scheduler service (implementation would be in a separate file)
-	// scheduler.RegisterSchedulerServiceServer(grpcServer, &schedulerServer{})
+	// Register the scheduler service
+	// scheduler.RegisterSchedulerServiceServer(grpcServer, server)
+	ready.register(grpcServer)
+	if reflectionEnabled() {
+		reflection.Register(grpcServer)
+	}
 	
 	// Start gRPC server in a goroutine
 	go func() {
@@ -124,6 +195,10 @@ func main() {
 	
 	// Set up HTTP server for metrics
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/readyz", ready.handleReadyz)
+	
+	// Effective configuration, with secrets redacted
+	http.HandleFunc("/config", handleConfig)
 	
 	// Start HTTP server in a goroutine
 	httpServer := &http.Server{Addr: ":8090"}
@@ -141,10 +216,16 @@ func main() {
 	
 	log.Println("Shutting down servers...")
 	
+	// Report NOT_SERVING so traffic drains before the servers stop
+	ready.shutdown()
+	
+	// Cancel context to stop the workflow event consumer
+	cancel()
+	
 	// Shutdown HTTP server
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := httpServer.Shutdown(ctx); err != nil {
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 	
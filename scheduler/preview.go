@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// maxPreviewCount caps how many fire times a single preview may return
+const maxPreviewCount = 100
+
+// scheduleParser parses cron expressions exactly as the running cron scheduler does
+var scheduleParser = cron.NewParser(
+	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// PreviewSchedule returns the next count fire times of a cron expression
+// in the given timezone without registering anything
+func (s *schedulerServer) PreviewSchedule(ctx context.Context, cronExpr, timezone string, count int) ([]time.Time, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive, got %d", count)
+	}
+	if count > maxPreviewCount {
+		count = maxPreviewCount
+	}
+
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := parseSchedule(cronExpr, timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	fireTimes := make([]time.Time, 0, count)
+	next := time.Now().In(loc)
+	for i := 0; i < count; i++ {
+		next = schedule.Next(next)
+		// A zero time means the schedule will never fire again
+		if next.IsZero() {
+			break
+		}
+		fireTimes = append(fireTimes, next)
+	}
+
+	return fireTimes, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Schedule describes a workflow registered to run on a cron schedule
+type Schedule struct {
+	ID               string
+	TenantID         string
+	WorkflowID       string
+	CronExpr         string
+	Timezone         string
+	BusinessDaysOnly bool
+	HolidayCalendar  string
+	// TriggerAfter references the schedule whose workflow completion fires
+	// this schedule, in place of a cron expression
+	TriggerAfter string
+	// TriggerDelay is how long after the upstream finishes this schedule fires
+	TriggerDelay time.Duration
+	// OnUpstreamFailure is either "skip" (the default) or "run"
+	OnUpstreamFailure string
+	// Dependents lists the schedules that trigger after this one
+	Dependents []string
+	Labels     map[string]string
+	CreatedAt  time.Time
+
+	entryID cron.EntryID
+	pending *time.Timer
+}
+
+// loadLocation resolves a timezone name, defaulting to UTC when empty
+func loadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("loading timezone %q: %w", timezone, err)
+	}
+	return loc, nil
+}
+
+// parseSchedule parses a cron expression evaluated in the given timezone
+func parseSchedule(cronExpr, timezone string) (cron.Schedule, error) {
+	if cronExpr == "" {
+		return nil, fmt.Errorf("cron expression is required")
+	}
+	if _, err := loadLocation(timezone); err != nil {
+		return nil, err
+	}
+
+	spec := cronExpr
+	if timezone != "" {
+		spec = fmt.Sprintf("CRON_TZ=%s %s", timezone, cronExpr)
+	}
+	schedule, err := scheduleParser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cron expression %q: %w", cronExpr, err)
+	}
+
+	return schedule, nil
+}
+
+// buildSchedule constructs the cron schedule for a registered schedule,
+// wrapping it with calendar rules when any are configured
+func buildSchedule(sched *Schedule) (cron.Schedule, error) {
+	schedule, err := parseSchedule(sched.CronExpr, sched.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sched.BusinessDaysOnly && sched.HolidayCalendar == "" {
+		return schedule, nil
+	}
+
+	loc, err := loadLocation(sched.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	calendar := &calendarSchedule{
+		schedule:         schedule,
+		location:         loc,
+		businessDaysOnly: sched.BusinessDaysOnly,
+	}
+	if sched.HolidayCalendar != "" {
+		calendar.holidays, err = loadHolidayCalendar(sched.HolidayCalendar)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return calendar, nil
+}
+
+// newScheduleID generates a random identifier for a schedule
+func newScheduleID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "schedule-" + hex.EncodeToString(b)
+}
+
+// RegisterSchedule validates a schedule and registers it with the cron
+// scheduler, or against its upstream schedule when TriggerAfter is set
+func (s *schedulerServer) RegisterSchedule(ctx context.Context, sched *Schedule) (string, error) {
+	if sched.WorkflowID == "" {
+		return "", fmt.Errorf("workflow ID is required")
+	}
+	if tenant := tenantFromContext(ctx); tenant != "" {
+		sched.TenantID = tenant
+	}
+
+	var schedule cron.Schedule
+	if sched.TriggerAfter != "" {
+		if sched.CronExpr != "" {
+			return "", fmt.Errorf("a schedule cannot set both a cron expression and TriggerAfter")
+		}
+		if sched.TriggerDelay < 0 {
+			return "", fmt.Errorf("trigger delay must not be negative, got %s", sched.TriggerDelay)
+		}
+		switch sched.OnUpstreamFailure {
+		case "":
+			sched.OnUpstreamFailure = upstreamFailureSkip
+		case upstreamFailureSkip, upstreamFailureRun:
+		default:
+			return "", fmt.Errorf("unknown upstream failure policy %q", sched.OnUpstreamFailure)
+		}
+	} else {
+		var err error
+		schedule, err = buildSchedule(sched)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sched.ID == "" {
+		sched.ID = newScheduleID()
+	}
+	if _, exists := s.schedules[sched.ID]; exists {
+		return "", fmt.Errorf("schedule %s already exists", sched.ID)
+	}
+	if sched.TriggerAfter != "" {
+		// Upstreams must already exist, which also rules out dependency cycles
+		if sched.TriggerAfter == sched.ID {
+			return "", fmt.Errorf("schedule %s cannot trigger after itself", sched.ID)
+		}
+		upstream, ok := s.schedules[sched.TriggerAfter]
+		if !ok || upstream.TenantID != sched.TenantID {
+			return "", fmt.Errorf("upstream schedule %s not found", sched.TriggerAfter)
+		}
+	}
+
+	sched.CreatedAt = time.Now()
+	sched.Dependents = nil
+	if schedule != nil {
+		sched.entryID = s.cron.Schedule(schedule, cron.FuncJob(func() {
+			s.fire(sched)
+		}))
+		log.Printf("Registered schedule %s for workflow %s (%s)", sched.ID, sched.WorkflowID, sched.CronExpr)
+	} else {
+		log.Printf("Registered schedule %s for workflow %s (after schedule %s)", sched.ID, sched.WorkflowID, sched.TriggerAfter)
+	}
+	s.schedules[sched.ID] = sched
+
+	return sched.ID, nil
+}
+
+// RemoveSchedule unregisters a schedule so it no longer fires
+func (s *schedulerServer) RemoveSchedule(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sched, ok := s.schedules[id]
+	if !ok || !visibleToTenant(ctx, sched.TenantID) {
+		return fmt.Errorf("schedule %s not found", id)
+	}
+	for _, other := range s.schedules {
+		if other.TriggerAfter == id {
+			return fmt.Errorf("schedule %s has dependent schedule %s", id, other.ID)
+		}
+	}
+
+	if sched.TriggerAfter == "" {
+		s.cron.Remove(sched.entryID)
+	}
+	if sched.pending != nil {
+		sched.pending.Stop()
+	}
+	delete(s.schedules, id)
+
+	log.Printf("Removed schedule %s", id)
+
+	return nil
+}
+
+// fire triggers a run of the scheduled workflow
+func (s *schedulerServer) fire(sched *Schedule) {
+	start := time.Now()
+
+	attrs := []attribute.KeyValue{
+		attribute.String("schedule.id", sched.ID),
+		attribute.String("workflow.id", sched.WorkflowID),
+		attribute.String("tenant.id", sched.TenantID),
+	}
+	for key, value := range sched.Labels {
+		attrs = append(attrs, attribute.String("label."+key, value))
+	}
+	_, span := otel.Tracer("chronos-scheduler").Start(context.Background(), "scheduler.fire",
+		trace.WithAttributes(attrs...))
+	defer span.End()
+
+	log.Printf("Schedule %s triggering workflow %s", sched.ID, sched.WorkflowID)
+	// In a real implementation, this would publish the workflow run to Kafka,
+	// tagged with the tenant and schedule IDs so dependent schedules can be armed
+
+	scheduledWorkflows.WithLabelValues(sched.Labels[metricLabelKey]).Inc()
+	schedulingLatency.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/robfig/cron/v3"
+)
+
+// schedulerServer implements the scheduler gRPC service
+type schedulerServer struct {
+	cron      *cron.Cron
+	schedules map[string]*Schedule
+	mu        sync.RWMutex
+}
+
+// newSchedulerServer creates a scheduler server backed by the given cron scheduler
+func newSchedulerServer(c *cron.Cron) *schedulerServer {
+	return &schedulerServer{
+		cron:      c,
+		schedules: make(map[string]*Schedule),
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// tenantMetadataKey is the gRPC metadata key carrying the caller's tenant ID
+const tenantMetadataKey = "x-chronos-tenant"
+
+// tenantFromContext returns the tenant ID of the calling client, or an empty
+// string when the request carries none
+func tenantFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(tenantMetadataKey); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// visibleToTenant reports whether a resource owned by ownerID may be seen by
+// the calling tenant; callers without a tenant see every resource
+func visibleToTenant(ctx context.Context, ownerID string) bool {
+	tenant := tenantFromContext(ctx)
+	return tenant == "" || tenant == ownerID
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"hash/fnv"
+)
+
+// preferredWorker picks the worker an affinity key is pinned to, using
+// rendezvous hashing: every worker is scored by hashing it with the key and
+// the highest score wins. Adding or removing a worker only moves the keys
+// pinned to it, so caches on the other workers stay warm
+func preferredWorker(workers []*Worker, affinityKey string) *Worker {
+	var best *Worker
+	var bestScore uint64
+	for _, worker := range workers {
+		if score := affinityScore(affinityKey, worker.ID); best == nil || score > bestScore {
+			best, bestScore = worker, score
+		}
+	}
+	return best
+}
+
+// affinityScore hashes an affinity key together with a worker ID
+func affinityScore(affinityKey, workerID string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(affinityKey))
+	h.Write([]byte{0})
+	h.Write([]byte(workerID))
+	return h.Sum64()
+}
+
+// hasSpare reports whether the worker can take another task; a nil worker
+// has none
+func (w *Worker) hasSpare() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.CurrentLoad < w.Capacity
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/spf13/viper"
+)
+
+// ArtifactRef points at a task output kept in object storage rather than
+// inline in the task result
+type ArtifactRef struct {
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// TaskResult is the outcome of a task. Small results are returned inline;
+// results above the spill threshold are uploaded and referenced instead
+type TaskResult struct {
+	Inline   string       `json:"inline,omitempty"`
+	Artifact *ArtifactRef `json:"artifact,omitempty"`
+}
+
+// artifactStore keeps task artifacts in an S3-compatible bucket, keyed by
+// tenant, workflow, and task so a workflow's artifacts share a prefix
+type artifactStore struct {
+	client *minio.Client
+	bucket string
+	// spillThreshold is the largest result, in bytes, kept inline
+	spillThreshold int
+}
+
+// initArtifactStore connects to the object store configured by
+// ARTIFACT_ENDPOINT, creating the bucket if needed. It returns nil when no
+// endpoint is configured, in which case every result stays inline
+func initArtifactStore(ctx context.Context) (*artifactStore, error) {
+	endpoint := viper.GetString("ARTIFACT_ENDPOINT")
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(viper.GetString("ARTIFACT_ACCESS_KEY"), viper.GetString("ARTIFACT_SECRET_KEY"), ""),
+		Secure: viper.GetBool("ARTIFACT_USE_SSL"),
+		Region: viper.GetString("ARTIFACT_REGION"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating object storage client: %w", err)
+	}
+
+	bucket := viper.GetString("ARTIFACT_BUCKET")
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("checking artifact bucket %s: %w", bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: viper.GetString("ARTIFACT_REGION")}); err != nil {
+			return nil, fmt.Errorf("creating artifact bucket %s: %w", bucket, err)
+		}
+	}
+
+	return &artifactStore{
+		client:         client,
+		bucket:         bucket,
+		spillThreshold: viper.GetInt("ARTIFACT_SPILL_THRESHOLD"),
+	}, nil
+}
+
+// workflowArtifactPrefix is the key prefix shared by a workflow's artifacts
+func workflowArtifactPrefix(tenantID, workflowID string) string {
+	if tenantID == "" {
+		tenantID = "default"
+	}
+	return tenantID + "/" + workflowID + "/"
+}
+
+// upload stores an artifact produced by a task
+func (s *artifactStore) upload(ctx context.Context, task *Task, name string, data []byte, contentType string) (*ArtifactRef, error) {
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	key := workflowArtifactPrefix(task.TenantID, task.WorkflowID) + task.ID + "/" + name
+
+	info, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return nil, fmt.Errorf("uploading artifact %s: %w", key, err)
+	}
+	return &ArtifactRef{Key: key, Size: info.Size, ContentType: contentType}, nil
+}
+
+// download fetches an artifact, typically one produced by an upstream task
+func (s *artifactStore) download(ctx context.Context, ref ArtifactRef) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, ref.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("downloading artifact %s: %w", ref.Key, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("downloading artifact %s: %w", ref.Key, err)
+	}
+	return data, nil
+}
+
+// spillResult keeps a small result inline and uploads a large one, returning
+// a reference to it in place of the result
+func (s *artifactStore) spillResult(ctx context.Context, task *Task, result string) (*TaskResult, error) {
+	if s == nil || len(result) <= s.spillThreshold {
+		return &TaskResult{Inline: result}, nil
+	}
+
+	ref, err := s.upload(ctx, task, "result", []byte(result), "")
+	if err != nil {
+		return nil, err
+	}
+	return &TaskResult{Artifact: ref}, nil
+}
+
+// deleteWorkflowArtifacts removes every artifact stored for a workflow
+func (s *artifactStore) deleteWorkflowArtifacts(ctx context.Context, tenantID, workflowID string) error {
+	if s == nil {
+		return nil
+	}
+
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    workflowArtifactPrefix(tenantID, workflowID),
+		Recursive: true,
+	})
+	var failed int
+	for result := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		log.Printf("Error removing artifact %s: %v", result.ObjectName, result.Err)
+		failed++
+	}
+	if failed > 0 {
+		return fmt.Errorf("removing artifacts of workflow %s: %d objects could not be removed", workflowID, failed)
+	}
+	return nil
+}
+
+type artifactStoreKey struct{}
+
+// uploadArtifact stores one of a task's outputs with the artifact store of
+// the worker executing it, so executors can hand large outputs to
+// downstream tasks
+func uploadArtifact(ctx context.Context, task *Task, name string, data []byte, contentType string) (*ArtifactRef, error) {
+	store, _ := ctx.Value(artifactStoreKey{}).(*artifactStore)
+	if store == nil {
+		return nil, fmt.Errorf("artifact storage is not configured")
+	}
+	return store.upload(ctx, task, name, data, contentType)
+}
+
+// downloadArtifact fetches one of a task's input artifacts with the artifact
+// store of the worker executing it
+func downloadArtifact(ctx context.Context, ref ArtifactRef) ([]byte, error) {
+	store, _ := ctx.Value(artifactStoreKey{}).(*artifactStore)
+	if store == nil {
+		return nil, fmt.Errorf("artifact storage is not configured")
+	}
+	return store.download(ctx, ref)
+}
+
+// handleDeleteWorkflowArtifacts serves DELETE /workflows/{id}/artifacts,
+// called when a workflow is deleted
+func (s *WorkerServer) handleDeleteWorkflowArtifacts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	workflowID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/workflows/"), "/artifacts")
+	if !ok || workflowID == "" || strings.Contains(workflowID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := s.Artifacts.deleteWorkflowArtifacts(r.Context(), r.URL.Query().Get("tenant"), workflowID); err != nil {
+		log.Printf("Error deleting artifacts of workflow %s: %v", workflowID, err)
+		http.Error(w, "deleting artifacts failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// clientContext returns a context as a client sends it: a span of its own
+// trace and the given baggage, propagated with the shared propagator
+func clientContext(t *testing.T, values map[string]string) context.Context {
+	t.Helper()
+	bag := baggage.FromContext(context.Background())
+	for key, value := range values {
+		member, err := baggage.NewMember(key, value)
+		if err != nil {
+			t.Fatalf("baggage %s: %v", key, err)
+		}
+		if bag, err = bag.SetMember(member); err != nil {
+			t.Fatalf("baggage %s: %v", key, err)
+		}
+	}
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+	ctx, span := sdktrace.NewTracerProvider().Tracer("client").Start(ctx, "client")
+	t.Cleanup(func() { span.End() })
+	return ctx
+}
+
+func usePropagator(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+}
+
+// captureExecutor registers a task type whose executor records the context
+// it runs in
+func captureExecutor(t *testing.T) (string, *context.Context) {
+	t.Helper()
+	var captured context.Context
+	taskExecutors["capture"] = func(ctx context.Context, task *Task) (string, error) {
+		captured = ctx
+		return "", nil
+	}
+	t.Cleanup(func() { delete(taskExecutors, "capture") })
+	return "capture", &captured
+}
+
+func newTestWorker(taskTypes ...string) *Worker {
+	return &Worker{
+		ID:          "test-1",
+		TaskTypes:   taskTypes,
+		Capacity:    1,
+		ActiveTasks: make(map[string]struct{}),
+		released:    make(chan struct{}, 1),
+	}
+}
+
+func TestBaggageReachesWorkerThroughTraceContext(t *testing.T) {
+	usePropagator(t)
+	taskType, captured := captureExecutor(t)
+	client := clientContext(t, map[string]string{baggagePriority: priorityHigh, baggageDebug: "true"})
+
+	// The executor injects the run's context into each task it dispatches
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(client, carrier)
+	task := &Task{ID: "task-1", Type: taskType, Attempt: 1, TraceContext: carrier}
+
+	if _, err := newTestWorker(taskType).execute(context.Background(), task); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	bag := baggage.FromContext(*captured)
+	if got := bag.Member(baggagePriority).Value(); got != priorityHigh {
+		t.Errorf("priority baggage = %q, want %q", got, priorityHigh)
+	}
+	if got := bag.Member(baggageDebug).Value(); got != "true" {
+		t.Errorf("debug baggage = %q, want %q", got, "true")
+	}
+	want := trace.SpanContextFromContext(client).TraceID()
+	if got := trace.SpanContextFromContext(*captured).TraceID(); got != want {
+		t.Errorf("worker span trace ID = %s, want the client's %s", got, want)
+	}
+	if got := task.priorityOrDefault(); got != priorityHigh {
+		t.Errorf("priorityOrDefault() = %q, want %q from baggage", got, priorityHigh)
+	}
+}
+
+func TestBaggageReachesWorkerThroughGRPCMetadata(t *testing.T) {
+	usePropagator(t)
+	taskType, captured := captureExecutor(t)
+	client := clientContext(t, map[string]string{baggagePriority: priorityLow})
+
+	// The client sends its trace context and baggage as gRPC metadata
+	md := metadata.MD{}
+	otel.GetTextMapPropagator().Inject(client, metadataCarrier(md))
+	incoming := metadata.NewIncomingContext(context.Background(), md)
+
+	pool := &WorkerPool{Workers: make(map[string]*Worker), byType: make(map[string][]*Worker)}
+	pool.add(newTestWorker(taskType))
+	server := &WorkerServer{Pool: pool}
+	_, err := propagationUnaryInterceptor(incoming, nil, &grpc.UnaryServerInfo{FullMethod: "/worker.WorkerService/ExecuteTask"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return server.ExecuteTask(ctx, &Task{Type: taskType})
+		})
+	if err != nil {
+		t.Fatalf("ExecuteTask: %v", err)
+	}
+
+	if got := baggage.FromContext(*captured).Member(baggagePriority).Value(); got != priorityLow {
+		t.Errorf("priority baggage = %q, want %q", got, priorityLow)
+	}
+	want := trace.SpanContextFromContext(client).TraceID()
+	if got := trace.SpanContextFromContext(*captured).TraceID(); got != want {
+		t.Errorf("worker span trace ID = %s, want the client's %s", got, want)
+	}
+}
+
+func TestDebugSamplerSamplesDebugBaggage(t *testing.T) {
+	sampler := newDebugSampler(0)
+	params := func(ctx context.Context) sdktrace.SamplingParameters {
+		return sdktrace.SamplingParameters{ParentContext: ctx, TraceID: trace.TraceID{1}, Name: "span"}
+	}
+
+	if got := sampler.ShouldSample(params(context.Background())).Decision; got != sdktrace.Drop {
+		t.Errorf("decision without baggage = %v, want Drop", got)
+	}
+	debug := clientContext(t, map[string]string{baggageDebug: "true"})
+	debug = trace.ContextWithSpanContext(debug, trace.SpanContext{})
+	if got := sampler.ShouldSample(params(debug)).Decision; got != sdktrace.RecordAndSample {
+		t.Errorf("decision with debug baggage = %v, want RecordAndSample", got)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// redacted replaces the value of a secret setting in /config
+const redacted = "REDACTED"
+
+// secretSettings are fragments of setting names whose values are secret
+var secretSettings = []string{"PASSWORD", "SECRET", "TOKEN", "ACCESS_KEY", "API_KEY", "CREDENTIAL", "WEBHOOK"}
+
+// effectiveConfig returns every setting as it took effect after merging the
+// environment over the defaults, keyed by environment variable, with secrets
+// redacted
+func effectiveConfig() map[string]interface{} {
+	config := make(map[string]interface{})
+	for _, key := range viper.AllKeys() {
+		name := strings.ToUpper(key)
+		config[name] = redactSetting(name, viper.Get(key))
+	}
+	return config
+}
+
+// redactSetting hides the value of a secret setting, and the password of a
+// URL in any other setting, such as REDIS_URL or DATABASE_URL
+func redactSetting(name string, value interface{}) interface{} {
+	for _, fragment := range secretSettings {
+		if strings.Contains(name, fragment) {
+			if value == "" {
+				return value
+			}
+			return redacted
+		}
+	}
+
+	s, ok := value.(string)
+	if !ok || !strings.Contains(s, "://") {
+		return value
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		// An unparseable URL could still hold credentials
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// handleConfig reports the effective configuration, for checking which
+// settings were read from the environment
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(effectiveConfig())
+}
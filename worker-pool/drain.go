@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// DrainStatus reports the progress of draining the worker pool
+type DrainStatus struct {
+	Draining bool `json:"draining"`
+	// ActiveTasks is the number of tasks still executing or queued
+	ActiveTasks int  `json:"active_tasks"`
+	Drained     bool `json:"drained"`
+	// TimedOut is set once the drain timeout passes with tasks still active
+	TimedOut  bool      `json:"timed_out"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+}
+
+// drainState records when a drain started and when it times out
+type drainState struct {
+	mu       sync.Mutex
+	started  time.Time
+	deadline time.Time
+}
+
+// isDraining reports whether the pool has stopped taking new tasks
+func (p *WorkerPool) isDraining() bool {
+	return p.draining.Load()
+}
+
+// activeTasks returns the number of tasks executing or queued across all
+// workers
+func (p *WorkerPool) activeTasks() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	active := 0
+	for _, worker := range p.Workers {
+		worker.mu.Lock()
+		active += len(worker.ActiveTasks)
+		worker.mu.Unlock()
+		active += worker.queue.len()
+	}
+	return active
+}
+
+// drainStatus returns the current progress of the drain
+func (s *WorkerServer) drainStatus() DrainStatus {
+	s.drain.mu.Lock()
+	started, deadline := s.drain.started, s.drain.deadline
+	s.drain.mu.Unlock()
+
+	status := DrainStatus{
+		Draining:    s.Pool.isDraining(),
+		ActiveTasks: s.Pool.activeTasks(),
+		StartedAt:   started,
+	}
+	if status.Draining {
+		status.Drained = status.ActiveTasks == 0
+		status.TimedOut = !status.Drained && time.Now().After(deadline)
+	}
+	return status
+}
+
+// Drain stops every worker from polling for new tasks, reports the pool as
+// not ready so no new tasks are routed to it, then waits for the active tasks
+// to finish, up to timeout. progress, when set, receives the status every
+// second. The process keeps running, so a deploy can drain a node before
+// terminating it
+func (s *WorkerServer) Drain(ctx context.Context, timeout time.Duration, progress func(DrainStatus)) DrainStatus {
+	s.startDrain(timeout)
+	return s.waitDrained(ctx, progress)
+}
+
+// startDrain starts draining the pool. Draining again while a drain is
+// underway keeps the original drain and its timeout
+func (s *WorkerServer) startDrain(timeout time.Duration) bool {
+	s.drain.mu.Lock()
+	defer s.drain.mu.Unlock()
+
+	if s.Pool.draining.Load() {
+		return false
+	}
+	s.drain.started = time.Now()
+	s.drain.deadline = s.drain.started.Add(timeout)
+	s.Pool.draining.Store(true)
+	s.Ready.shutdown()
+	log.Printf("Draining worker pool with %d active tasks, waiting up to %s", s.Pool.activeTasks(), timeout)
+	return true
+}
+
+// waitDrained waits until the pool is drained or the drain times out
+func (s *WorkerServer) waitDrained(ctx context.Context, progress func(DrainStatus)) DrainStatus {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		status := s.drainStatus()
+		if progress != nil {
+			progress(status)
+		}
+		if status.Drained || status.TimedOut {
+			return status
+		}
+
+		select {
+		case <-ctx.Done():
+			return status
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleDrain serves /drain. POST starts draining, with an optional timeout
+// such as ?timeout=2m, and returns immediately; GET reports progress, so a
+// deploy orchestrator can poll until drained is set
+func (s *WorkerServer) handleDrain(w http.ResponseWriter, r *http.Request) {
+	code := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		timeout := viper.GetDuration("DRAIN_TIMEOUT")
+		if value := r.URL.Query().Get("timeout"); value != "" {
+			var err error
+			if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+				http.Error(w, fmt.Sprintf("invalid timeout %q", value), http.StatusBadRequest)
+				return
+			}
+		}
+		if s.startDrain(timeout) {
+			// Log the outcome once the drain the request started finishes
+			go func() {
+				status := s.waitDrained(context.Background(), nil)
+				if status.Drained {
+					log.Println("Worker pool drained")
+				} else {
+					log.Printf("Timed out draining worker pool with %d tasks still active", status.ActiveTasks)
+				}
+			}()
+		}
+		code = http.StatusAccepted
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(s.drainStatus())
+}
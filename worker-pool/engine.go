@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// engineConn manages the connection to the durable engine. It watches the
+// connection's state and, when the connection fails, redials with
+// exponential backoff and jitter, so a restart of the durable engine only
+// pauses the workers rather than breaking them
+type engineConn struct {
+	target     string
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu   sync.Mutex
+	conn *grpc.ClientConn
+	// ready is closed while the connection is up and replaced when it drops
+	ready chan struct{}
+	up    bool
+}
+
+func newEngineConn(target string, minBackoff, maxBackoff time.Duration) *engineConn {
+	return &engineConn{
+		target:     target,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		ready:      make(chan struct{}),
+	}
+}
+
+// run keeps the connection up until ctx is cancelled
+func (e *engineConn) run(ctx context.Context) {
+	attempt := 0
+	for ctx.Err() == nil {
+		conn, err := grpc.DialContext(ctx, e.target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err == nil {
+			// monitor reports whether the connection ever became ready, in
+			// which case the backoff starts over
+			if e.monitor(ctx, conn) {
+				attempt = 0
+			}
+			conn.Close()
+		} else {
+			log.Printf("Error dialing durable engine at %s: %v", e.target, err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		delay := e.backoff(attempt)
+		attempt++
+		log.Printf("Reconnecting to durable engine in %s", delay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+	e.setDown(nil)
+}
+
+// monitor tracks a connection's state until it fails or ctx is cancelled,
+// reporting whether it was ever ready
+func (e *engineConn) monitor(ctx context.Context, conn *grpc.ClientConn) bool {
+	conn.Connect()
+	wasReady := false
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			wasReady = true
+			e.setUp(conn)
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			e.setDown(conn)
+			return wasReady
+		case connectivity.Idle:
+			// An idle connection that was ready lost its transport; dropping
+			// back to a fresh dial gives it the reconnect backoff
+			if wasReady {
+				e.setDown(conn)
+				return wasReady
+			}
+			conn.Connect()
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return wasReady
+		}
+	}
+}
+
+// backoff returns the delay before reconnect attempt n, doubling from
+// minBackoff up to maxBackoff with up to 20% jitter either way
+func (e *engineConn) backoff(attempt int) time.Duration {
+	delay := e.minBackoff
+	for i := 0; i < attempt && delay < e.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > e.maxBackoff {
+		delay = e.maxBackoff
+	}
+	jitter := (rand.Float64()*0.4 - 0.2) * float64(delay)
+	return delay + time.Duration(jitter)
+}
+
+func (e *engineConn) setUp(conn *grpc.ClientConn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conn = conn
+	if !e.up {
+		e.up = true
+		close(e.ready)
+		durableEngineUp.Set(1)
+		log.Printf("Connected to durable engine at %s", e.target)
+	}
+}
+
+// setDown marks the connection down, unless it has already been replaced
+func (e *engineConn) setDown(conn *grpc.ClientConn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if conn != nil && e.conn != conn {
+		return
+	}
+	e.conn = nil
+	if e.up {
+		e.up = false
+		e.ready = make(chan struct{})
+		durableEngineUp.Set(0)
+		log.Printf("Lost connection to durable engine at %s, pausing polling", e.target)
+	}
+}
+
+// ping reports an error while the connection is down
+func (e *engineConn) ping(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.up {
+		return fmt.Errorf("not connected to durable engine at %s", e.target)
+	}
+	return nil
+}
+
+// waitReady blocks until the connection is up, returning it, or until ctx
+// is cancelled
+func (e *engineConn) waitReady(ctx context.Context) (*grpc.ClientConn, error) {
+	for {
+		e.mu.Lock()
+		ready, conn := e.ready, e.conn
+		e.mu.Unlock()
+		if conn != nil {
+			return conn, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ready:
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ExecuteTaskResponse is the outcome of a task executed synchronously. A
+// task that runs and fails is reported here rather than as an error
+type ExecuteTaskResponse struct {
+	Success         bool        `json:"success"`
+	Result          *TaskResult `json:"result,omitempty"`
+	Error           string      `json:"error,omitempty"`
+	ExecutionTimeMs int64       `json:"execution_time_ms"`
+}
+
+// ExecuteTask runs a single task synchronously on a worker accepting its type,
+// bypassing the durable engine. Tasks with an AffinityKey favour the same
+// worker, otherwise the least loaded one is used. It goes through the same
+// executor registry, timeout, and capacity limits as polled tasks, returning
+// ResourceExhausted when every worker for the type is at capacity
+func (s *WorkerServer) ExecuteTask(ctx context.Context, task *Task) (*ExecuteTaskResponse, error) {
+	if task.Type == "" {
+		return nil, status.Error(codes.InvalidArgument, "task type is required")
+	}
+	if err := checkTaskTypes([]string{task.Type}); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if s.Pool.isDraining() {
+		return nil, status.Error(codes.Unavailable, "worker pool is draining")
+	}
+	if !s.Pool.serves(task.Type) {
+		return nil, status.Errorf(codes.FailedPrecondition, "no worker in the pool accepts %s tasks", task.Type)
+	}
+	if task.ID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		task.ID = "sync-" + hex.EncodeToString(b)
+	}
+	if task.Attempt == 0 {
+		task.Attempt = 1
+	}
+
+	worker := s.Pool.route(task.Type, task.AffinityKey)
+	if worker == nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "every worker accepting %s tasks is at capacity", task.Type)
+	}
+
+	start := time.Now()
+	result, err := worker.execute(ctx, task)
+	// Another task can take the worker's last slot between routing and executing
+	if errors.Is(err, errWorkerAtCapacity) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	response := &ExecuteTaskResponse{
+		Success:         err == nil,
+		Result:          result,
+		ExecutionTimeMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	return response, nil
+}
+
+// executeTaskRequest is the JSON body of a synchronous execution request
+type executeTaskRequest struct {
+	TaskID         string            `json:"task_id"`
+	TaskType       string            `json:"task_type"`
+	Parameters     map[string]string `json:"parameters,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	TenantID       string            `json:"tenant_id,omitempty"`
+	WorkflowID     string            `json:"workflow_id,omitempty"`
+	Artifacts      []ArtifactRef     `json:"artifacts,omitempty"`
+	AffinityKey    string            `json:"affinity_key,omitempty"`
+}
+
+// handleExecuteTask serves POST /tasks/execute, running one task and
+// responding with its outcome
+func (s *WorkerServer) handleExecuteTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request executeTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("decoding task: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Tasks run in the caller's trace and with its baggage
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	response, err := s.ExecuteTask(ctx, &Task{
+		ID:          request.TaskID,
+		WorkflowID:  request.WorkflowID,
+		TenantID:    request.TenantID,
+		Type:        request.TaskType,
+		Parameters:  request.Parameters,
+		Timeout:     time.Duration(request.TimeoutSeconds) * time.Second,
+		Artifacts:   request.Artifacts,
+		AffinityKey: request.AffinityKey,
+	})
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch status.Code(err) {
+		case codes.InvalidArgument, codes.FailedPrecondition:
+			code = http.StatusBadRequest
+		case codes.ResourceExhausted:
+			code = http.StatusTooManyRequests
+		case codes.Unavailable:
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, status.Convert(err).Message(), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Log streams a task can write to
+const (
+	logStreamStdout   = "stdout"
+	logStreamStderr   = "stderr"
+	logStreamRequest  = "request"
+	logStreamResponse = "response"
+	logStreamSystem   = "system"
+)
+
+// taskLogStore ships task execution logs to a per-task Redis stream, which
+// the observatory tails to serve them to clients. Each stream is capped and
+// expires, so only a bounded recent history is kept
+type taskLogStore struct {
+	client   *redis.Client
+	maxLines int64
+	ttl      time.Duration
+}
+
+func newTaskLogStore(client *redis.Client, maxLines int64, ttl time.Duration) *taskLogStore {
+	return &taskLogStore{client: client, maxLines: maxLines, ttl: ttl}
+}
+
+// tenantKey mirrors the executor's Redis key layout for tenant-scoped state
+func tenantKey(tenantID string, parts ...string) string {
+	return "chronos:tenant:" + tenantID + ":" + strings.Join(parts, ":")
+}
+
+// taskLogKey is the Redis stream holding a task's logs
+func taskLogKey(task *Task) string {
+	tenant := task.TenantID
+	if tenant == "" {
+		tenant = "default"
+	}
+	return tenantKey(tenant, "task", task.ID, "logs")
+}
+
+// write appends an entry to the task's log stream. Shipping is best effort:
+// a task never fails because its logs couldn't be stored
+func (s *taskLogStore) write(ctx context.Context, task *Task, fields map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	fields["ts"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	key := taskLogKey(task)
+	pipe := s.client.Pipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: s.maxLines,
+		Approx: true,
+		Values: fields,
+	})
+	pipe.Expire(ctx, key, s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error shipping logs for task %s: %v", task.ID, err)
+	}
+}
+
+// finish marks the end of a task's logs so followers stop waiting
+func (s *taskLogStore) finish(task *Task, err error) {
+	status := "COMPLETED"
+	if err != nil {
+		status = "FAILED"
+	}
+	// The task's context may already be done, but the end marker must still
+	// be written
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.write(ctx, task, map[string]interface{}{"eof": "1", "status": status})
+}
+
+// taskLogger writes lines to one task's log stream
+type taskLogger struct {
+	store *taskLogStore
+	task  *Task
+}
+
+type taskLoggerKey struct{}
+
+// withTaskLogger attaches a task's logger to its execution context
+func withTaskLogger(ctx context.Context, logger *taskLogger) context.Context {
+	return context.WithValue(ctx, taskLoggerKey{}, logger)
+}
+
+// logTask writes a line to the log stream of the task executing under ctx,
+// so executors can record process output or HTTP requests and responses
+func logTask(ctx context.Context, stream, format string, args ...interface{}) {
+	logger, _ := ctx.Value(taskLoggerKey{}).(*taskLogger)
+	if logger == nil {
+		return
+	}
+	logger.store.write(ctx, logger.task, map[string]interface{}{
+		"stream": stream,
+		"line":   fmt.Sprintf(format, args...),
+	})
+}
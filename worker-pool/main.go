@@ -9,43 +9,69 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 )
 
 // Prometheus metrics
 var (
-	tasksExecuted = prometheus.NewCounter(prometheus.CounterOpts{
+	tasksExecuted = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "chronos_worker_tasks_executed_total",
 		Help: "Total number of tasks executed",
-	})
+	}, []string{"task_type"})
 	
-	taskSuccesses = prometheus.NewCounter(prometheus.CounterOpts{
+	taskSuccesses = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "chronos_worker_tasks_succeeded_total",
 		Help: "Total number of tasks executed successfully",
-	})
+	}, []string{"task_type"})
 	
-	taskFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	taskFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "chronos_worker_tasks_failed_total",
 		Help: "Total number of tasks that failed execution",
-	})
+	}, []string{"task_type"})
 	
-	executionLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+	executionLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "chronos_worker_execution_latency_seconds",
 		Help:    "Latency of task execution operations in seconds",
 		Buckets: prometheus.DefBuckets,
+	}, []string{"task_type"})
+	
+	taskPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chronos_worker_panics_total",
+		Help: "Total number of task executions that panicked",
+	}, []string{"task_type"})
+	
+	durableEngineUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "chronos_worker_durable_engine_up",
+		Help: "Whether the worker pool is connected to the durable engine (1) or not (0)",
 	})
+	
+	affinityRoutes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chronos_worker_affinity_routes_total",
+		Help: "Total number of tasks with an affinity key routed to their preferred worker or, when it was full, another one",
+	}, []string{"outcome"})
+	
+	queuedTasks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chronos_worker_queued_tasks",
+		Help: "Number of tasks waiting in worker queues for a free slot",
+	}, []string{"priority"})
 )
 
 // Worker represents a single worker in the pool
@@ -56,12 +82,26 @@ type Worker struct {
 	CurrentLoad int
 	ActiveTasks map[string]struct{}
 	mu          sync.Mutex
+	// logs ships task logs to the observatory; nil disables shipping
+	logs *taskLogStore
+	// artifacts stores large task results; nil keeps every result inline
+	artifacts *artifactStore
+	// results publishes task outcomes for the executor; nil disables it
+	results *resultPublisher
+	// queue holds the worker's tasks waiting for a free slot
+	queue *taskQueue
+	// released is signalled when a task finishes and frees a slot
+	released chan struct{}
 }
 
 // WorkerPool manages a collection of workers
 type WorkerPool struct {
 	Workers map[string]*Worker
-	mu      sync.RWMutex
+	// byType indexes workers by the task types they accept
+	byType map[string][]*Worker
+	mu     sync.RWMutex
+	// draining stops the workers from polling for new tasks
+	draining atomic.Bool
 }
 
 func init() {
@@ -70,16 +110,69 @@ func init() {
 	prometheus.MustRegister(taskSuccesses)
 	prometheus.MustRegister(taskFailures)
 	prometheus.MustRegister(executionLatency)
+	prometheus.MustRegister(taskPanics)
+	prometheus.MustRegister(durableEngineUp)
+	prometheus.MustRegister(affinityRoutes)
+	prometheus.MustRegister(queuedTasks)
 	
 	// Load configuration
 	viper.SetDefault("PORT", "8082")
 	viper.SetDefault("DURABLE_ENGINE_URL", "localhost:50051")
+	viper.SetDefault("DURABLE_ENGINE_MIN_BACKOFF", "1s")
+	viper.SetDefault("DURABLE_ENGINE_MAX_BACKOFF", "30s")
 	viper.SetDefault("WORKER_COUNT", 5)
+	viper.SetDefault("WORKER_COUNT_CLAMP", false)
+	viper.SetDefault("MAX_WORKER_COUNT", 1000)
+	viper.SetDefault("WORKER_CAPACITY", 10)
+	viper.SetDefault("WORKER_TASK_TYPES", "http,process,database,file")
+	viper.SetDefault("WORKER_POOLS", "")
 	viper.SetDefault("OTLP_ENDPOINT", "localhost:4317")
+	viper.SetDefault("TRACE_SAMPLE_RATIO", 1.0)
+	viper.SetDefault("METRICS_EXPORT_INTERVAL", "30s")
+	viper.SetDefault("REDIS_URL", "redis://localhost:6379/0")
+	viper.SetDefault("TASK_LOG_MAX_LINES", 1000)
+	viper.SetDefault("TASK_LOG_TTL", "24h")
+	viper.SetDefault("ARTIFACT_ENDPOINT", "")
+	viper.SetDefault("ARTIFACT_BUCKET", "chronos-artifacts")
+	viper.SetDefault("ARTIFACT_ACCESS_KEY", "")
+	viper.SetDefault("ARTIFACT_SECRET_KEY", "")
+	viper.SetDefault("ARTIFACT_REGION", "")
+	viper.SetDefault("ARTIFACT_USE_SSL", false)
+	viper.SetDefault("ARTIFACT_SPILL_THRESHOLD", 256*1024)
+	viper.SetDefault("ENVIRONMENT", "development")
+	viper.SetDefault("HEALTH_CHECK_INTERVAL", "10s")
+	viper.SetDefault("DRAIN_TIMEOUT", "5m")
+	viper.SetDefault("PRIORITY_AGING_INTERVAL", "30s")
+	viper.SetDefault("KAFKA_BROKERS", "localhost:9092")
+	viper.SetDefault("KAFKA_TOPIC_RESULTS", "chronos-task-results")
+	viper.SetDefault("KAFKA_PRODUCER_TIMEOUT", "10s")
 	
 	viper.AutomaticEnv()
 }
 
+// reflectionEnabled reports whether the gRPC server exposes reflection for
+// tools like grpcurl. It's on by default except in production, and
+// GRPC_REFLECTION overrides the default either way
+func reflectionEnabled() bool {
+	if viper.IsSet("GRPC_REFLECTION") {
+		return viper.GetBool("GRPC_REFLECTION")
+	}
+	switch viper.GetString("ENVIRONMENT") {
+	case "prod", "production":
+		return false
+	}
+	return true
+}
+
+// serviceResource describes the service in its traces and metrics
+func serviceResource() *resource.Resource {
+	return resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String("chronos-worker-pool"),
+		semconv.ServiceVersionKey.String("0.1.0"),
+	)
+}
+
 func initTracer() (*sdktrace.TracerProvider, error) {
 	ctx := context.Background()
 	
@@ -94,47 +187,89 @@ func initTracer() (*sdktrace.TracerProvider, error) {
 		return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
 	}
 	
-	resource := resource.NewWithAttributes(
-		semconv.SchemaURL,
-		semconv.ServiceNameKey.String("chronos-worker-pool"),
-		semconv.ServiceVersionKey.String("0.1.0"),
-	)
-	
 	provider := sdktrace.NewTracerProvider(
 		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource),
+		sdktrace.WithResource(serviceResource()),
+		sdktrace.WithSampler(newDebugSampler(viper.GetFloat64("TRACE_SAMPLE_RATIO"))),
 	)
 	
 	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
 	
 	return provider, nil
 }
 
-func createWorkerPool() *WorkerPool {
-	workerCount := viper.GetInt("WORKER_COUNT")
+func initRedis() (*redis.Client, error) {
+	opts, err := redis.ParseURL(viper.GetString("REDIS_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing Redis URL: %w", err)
+	}
+	
+	client := redis.NewClient(opts)
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to Redis: %w", err)
+	}
+	
+	return client, nil
+}
+
+// createWorkerPool builds the workers described by WORKER_POOLS, or
+// WORKER_COUNT identical workers configured by WORKER_CAPACITY and
+// WORKER_TASK_TYPES when no pools are defined
+func createWorkerPool(logs *taskLogStore, artifacts *artifactStore, results *resultPublisher) (*WorkerPool, error) {
 	pool := &WorkerPool{
 		Workers: make(map[string]*Worker),
+		byType:  make(map[string][]*Worker),
+	}
+	
+	var specs []PoolSpec
+	if spec := viper.GetString("WORKER_POOLS"); spec != "" {
+		var err error
+		if specs, err = parsePoolSpecs(spec); err != nil {
+			return nil, err
+		}
+	} else {
+		spec, err := defaultPoolSpec()
+		if err != nil {
+			return nil, err
+		}
+		specs = []PoolSpec{spec}
 	}
 	
-	for i := 0; i < workerCount; i++ {
-		workerID := fmt.Sprintf("worker-%d", i+1)
-		worker := &Worker{
-			ID:          workerID,
-			TaskTypes:   []string{"http", "process", "database", "file"},
-			Capacity:    10,
-			CurrentLoad: 0,
-			ActiveTasks: make(map[string]struct{}),
+	for _, spec := range specs {
+		for i := 0; i < spec.Count; i++ {
+			pool.add(&Worker{
+				ID:          fmt.Sprintf("%s-%d", spec.Name, i+1),
+				TaskTypes:   spec.TaskTypes,
+				Capacity:    spec.Capacity,
+				CurrentLoad: 0,
+				ActiveTasks: make(map[string]struct{}),
+				logs:        logs,
+				artifacts:   artifacts,
+				results:     results,
+				queue:       newTaskQueue(viper.GetDuration("PRIORITY_AGING_INTERVAL")),
+				released:    make(chan struct{}, 1),
+			})
 		}
-		
-		pool.Workers[workerID] = worker
 	}
 	
-	return pool
+	return pool, nil
 }
 
 // WorkerServer implements the gRPC worker service
 type WorkerServer struct {
-	Pool *WorkerPool
+	Pool      *WorkerPool
+	Artifacts *artifactStore
+	Ready     *readiness
+	drain     drainState
 	// In a real implementation, this would include the generated gRPC server interface
 }
 
@@ -152,8 +287,60 @@ func main() {
 		}
 	}()
 	
+	// Export the Prometheus metrics over OTLP too, alongside /metrics
+	mp, err := initMeter()
+	if err != nil {
+		log.Fatalf("Failed to initialize meter: %v", err)
+	}
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}()
+	
+	// Task logs are shipped through Redis to the observatory. Without Redis
+	// tasks still run, their logs just aren't available to clients
+	var logs *taskLogStore
+	redisClient, err := initRedis()
+	if err != nil {
+		log.Printf("Task log shipping disabled: %v", err)
+	} else {
+		defer redisClient.Close()
+		logs = newTaskLogStore(redisClient, viper.GetInt64("TASK_LOG_MAX_LINES"), viper.GetDuration("TASK_LOG_TTL"))
+	}
+	
+	// Large task results are spilled to object storage when it's configured
+	artifacts, err := initArtifactStore(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to initialize artifact storage: %v", err)
+	}
+	
+	// Task outcomes are published for the executor, which advances runs and
+	// trips its dispatch circuit breakers on them
+	results := initResultPublisher()
+	if results == nil {
+		log.Println("Task result publishing disabled: KAFKA_BROKERS is empty")
+	} else {
+		defer results.writer.Close()
+	}
+	
 	// Create worker pool
-	pool := createWorkerPool()
+	pool, err := createWorkerPool(logs, artifacts, results)
+	if err != nil {
+		log.Fatalf("Failed to create worker pool: %v", err)
+	}
+	// Keep the durable engine connection up, reconnecting when it drops
+	engine := newEngineConn(
+		viper.GetString("DURABLE_ENGINE_URL"),
+		viper.GetDuration("DURABLE_ENGINE_MIN_BACKOFF"),
+		viper.GetDuration("DURABLE_ENGINE_MAX_BACKOFF"),
+	)
+	
+	// Readiness follows the durable engine, which all tasks come from
+	ready := newReadiness("worker.WorkerService",
+		readinessCheck{name: "durable_engine", check: engine.ping},
+	)
+	server := &WorkerServer{Pool: pool, Artifacts: artifacts, Ready: ready}
 	
 	// Set up gRPC server
 	port := viper.GetString("PORT")
@@ -162,9 +349,13 @@ func main() {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 	
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(propagationUnaryInterceptor))
 	// Register the worker service
-	// worker.RegisterWorkerServiceServer(grpcServer, &WorkerServer{Pool: pool})
+	// worker.RegisterWorkerServiceServer(grpcServer, server)
+	ready.register(grpcServer)
+	if reflectionEnabled() {
+		reflection.Register(grpcServer)
+	}
 	
 	// Start gRPC server in a goroutine
 	go func() {
@@ -174,20 +365,44 @@ func main() {
 		}
 	}()
 	
-	// Start task polling for each worker
 	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
 	
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		engine.run(ctx)
+	}()
+	go ready.watch(ctx, viper.GetDuration("HEALTH_CHECK_INTERVAL"))
+	
+	// Start task polling for each worker, running polled tasks from its queue
 	for _, worker := range pool.Workers {
-		wg.Add(1)
+		wg.Add(2)
 		go func(w *Worker) {
 			defer wg.Done()
-			pollForTasks(ctx, w)
+			pollForTasks(ctx, pool, w, engine)
+		}(worker)
+		go func(w *Worker) {
+			defer wg.Done()
+			w.runQueue(ctx)
 		}(worker)
 	}
 	
 	// Set up HTTP server for metrics
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/readyz", ready.handleReadyz)
+	
+	// Effective configuration, with secrets redacted
+	http.HandleFunc("/config", handleConfig)
+	
+	// Artifact cleanup for deleted workflows
+	http.HandleFunc("/workflows/", server.handleDeleteWorkflowArtifacts)
+	
+	// Drain for zero-downtime deploys
+	http.HandleFunc("/drain", server.handleDrain)
+	
+	// Synchronous execution of a single task
+	http.HandleFunc("/tasks/execute", server.handleExecuteTask)
 	
 	// Start HTTP server in a goroutine
 	httpServer := &http.Server{Addr: ":8092"}
@@ -205,6 +420,9 @@ func main() {
 	
 	log.Println("Shutting down servers...")
 	
+	// Report NOT_SERVING so traffic drains before the servers stop
+	ready.shutdown()
+	
 	// Cancel context to stop task polling
 	cancel()
 	
@@ -224,13 +442,15 @@ func main() {
 	log.Println("Servers exited properly")
 }
 
-func pollForTasks(ctx context.Context, worker *Worker) {
+// pollForTasks polls the durable engine for the worker's tasks, pausing
+// while the engine is unreachable and taking no new tasks once the pool drains
+func pollForTasks(ctx context.Context, pool *WorkerPool, worker *Worker, engine *engineConn) {
 	log.Printf("Worker %s started polling for tasks", worker.ID)
 	
 	// In a real implementation, this would:
 	// 1. Connect to the Durable Engine via gRPC
 	// 2. Poll for available tasks
-	// 3. Execute tasks and report results
+	// 3. Queue tasks with worker.enqueue, which runs them by priority and reports results
 	// 4. Update metrics
 	
 	ticker := time.NewTicker(5 * time.Second)
@@ -242,8 +462,19 @@ func pollForTasks(ctx context.Context, worker *Worker) {
 			log.Printf("Worker %s stopping", worker.ID)
 			return
 		case <-ticker.C:
+			// A draining pool finishes its active tasks but takes no new ones
+			if pool.isDraining() {
+				continue
+			}
+			if _, err := engine.waitReady(ctx); err != nil {
+				continue
+			}
+			
 			// Simulate task polling and execution
+			_, span := tracer.Start(ctx, "worker.poll",
+				trace.WithAttributes(attribute.String("worker.id", worker.ID)))
 			log.Printf("Worker %s polling for tasks", worker.ID)
+			span.End()
 		}
 	}
 }
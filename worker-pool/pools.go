@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// PoolSpec defines a group of identical workers, e.g. three workers for
+// http tasks with capacity 20 each
+type PoolSpec struct {
+	Name      string   `yaml:"name"`
+	Count     int      `yaml:"count"`
+	Capacity  int      `yaml:"capacity"`
+	TaskTypes []string `yaml:"task_types"`
+}
+
+// parsePoolSpecs parses the WORKER_POOLS spec, a YAML or JSON list of pools
+func parsePoolSpecs(spec string) ([]PoolSpec, error) {
+	var pools []PoolSpec
+	if err := yaml.Unmarshal([]byte(spec), &pools); err != nil {
+		return nil, fmt.Errorf("parsing worker pool spec: %w", err)
+	}
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("worker pool spec defines no pools")
+	}
+
+	names := make(map[string]bool, len(pools))
+	for i := range pools {
+		pool := &pools[i]
+		if pool.Name == "" {
+			return nil, fmt.Errorf("worker pool %d has no name", i+1)
+		}
+		if names[pool.Name] {
+			return nil, fmt.Errorf("duplicate worker pool %q", pool.Name)
+		}
+		names[pool.Name] = true
+		count, err := checkWorkerCount(fmt.Sprintf("count of worker pool %q", pool.Name), pool.Count)
+		if err != nil {
+			return nil, err
+		}
+		pool.Count = count
+		if pool.Capacity <= 0 {
+			return nil, fmt.Errorf("worker pool %q needs a positive capacity, got %d", pool.Name, pool.Capacity)
+		}
+		if len(pool.TaskTypes) == 0 {
+			return nil, fmt.Errorf("worker pool %q has no task types", pool.Name)
+		}
+		if err := checkTaskTypes(pool.TaskTypes); err != nil {
+			return nil, fmt.Errorf("worker pool %q: %w", pool.Name, err)
+		}
+	}
+
+	return pools, nil
+}
+
+// defaultPoolSpec describes the pool used when WORKER_POOLS is unset:
+// WORKER_COUNT workers with WORKER_CAPACITY capacity each, accepting the
+// comma-separated WORKER_TASK_TYPES
+func defaultPoolSpec() (PoolSpec, error) {
+	spec := PoolSpec{
+		Name:     "worker",
+		Count:    viper.GetInt("WORKER_COUNT"),
+		Capacity: viper.GetInt("WORKER_CAPACITY"),
+	}
+	for _, taskType := range strings.Split(viper.GetString("WORKER_TASK_TYPES"), ",") {
+		if taskType = strings.TrimSpace(taskType); taskType != "" {
+			spec.TaskTypes = append(spec.TaskTypes, taskType)
+		}
+	}
+
+	count, err := checkWorkerCount("WORKER_COUNT", spec.Count)
+	if err != nil {
+		return PoolSpec{}, err
+	}
+	spec.Count = count
+	if spec.Capacity <= 0 {
+		return PoolSpec{}, fmt.Errorf("WORKER_CAPACITY must be positive, got %d", spec.Capacity)
+	}
+	if len(spec.TaskTypes) == 0 {
+		return PoolSpec{}, fmt.Errorf("WORKER_TASK_TYPES lists no task types")
+	}
+	if err := checkTaskTypes(spec.TaskTypes); err != nil {
+		return PoolSpec{}, fmt.Errorf("WORKER_TASK_TYPES: %w", err)
+	}
+	return spec, nil
+}
+
+// checkWorkerCount validates the worker count of a pool, named by what in
+// errors and warnings. A count below 1 would start a pool that never polls,
+// so it's rejected, or raised to 1 when WORKER_COUNT_CLAMP is set. Every
+// worker runs its own poller, so a count above MAX_WORKER_COUNT is lowered
+// to it
+func checkWorkerCount(what string, count int) (int, error) {
+	if count < 1 {
+		if !viper.GetBool("WORKER_COUNT_CLAMP") {
+			return 0, fmt.Errorf("%s must be at least 1, got %d", what, count)
+		}
+		log.Printf("Warning: %s is %d, starting 1 worker instead", what, count)
+		return 1, nil
+	}
+	if limit := viper.GetInt("MAX_WORKER_COUNT"); count > limit {
+		log.Printf("Warning: %s is %d, capping it at MAX_WORKER_COUNT of %d", what, count, limit)
+		return limit, nil
+	}
+	return count, nil
+}
+
+// checkTaskTypes checks that every task type has a registered executor
+func checkTaskTypes(taskTypes []string) error {
+	for _, taskType := range taskTypes {
+		if _, ok := taskExecutors[taskType]; !ok {
+			return fmt.Errorf("unknown task type %q, expected one of %s",
+				taskType, strings.Join(registeredTaskTypes(), ", "))
+		}
+	}
+	return nil
+}
+
+// registeredTaskTypes lists the task types with a registered executor
+func registeredTaskTypes() []string {
+	types := make([]string, 0, len(taskExecutors))
+	for taskType := range taskExecutors {
+		types = append(types, taskType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// add adds a worker to the pool and indexes it under each of its task types.
+// Pools may overlap, so a task type can be served by workers of several pools
+func (p *WorkerPool) add(worker *Worker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Workers[worker.ID] = worker
+	for _, taskType := range worker.TaskTypes {
+		p.byType[taskType] = append(p.byType[taskType], worker)
+	}
+}
+
+// serves reports whether any worker accepts the task type
+func (p *WorkerPool) serves(taskType string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.byType[taskType]) > 0
+}
+
+// route picks the worker with spare capacity to run a task of a type, or nil
+// when no worker serves the type or all of them are full. Tasks with an
+// affinity key go to the key's preferred worker while it has spare capacity;
+// the rest go to the least loaded worker
+func (p *WorkerPool) route(taskType, affinityKey string) *Worker {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if affinityKey != "" {
+		if worker := preferredWorker(p.byType[taskType], affinityKey); worker.hasSpare() {
+			affinityRoutes.WithLabelValues("preferred").Inc()
+			return worker
+		}
+		affinityRoutes.WithLabelValues("fallback").Inc()
+	}
+
+	var best *Worker
+	bestSpare := 0
+	for _, worker := range p.byType[taskType] {
+		worker.mu.Lock()
+		spare := worker.Capacity - worker.CurrentLoad
+		worker.mu.Unlock()
+		if spare > bestSpare {
+			best, bestSpare = worker, spare
+		}
+	}
+	return best
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Task priorities, matching those the executor dispatches tasks with
+const (
+	priorityHigh   = "high"
+	priorityNormal = "normal"
+	priorityLow    = "low"
+)
+
+// priorityLevels orders the priorities, highest first in the queue
+var priorityLevels = map[string]int{
+	priorityLow:    0,
+	priorityNormal: 1,
+	priorityHigh:   2,
+}
+
+// priorityOrDefault returns the task's priority. A task without one takes
+// the priority baggage of its workflow's trace, defaulting to normal
+func (t *Task) priorityOrDefault() string {
+	if t.Priority != "" {
+		return t.Priority
+	}
+	if priority := t.baggage().Member(baggagePriority).Value(); priority != "" {
+		if _, ok := priorityLevels[priority]; ok {
+			return priority
+		}
+	}
+	return priorityNormal
+}
+
+// queuedTask is a task waiting in a worker's queue
+type queuedTask struct {
+	task     *Task
+	priority string
+	// rank orders the queue, see taskQueue
+	rank float64
+	// seq keeps tasks of equal rank in arrival order
+	seq uint64
+}
+
+// taskHeap is a max-heap of queued tasks by rank
+type taskHeap []*queuedTask
+
+func (q taskHeap) Len() int { return len(q) }
+
+func (q taskHeap) Less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank > q[j].rank
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskHeap) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *taskHeap) Push(x any) { *q = append(*q, x.(*queuedTask)) }
+
+func (q *taskHeap) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return item
+}
+
+// taskQueue holds a worker's tasks waiting for a free slot, highest priority
+// first. Waiting tasks age so low priority ones aren't starved: a task gains
+// one priority level for every aging interval it waits. Every task ages at
+// the same rate, so the order never changes while tasks wait, and a task's
+// rank is fixed when it's queued as its level minus its queue time in
+// aging intervals
+type taskQueue struct {
+	mu    sync.Mutex
+	items taskHeap
+	seq   uint64
+	aging time.Duration
+	// ready is signalled when a task is queued
+	ready chan struct{}
+}
+
+// newTaskQueue creates a queue whose tasks gain a priority level every
+// aging interval; zero disables aging
+func newTaskQueue(aging time.Duration) *taskQueue {
+	return &taskQueue{aging: aging, ready: make(chan struct{}, 1)}
+}
+
+// push queues a task by its priority
+func (q *taskQueue) push(task *Task) error {
+	priority := task.priorityOrDefault()
+	level, ok := priorityLevels[priority]
+	if !ok {
+		return fmt.Errorf("task %s has unknown priority %q", task.ID, task.Priority)
+	}
+
+	rank := float64(level)
+	if q.aging > 0 {
+		rank -= float64(time.Now().UnixNano()) / float64(q.aging)
+	}
+
+	q.mu.Lock()
+	q.seq++
+	heap.Push(&q.items, &queuedTask{task: task, priority: priority, rank: rank, seq: q.seq})
+	q.mu.Unlock()
+	queuedTasks.WithLabelValues(priority).Inc()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop removes the next task to run, or returns nil when the queue is empty
+func (q *taskQueue) pop() *Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil
+	}
+	item := heap.Pop(&q.items).(*queuedTask)
+	queuedTasks.WithLabelValues(item.priority).Dec()
+	return item.task
+}
+
+// len returns the number of queued tasks
+func (q *taskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// enqueue queues a task to run once the worker has a free slot
+func (w *Worker) enqueue(task *Task) error {
+	if !w.supports(task.Type) {
+		return fmt.Errorf("worker %s does not support task type %q", w.ID, task.Type)
+	}
+	return w.queue.push(task)
+}
+
+// runQueue runs the worker's queued tasks, starting the next one whenever a
+// slot frees up, until ctx is cancelled
+func (w *Worker) runQueue(ctx context.Context) {
+	for {
+		// runQueue is the queue's only consumer, so a task is still queued
+		// once a slot is acquired
+		for w.queue.len() > 0 && w.acquire() {
+			task := w.queue.pop()
+			go func() {
+				defer w.release()
+				// In a real implementation, this would report the result to the durable engine
+				if _, err := w.run(ctx, task); err != nil {
+					log.Printf("Queued task %s failed on worker %s: %v", task.ID, w.ID, err)
+				}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.queue.ready:
+		case <-w.released:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+)
+
+// Task result statuses published on the results topic
+const (
+	taskResultCompleted = "COMPLETED"
+	taskResultFailed    = "FAILED"
+)
+
+// TaskResultMessage is the outcome of a task, published onto the results
+// topic for the executor, which advances the task's run and feeds its
+// dispatch circuit breakers with it
+type TaskResultMessage struct {
+	TaskID     string `json:"task_id"`
+	RunID      string `json:"run_id,omitempty"`
+	WorkflowID string `json:"workflow_id,omitempty"`
+	TenantID   string `json:"tenant_id,omitempty"`
+	TaskType   string `json:"task_type"`
+	// Status is COMPLETED or FAILED
+	Status string      `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Result *TaskResult `json:"result,omitempty"`
+}
+
+// resultWriter is the part of a Kafka writer results are published through
+type resultWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// resultPublisher publishes task results onto the results topic
+type resultPublisher struct {
+	writer resultWriter
+}
+
+// initResultPublisher creates the publisher of task results, or returns nil
+// when KAFKA_BROKERS is empty and results aren't published
+func initResultPublisher() *resultPublisher {
+	brokers := viper.GetString("KAFKA_BROKERS")
+	if brokers == "" {
+		return nil
+	}
+	return &resultPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers),
+		Topic:        viper.GetString("KAFKA_TOPIC_RESULTS"),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		WriteTimeout: viper.GetDuration("KAFKA_PRODUCER_TIMEOUT"),
+	}}
+}
+
+// publish reports a task's outcome. Results are keyed like the executor's
+// task messages, by tenant and workflow, so a run's results stay ordered on
+// one partition. A result that can't be published is logged: the task has
+// already run, and failing it now would only run it again
+func (p *resultPublisher) publish(ctx context.Context, task *Task, result *TaskResult, err error) {
+	if p == nil {
+		return
+	}
+
+	message := &TaskResultMessage{
+		TaskID:     task.ID,
+		RunID:      task.RunID,
+		WorkflowID: task.WorkflowID,
+		TenantID:   task.TenantID,
+		TaskType:   task.Type,
+		Status:     taskResultCompleted,
+		Result:     result,
+	}
+	if err != nil {
+		message.Status = taskResultFailed
+		message.Error = err.Error()
+	}
+	value, jsonErr := json.Marshal(message)
+	if jsonErr != nil {
+		log.Printf("Error encoding result of task %s: %v", task.ID, jsonErr)
+		return
+	}
+
+	// The task's own context may be ending with it, so the result gets a
+	// fresh deadline of its own
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	err = p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(tenantOrDefault(task.TenantID) + "/" + task.WorkflowID),
+		Value: value,
+	})
+	if err != nil {
+		log.Printf("Error publishing result of task %s: %v", task.ID, err)
+	}
+}
+
+// tenantOrDefault returns the tenant ID, falling back to the default tenant
+// the executor files tenantless runs under
+func tenantOrDefault(tenantID string) string {
+	if tenantID == "" {
+		return "default"
+	}
+	return tenantID
+}
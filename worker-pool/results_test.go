@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// recordingWriter keeps the messages written to it
+type recordingWriter struct {
+	messages []kafka.Message
+}
+
+func (w *recordingWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *recordingWriter) Close() error { return nil }
+
+func TestWorkerPublishesTaskResults(t *testing.T) {
+	taskType, _ := captureExecutor(t)
+	taskExecutors["failing"] = func(ctx context.Context, task *Task) (string, error) {
+		return "", errors.New("connection refused")
+	}
+	t.Cleanup(func() { delete(taskExecutors, "failing") })
+
+	writer := &recordingWriter{}
+	worker := newTestWorker(taskType, "failing")
+	worker.results = &resultPublisher{writer: writer}
+
+	ok := &Task{ID: "t1", RunID: "run-1", WorkflowID: "wf", TenantID: "acme", Type: taskType, Attempt: 1}
+	if _, err := worker.execute(context.Background(), ok); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	failed := &Task{ID: "t2", RunID: "run-1", WorkflowID: "wf", Type: "failing", Attempt: 1}
+	if _, err := worker.execute(context.Background(), failed); err == nil {
+		t.Fatal("failing task succeeded")
+	}
+
+	if len(writer.messages) != 2 {
+		t.Fatalf("published %d results, want 2", len(writer.messages))
+	}
+	want := []struct {
+		key, status, tenant, err string
+	}{
+		{"acme/wf", taskResultCompleted, "acme", ""},
+		{"default/wf", taskResultFailed, "", "connection refused"},
+	}
+	for i, message := range writer.messages {
+		var result TaskResultMessage
+		if err := json.Unmarshal(message.Value, &result); err != nil {
+			t.Fatalf("result %d: %v", i, err)
+		}
+		if string(message.Key) != want[i].key {
+			t.Errorf("result %d key = %s, want %s", i, message.Key, want[i].key)
+		}
+		if result.Status != want[i].status || result.TenantID != want[i].tenant || result.Error != want[i].err {
+			t.Errorf("result %d = %+v, want status %s, tenant %q, error %q", i, result, want[i].status, want[i].tenant, want[i].err)
+		}
+		if result.RunID != "run-1" {
+			t.Errorf("result %d run ID = %q, want run-1", i, result.RunID)
+		}
+	}
+}
+
+func TestNilResultPublisherIsDisabled(t *testing.T) {
+	var publisher *resultPublisher
+	publisher.publish(context.Background(), &Task{ID: "t1"}, nil, nil)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the worker pool's spans
+var tracer = otel.Tracer("chronos-worker-pool")
+
+// endSpan marks the span as failed when err is set, then ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Task is a unit of work leased from the durable engine
+type Task struct {
+	ID         string
+	WorkflowID string
+	// RunID is the workflow run the task belongs to, empty for tasks
+	// executed synchronously outside of a run
+	RunID    string
+	TenantID string
+	Type       string
+	Parameters map[string]string
+	Timeout    time.Duration
+	// Attempt counts executions of the task, starting at 1
+	Attempt int
+	// TraceContext carries the propagated context of the workflow's trace
+	TraceContext map[string]string
+	// Artifacts are the inputs the task's upstream tasks stored in object
+	// storage, fetched with downloadArtifact
+	Artifacts []ArtifactRef
+	// AffinityKey, when set, routes tasks sharing the key to the same worker
+	// while it has spare capacity, so warm connections and cached data
+	// keyed by it are reused
+	AffinityKey string
+	// Priority is "high", "normal" (the default), or "low", ordering the
+	// tasks waiting in a worker's queue
+	Priority string
+}
+
+// TaskExecutor runs tasks of a single type and returns their result
+type TaskExecutor func(ctx context.Context, task *Task) (string, error)
+
+// taskExecutors is the registry of executors by task type. Only registered
+// types are used as metric labels, which keeps series cardinality bounded
+var taskExecutors = map[string]TaskExecutor{
+	"http":     executeSimulatedTask,
+	"process":  executeSimulatedTask,
+	"database": executeSimulatedTask,
+	"file":     executeSimulatedTask,
+}
+
+// unknownTaskType is the metric label used for unregistered task types
+const unknownTaskType = "unknown"
+
+// taskTypeLabel returns the metric label for a task type
+func taskTypeLabel(taskType string) string {
+	if _, ok := taskExecutors[taskType]; ok {
+		return taskType
+	}
+	return unknownTaskType
+}
+
+// executeSimulatedTask stands in for the real task type executors
+func executeSimulatedTask(ctx context.Context, task *Task) (string, error) {
+	// In a real implementation, this would perform the work described by the
+	// task's parameters, e.g. issue the HTTP request or run the process
+	logTask(ctx, logStreamStdout, "simulating %s task %s", task.Type, task.ID)
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(10 * time.Millisecond):
+		return fmt.Sprintf("task %s completed", task.ID), nil
+	}
+}
+
+// taskPanicError is the failure reported for a task whose executor panicked
+type taskPanicError struct {
+	value interface{}
+	stack string
+}
+
+func (e *taskPanicError) Error() string {
+	return fmt.Sprintf("task executor panicked: %v\n%s", e.value, e.stack)
+}
+
+// runExecutor runs a task executor, converting a panic into a task failure
+// carrying the stack trace so one faulty task can't take down the worker
+func runExecutor(ctx context.Context, executor TaskExecutor, task *Task) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &taskPanicError{value: r, stack: string(debug.Stack())}
+		}
+	}()
+	return executor(ctx, task)
+}
+
+// errWorkerAtCapacity is returned for a task offered to a worker already
+// running as many tasks as its capacity allows
+var errWorkerAtCapacity = errors.New("worker is at capacity")
+
+// supports reports whether the worker accepts tasks of the given type
+func (w *Worker) supports(taskType string) bool {
+	for _, t := range w.TaskTypes {
+		if t == taskType {
+			return true
+		}
+	}
+	return false
+}
+
+// execute runs a task on the worker when it has a free slot, failing with
+// errWorkerAtCapacity otherwise
+func (w *Worker) execute(ctx context.Context, task *Task) (*TaskResult, error) {
+	if !w.acquire() {
+		return nil, fmt.Errorf("worker %s: %w", w.ID, errWorkerAtCapacity)
+	}
+	defer w.release()
+	return w.run(ctx, task)
+}
+
+// acquire takes one of the worker's slots, reporting false when it's at
+// capacity
+func (w *Worker) acquire() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.CurrentLoad >= w.Capacity {
+		return false
+	}
+	w.CurrentLoad++
+	return true
+}
+
+// release frees a slot taken by acquire, waking the worker's queue
+func (w *Worker) release() {
+	w.mu.Lock()
+	w.CurrentLoad--
+	w.mu.Unlock()
+
+	select {
+	case w.released <- struct{}{}:
+	default:
+	}
+}
+
+// run runs a task in a slot already acquired, tracking it as active for the
+// duration and recording execution metrics labelled by task type. The
+// execution is traced as a child of the workflow's trace. Results too large
+// to keep inline are spilled to object storage, and every outcome is
+// published onto the results topic
+func (w *Worker) run(ctx context.Context, task *Task) (result *TaskResult, err error) {
+	label := taskTypeLabel(task.Type)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(task.TraceContext))
+	ctx, span := tracer.Start(ctx, "worker.execute "+label,
+		trace.WithAttributes(
+			attribute.String("task.id", task.ID),
+			attribute.String("task.type", label),
+			attribute.String("workflow.id", task.WorkflowID),
+			attribute.String("worker.id", w.ID),
+			attribute.Int("task.attempt", task.Attempt),
+		))
+	start := time.Now()
+	defer func() {
+		span.SetAttributes(attribute.Float64("task.duration_seconds", time.Since(start).Seconds()))
+		// Executor panics are recovered by runExecutor; anything else that
+		// panics still ends the span before the panic continues
+		if r := recover(); r != nil {
+			endSpan(span, fmt.Errorf("task %s panicked: %v", task.ID, r))
+			panic(r)
+		}
+		endSpan(span, err)
+		w.results.publish(ctx, task, result, err)
+	}()
+
+	executor, ok := taskExecutors[task.Type]
+	if !ok || !w.supports(task.Type) {
+		return nil, fmt.Errorf("worker %s does not support task type %q", w.ID, task.Type)
+	}
+
+	w.mu.Lock()
+	w.ActiveTasks[task.ID] = struct{}{}
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		delete(w.ActiveTasks, task.ID)
+		w.mu.Unlock()
+	}()
+
+	// Ship the task's logs for the observatory, ending them once it finishes
+	if w.logs != nil {
+		ctx = withTaskLogger(ctx, &taskLogger{store: w.logs, task: task})
+		defer func() { w.logs.finish(task, err) }()
+	}
+
+	if w.artifacts != nil {
+		ctx = context.WithValue(ctx, artifactStoreKey{}, w.artifacts)
+	}
+
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+
+	output, err := runExecutor(ctx, executor, task)
+	if err == nil {
+		result, err = w.artifacts.spillResult(ctx, task, output)
+	}
+	var panicErr *taskPanicError
+	if errors.As(err, &panicErr) {
+		taskPanics.WithLabelValues(label).Inc()
+		span.SetAttributes(attribute.String("task.panic_stack", panicErr.stack))
+		logTask(ctx, logStreamStderr, "%v", panicErr)
+	}
+	executionLatency.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	tasksExecuted.WithLabelValues(label).Inc()
+
+	if err != nil {
+		taskFailures.WithLabelValues(label).Inc()
+		log.Printf("Worker %s failed task %s: %v", w.ID, task.ID, err)
+		return nil, err
+	}
+
+	taskSuccesses.WithLabelValues(label).Inc()
+	return result, nil
+}